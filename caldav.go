@@ -0,0 +1,479 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// CalDAV sync pulls busy time from a calendar collection and publishes task deadlines as VTODOs to a task list
+// collection. ETags from the last sync are kept in a state file in the notes directory, so only resources that
+// changed get downloaded or uploaded. When a task changed on both sides since the last sync, PERSPECTIVE_CALDAV_CONFLICT
+// decides who wins: "local" (the default, the To Do List is the source of truth) or "remote".
+//
+//	PERSPECTIVE_CALDAV_CALENDAR  calendar collection URL to read busy time from
+//	PERSPECTIVE_CALDAV_TASKS     task list collection URL to publish deadlines to
+//	PERSPECTIVE_CALDAV_USER      basic auth user name
+//	PERSPECTIVE_CALDAV_PASSWORD  basic auth password
+const (
+	caldavStateFile = ".perspective-caldav.json"
+
+	conflictLocalWins  = "local"
+	conflictRemoteWins = "remote"
+
+	caldavEstimateProp = "X-PERSPECTIVE-ESTIMATE"
+)
+
+var errPreconditionFailed = errors.New("resource changed on the server since it was last read")
+
+type caldavSync struct {
+	client      *http.Client
+	calendarURL string
+	tasksURL    string
+	user        string
+	password    string
+	conflict    string
+	statePath   string
+	state       caldavState
+}
+
+// caldavState is what we remember between syncs
+type caldavState struct {
+	// calendar resources by href, with their data so unchanged ones don't need downloading again
+	Calendar map[string]caldavResource `json:"calendar"`
+	// published tasks by UID
+	Tasks map[string]caldavTaskState `json:"tasks"`
+}
+
+type caldavResource struct {
+	ETag string `json:"etag"`
+	Data string `json:"data"`
+}
+
+type caldavTaskState struct {
+	Href string `json:"href"`
+	ETag string `json:"etag"`
+	// Hash is of the task as it was when last in sync, to tell whether it changed locally since
+	Hash string `json:"hash"`
+}
+
+// newCalDAVSync is nil when no CalDAV collections are configured
+func newCalDAVSync(logger log15.Logger) *caldavSync {
+	calendarURL := os.Getenv("PERSPECTIVE_CALDAV_CALENDAR")
+	tasksURL := os.Getenv("PERSPECTIVE_CALDAV_TASKS")
+	if calendarURL == "" && tasksURL == "" {
+		return nil
+	}
+	conflict := os.Getenv("PERSPECTIVE_CALDAV_CONFLICT")
+	if conflict != conflictRemoteWins {
+		conflict = conflictLocalWins
+	}
+	sync := &caldavSync{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		calendarURL: calendarURL,
+		tasksURL:    tasksURL,
+		user:        os.Getenv("PERSPECTIVE_CALDAV_USER"),
+		password:    os.Getenv("PERSPECTIVE_CALDAV_PASSWORD"),
+		conflict:    conflict,
+		statePath:   notesDir(logger) + "/" + caldavStateFile,
+	}
+	sync.loadState(logger)
+	return sync
+}
+
+func (s *caldavSync) loadState(logger log15.Logger) {
+	s.state = caldavState{Calendar: map[string]caldavResource{}, Tasks: map[string]caldavTaskState{}}
+	data, err := os.ReadFile(s.statePath)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(data, &s.state)
+	if err != nil {
+		logger.Warn("CalDAV sync state is unreadable, starting over", "err", err.Error())
+		s.state = caldavState{}
+	}
+	if s.state.Calendar == nil {
+		s.state.Calendar = map[string]caldavResource{}
+	}
+	if s.state.Tasks == nil {
+		s.state.Tasks = map[string]caldavTaskState{}
+	}
+}
+
+func (s *caldavSync) saveState(logger log15.Logger) {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err == nil {
+		err = os.WriteFile(s.statePath, data, 0600)
+	}
+	if err != nil {
+		logger.Error("Unable to save CalDAV sync state", "err", err.Error())
+	}
+}
+
+// multistatus is the WebDAV response to REPORT and PROPFIND
+type multistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"DAV: href"`
+	Propstat []davPropstat `xml:"DAV: propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"DAV: prop"`
+	Status string  `xml:"DAV: status"`
+}
+
+type davProp struct {
+	ETag         string `xml:"DAV: getetag"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+func (r davResponse) prop() davProp {
+	for _, propstat := range r.Propstat {
+		if propstat.Status == "" || strings.Contains(propstat.Status, " 200 ") {
+			return propstat.Prop
+		}
+	}
+	return davProp{}
+}
+
+func (s *caldavSync) request(method, target string, headers map[string]string, body string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if s.user != "" {
+		req.SetBasicAuth(s.user, s.password)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return s.client.Do(req)
+}
+
+// report runs a REPORT against a collection and returns the resources it lists, keyed by absolute URL
+func (s *caldavSync) report(collection, body string) (map[string]davProp, error) {
+	resp, err := s.request("REPORT", collection, map[string]string{
+		"Depth":        "1",
+		"Content-Type": `application/xml; charset="utf-8"`,
+	}, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("REPORT %s returned %s", collection, resp.Status)
+	}
+	status := multistatus{}
+	err = xml.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read REPORT response: %s", err.Error())
+	}
+	base, err := url.Parse(collection)
+	if err != nil {
+		return nil, err
+	}
+	props := map[string]davProp{}
+	for _, response := range status.Responses {
+		href, err := url.Parse(strings.TrimSpace(response.Href))
+		if err != nil {
+			continue
+		}
+		resolved := base.ResolveReference(href).String()
+		if strings.TrimSuffix(resolved, "/") == strings.TrimSuffix(base.String(), "/") {
+			continue
+		}
+		props[resolved] = response.prop()
+	}
+	return props, nil
+}
+
+// listETags lists the component resources of a collection with just their ETags
+func (s *caldavSync) listETags(collection, component string, timeRange string) (map[string]davProp, error) {
+	return s.report(collection, fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/></D:prop>
+  <C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="%s">%s</C:comp-filter></C:comp-filter></C:filter>
+</C:calendar-query>`, component, timeRange))
+}
+
+// multiget downloads the calendar data of the given resources in one request
+func (s *caldavSync) multiget(collection string, hrefs []string) (map[string]davProp, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop><D:getetag/><C:calendar-data/></D:prop>`
+	for _, href := range hrefs {
+		body += "\n  <D:href>" + xmlEscape(href) + "</D:href>"
+	}
+	body += "\n</C:calendar-multiget>"
+	return s.report(collection, body)
+}
+
+func xmlEscape(text string) string {
+	buf := &strings.Builder{}
+	xml.EscapeText(buf, []byte(text))
+	return buf.String()
+}
+
+// pullBusy brings the calendar cache up to date and returns its busy time. If the server can't be reached the
+// cached calendar is used as-is.
+func (s *caldavSync) pullBusy(now time.Time, logger log15.Logger) []*GeneralEvent {
+	if s.calendarURL == "" {
+		return []*GeneralEvent{}
+	}
+	logger = logger.New("function", "pullBusy")
+	err := s.refreshCalendar(now, logger)
+	if err != nil {
+		logger.Error("Unable to sync CalDAV calendar, using what we had", "err", err.Error())
+	}
+	events := []*GeneralEvent{}
+	for href, resource := range s.state.Calendar {
+		calendar, err := parseICS(resource.Data)
+		if err != nil {
+			logger.Warn("Unable to parse CalDAV calendar object", "href", href, "err", err.Error())
+			continue
+		}
+		events = append(events, icsBusyEvents(calendar, now, homeLocation, logger)...)
+	}
+	return events
+}
+
+func (s *caldavSync) refreshCalendar(now time.Time, logger log15.Logger) error {
+	timeRange := fmt.Sprintf(`<C:time-range start="%s" end="%s"/>`, icsTime(now.Add(-24*time.Hour)), icsTime(now.Add(icsHorizon)))
+	listed, err := s.listETags(s.calendarURL, "VEVENT", timeRange)
+	if err != nil {
+		return err
+	}
+	changed := []string{}
+	for href, prop := range listed {
+		if cached, ok := s.state.Calendar[href]; !ok || cached.ETag != prop.ETag || prop.ETag == "" {
+			changed = append(changed, href)
+		}
+	}
+	for href := range s.state.Calendar {
+		if _, ok := listed[href]; !ok {
+			logger.Debug("Calendar object is gone", "href", href)
+			delete(s.state.Calendar, href)
+		}
+	}
+	if len(changed) != 0 {
+		logger.Debug("Downloading changed calendar objects", "count", len(changed))
+		fetched, err := s.multiget(s.calendarURL, changed)
+		if err != nil {
+			return err
+		}
+		for href, prop := range fetched {
+			s.state.Calendar[href] = caldavResource{ETag: prop.ETag, Data: prop.CalendarData}
+		}
+	}
+	s.saveState(logger)
+	return nil
+}
+
+// taskHash covers everything about a task that gets published
+func taskHash(task *Task) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join([]string{
+		task.Name, task.Deadline, formatDuration(task.estimateMinutes()), icsTime(task.DeadlineTime),
+	}, "\x00"))))
+}
+
+// taskToVTODO builds the calendar object published for a ranked task
+func taskToVTODO(task *Task, now time.Time) string {
+	b := &icsBuilder{}
+	b.add("BEGIN", "VCALENDAR")
+	b.add("VERSION", "2.0")
+	b.add("PRODID", icsProdID)
+	b.add("BEGIN", "VTODO")
+	b.add("UID", taskUID(task))
+	b.add("DTSTAMP", icsTime(now))
+	b.add("SUMMARY", icsEscape(task.Name))
+	if !task.DeadlineTime.IsZero() {
+		b.add("DUE", icsTime(task.DeadlineTime))
+	}
+	if task.isComplete() {
+		b.add("STATUS", "COMPLETED")
+	} else {
+		b.add("STATUS", "NEEDS-ACTION")
+		b.add(caldavEstimateProp, formatDuration(task.estimateMinutes()))
+	}
+	b.add("END", "VTODO")
+	b.add("END", "VCALENDAR")
+	return b.String()
+}
+
+// syncTasks publishes tasks that changed locally and applies changes made on the server. It returns true if any
+// local task changed, in which case the list needs ranking and writing again.
+func (s *caldavSync) syncTasks(tasks []*Task, now time.Time, logger log15.Logger) bool {
+	if s.tasksURL == "" {
+		return false
+	}
+	logger = logger.New("function", "syncTasks")
+	remote, err := s.listETags(s.tasksURL, "VTODO", "")
+	if err != nil {
+		logger.Error("Unable to list CalDAV tasks", "err", err.Error())
+		return false
+	}
+	changedLocal := false
+	for _, task := range tasks {
+		taskLogger := logger.New("task", task.Name)
+		uid := taskUID(task)
+		known, synced := s.state.Tasks[uid]
+		href := known.Href
+		if href == "" {
+			href = strings.TrimSuffix(s.tasksURL, "/") + "/" + url.PathEscape(uid) + ".ics"
+		}
+		remoteProp, onServer := remote[href]
+		localChanged := !synced || known.Hash != taskHash(task)
+		remoteChanged := synced && onServer && remoteProp.ETag != known.ETag
+		switch {
+		case !onServer:
+			if synced {
+				taskLogger.Info("Task is gone from the CalDAV task list, publishing it again")
+			}
+			err = s.publish(task, href, "", now, taskLogger)
+		case !synced:
+			// someone else published a task with this UID first
+			taskLogger.Info("Task is already on the CalDAV task list, resolving as a conflict")
+			changedLocal = s.resolveConflict(task, href, remoteProp.ETag, now, taskLogger) || changedLocal
+		case localChanged && remoteChanged:
+			taskLogger.Info("Task changed locally and on the CalDAV task list", "winner", s.conflict)
+			changedLocal = s.resolveConflict(task, href, remoteProp.ETag, now, taskLogger) || changedLocal
+		case localChanged:
+			err = s.publish(task, href, known.ETag, now, taskLogger)
+		case remoteChanged:
+			changedLocal = s.pullTask(task, href, taskLogger) || changedLocal
+		}
+		if err != nil {
+			taskLogger.Error("Unable to publish task, will try again next sync", "err", err.Error())
+			err = nil
+		}
+	}
+	s.saveState(logger)
+	return changedLocal
+}
+
+func (s *caldavSync) resolveConflict(task *Task, href, remoteETag string, now time.Time, logger log15.Logger) bool {
+	if s.conflict == conflictRemoteWins {
+		return s.pullTask(task, href, logger)
+	}
+	err := s.publish(task, href, remoteETag, now, logger)
+	if err != nil {
+		logger.Error("Unable to publish task, will try again next sync", "err", err.Error())
+	}
+	return false
+}
+
+// publish PUTs the task, only if the server still has etag (or nothing at all, when etag is empty)
+func (s *caldavSync) publish(task *Task, href, etag string, now time.Time, logger log15.Logger) error {
+	headers := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+	if etag == "" {
+		headers["If-None-Match"] = "*"
+	} else {
+		headers["If-Match"] = etag
+	}
+	resp, err := s.request(http.MethodPut, href, headers, taskToVTODO(task, now))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return errPreconditionFailed
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("PUT %s returned %s", href, resp.Status)
+	}
+	newETag := resp.Header.Get("ETag")
+	if newETag == "" {
+		// some servers don't hand back the ETag when they've changed what we sent, so go and look
+		props, err := s.multiget(s.tasksURL, []string{href})
+		if err == nil {
+			newETag = props[href].ETag
+		}
+	}
+	logger.Debug("Published task", "href", href, "etag", newETag)
+	s.state.Tasks[taskUID(task)] = caldavTaskState{Href: href, ETag: newETag, Hash: taskHash(task)}
+	return nil
+}
+
+// pullTask applies the server's copy of a task: its summary, its due date for dated tasks, and completion
+func (s *caldavSync) pullTask(task *Task, href string, logger log15.Logger) bool {
+	uid := taskUID(task)
+	resp, err := s.request(http.MethodGet, href, nil, "")
+	if err != nil {
+		logger.Error("Unable to download task", "err", err.Error())
+		return false
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		logger.Error("Unable to download task", "status", resp.Status)
+		return false
+	}
+	calendar, err := parseICS(string(data))
+	if err != nil {
+		logger.Error("Unable to parse task from server", "err", err.Error())
+		return false
+	}
+	var vtodo *icsComponent
+	for _, top := range calendar.children {
+		for _, child := range top.children {
+			if child.name == "VTODO" {
+				vtodo = child
+			}
+		}
+	}
+	if vtodo == nil {
+		logger.Error("Server copy of task has no VTODO")
+		return false
+	}
+	changed := false
+	if summary := strings.Replace(vtodo.value("SUMMARY"), `\,`, ",", -1); summary != "" && summary != task.Name {
+		logger.Info("Renaming task from CalDAV", "name", summary)
+		if task.UUID == "" {
+			// the UID came from the old name, so hold onto it
+			task.UUID = uid
+			task.setField("UUID", uid)
+		}
+		task.setName(summary)
+		changed = true
+	}
+	if due := vtodo.get("DUE"); due != nil {
+		if isDatedDeadline(task.Deadline) {
+			dueTime, err := parseICSTime(due.value, due.params, homeLocation)
+			if err == nil && !dueTime.Equal(task.DeadlineTime) {
+				deadline := dueTime.In(homeLocation).Format(taskDateFmt)
+				logger.Info("Moving deadline from CalDAV", "deadline", deadline)
+				task.Deadline = deadline
+				task.DeadlineTime = dueTime
+				task.setField("Deadline", deadline)
+				changed = true
+			}
+		}
+	}
+	if strings.ToUpper(vtodo.value("STATUS")) == "COMPLETED" && !task.isComplete() {
+		logger.Info("Task was completed on CalDAV")
+		task.setEstimate(0)
+		task.setField("Estimated Hours", "0")
+		changed = true
+	}
+	s.state.Tasks[uid] = caldavTaskState{Href: href, ETag: resp.Header.Get("ETag"), Hash: taskHash(task)}
+	if s.state.Tasks[uid].ETag == "" {
+		props, err := s.multiget(s.tasksURL, []string{href})
+		if err == nil {
+			s.state.Tasks[uid] = caldavTaskState{Href: href, ETag: props[href].ETag, Hash: taskHash(task)}
+		}
+	}
+	return changed
+}
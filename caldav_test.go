@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// fakeCalDAV is an in-memory stand-in for a CalDAV server, just enough of one for calendar-query and
+// calendar-multiget REPORTs, GET and conditional PUT
+type fakeCalDAV struct {
+	mu       sync.Mutex
+	objects  map[string]fakeCalDAVObject
+	version  int
+	requests []string
+}
+
+type fakeCalDAVObject struct {
+	etag string
+	data string
+}
+
+var fakeHrefMatcher = regexp.MustCompile(`<D:href>([^<]+)</D:href>`)
+var fakeCompMatcher = regexp.MustCompile(`comp-filter name="VCALENDAR"><C:comp-filter name="(\w+)"`)
+
+func newFakeCalDAV() *fakeCalDAV {
+	return &fakeCalDAV{objects: map[string]fakeCalDAVObject{}}
+}
+
+// put stores an object the way another client would, with a fresh ETag
+func (f *fakeCalDAV) put(path, data string) string {
+	f.version++
+	etag := fmt.Sprintf(`"%d"`, f.version)
+	f.objects[path] = fakeCalDAVObject{etag: etag, data: data}
+	return etag
+}
+
+func (f *fakeCalDAV) count(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	total := 0
+	for _, request := range f.requests {
+		if strings.HasPrefix(request, method) {
+			total++
+		}
+	}
+	return total
+}
+
+func (f *fakeCalDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	switch r.Method {
+	case "REPORT":
+		hrefs := []string{}
+		withData := strings.Contains(string(body), "calendar-multiget")
+		f.requests = append(f.requests, "REPORT "+map[bool]string{true: "multiget", false: "query"}[withData])
+		if withData {
+			for _, match := range fakeHrefMatcher.FindAllStringSubmatch(string(body), -1) {
+				hrefs = append(hrefs, strings.TrimPrefix(match[1], "http://"+r.Host))
+			}
+		} else {
+			component := fakeCompMatcher.FindStringSubmatch(string(body))[1]
+			for path, object := range f.objects {
+				if strings.HasPrefix(path, r.URL.Path) && strings.Contains(object.data, "BEGIN:"+component) {
+					hrefs = append(hrefs, path)
+				}
+			}
+		}
+		out := `<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`
+		for _, href := range hrefs {
+			object, ok := f.objects[href]
+			if !ok {
+				continue
+			}
+			data := ""
+			if withData {
+				data = "<C:calendar-data>" + xmlEscape(object.data) + "</C:calendar-data>"
+			}
+			out += fmt.Sprintf(`<D:response><D:href>%s</D:href><D:propstat><D:prop><D:getetag>%s</D:getetag>%s</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`,
+				href, xmlEscape(object.etag), data)
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, out+"</D:multistatus>")
+	case http.MethodGet:
+		f.requests = append(f.requests, "GET "+r.URL.Path)
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", object.etag)
+		fmt.Fprint(w, object.data)
+	case http.MethodPut:
+		f.requests = append(f.requests, "PUT "+r.URL.Path)
+		object, exists := f.objects[r.URL.Path]
+		if (r.Header.Get("If-None-Match") == "*" && exists) || (r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != object.etag) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", f.put(r.URL.Path, string(body)))
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestCalDAVSync(t *testing.T, server *httptest.Server, conflict string) *caldavSync {
+	s := &caldavSync{
+		client:      server.Client(),
+		calendarURL: server.URL + "/cal/",
+		tasksURL:    server.URL + "/tasks/",
+		conflict:    conflict,
+		statePath:   t.TempDir() + "/" + caldavStateFile,
+	}
+	s.loadState(log15.New())
+	return s
+}
+
+func testMeeting(start time.Time) string {
+	return fmt.Sprintf("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:meeting\r\nSUMMARY:Meeting\r\nDTSTART:%s\r\nDTEND:%s\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		icsTime(start), icsTime(start.Add(time.Hour)))
+}
+
+// check that busy time is pulled from the calendar and only changed objects get downloaded again
+func TestCalDAVPullBusy(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	fake := newFakeCalDAV()
+	fake.put("/cal/meeting.ics", testMeeting(mid.Add(12*time.Hour)))
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s := newTestCalDAVSync(t, server, conflictLocalWins)
+
+	events := s.pullBusy(mid, tLogger)
+	if len(events) != 1 || len(events[0].Periods) != 1 || !events[0].Periods[0].Start.Equal(mid.Add(12*time.Hour)) {
+		t.Errorf("Expected the meeting 12 hours from now, got %v", events)
+		t.FailNow()
+	}
+	s.pullBusy(mid, tLogger)
+	if fake.count("REPORT multiget") != 1 {
+		t.Errorf("Unchanged calendar was downloaded again; %d multigets", fake.count("REPORT multiget"))
+	}
+	fake.put("/cal/meeting.ics", testMeeting(mid.Add(20*time.Hour)))
+	events = s.pullBusy(mid, tLogger)
+	if fake.count("REPORT multiget") != 2 || len(events) != 1 || !events[0].Periods[0].Start.Equal(mid.Add(20*time.Hour)) {
+		t.Errorf("Moved meeting wasn't picked up, got %v", events)
+	}
+}
+
+// check publishing, incremental sync, remote edits and conflicts for tasks
+func TestCalDAVSyncTasks(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	fake := newFakeCalDAV()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	s := newTestCalDAVSync(t, server, conflictLocalWins)
+
+	report1, _, _ := createThreeTasks()
+	report1.buildRaw()
+	tasks := []*Task{report1}
+	sortTasks(tasks, mid, []*GeneralEvent{}, tLogger)
+	href := "/tasks/" + taskUID(report1) + ".ics"
+
+	if s.syncTasks(tasks, mid, tLogger) {
+		t.Errorf("Publishing a task shouldn't change it locally")
+	}
+	if !strings.Contains(fake.objects[href].data, "DUE:20221128T160000Z") {
+		t.Errorf("Task wasn't published: %v", fake.objects)
+		t.FailNow()
+	}
+	s.syncTasks(tasks, mid, tLogger)
+	if fake.count("PUT") != 1 {
+		t.Errorf("Unchanged task was published again; %d PUTs", fake.count("PUT"))
+	}
+
+	// completed and moved on the phone
+	remoteEdit := strings.Replace(fake.objects[href].data, "DUE:20221128T160000Z", "DUE:20221129T100000Z", 1)
+	remoteEdit = strings.Replace(remoteEdit, "STATUS:NEEDS-ACTION", "STATUS:COMPLETED", 1)
+	fake.put(href, remoteEdit)
+	if !s.syncTasks(tasks, mid, tLogger) {
+		t.Errorf("Remote edit should have changed the task")
+	}
+	if report1.EstimatedHours != 0 || !strings.HasPrefix(report1.Deadline, "10:00 11/29/2022") {
+		t.Errorf("Remote edit wasn't applied: %d %s", report1.EstimatedHours, report1.Deadline)
+	}
+	if !strings.Contains(report1.Raw, "- Estimated Hours; 0") || !strings.Contains(report1.Raw, "- Deadline; 10:00 11/29/2022") {
+		t.Errorf("Remote edit didn't make it into the markdown:\n%s", report1.Raw)
+	}
+
+	// edited on both sides; the local copy wins by default
+	sortTasks(tasks, mid, []*GeneralEvent{}, tLogger)
+	report1.EstimatedHours = 4
+	report1.setField("Estimated Hours", "4")
+	fake.put(href, strings.Replace(fake.objects[href].data, "DUE:20221129T100000Z", "DUE:20221130T100000Z", 1))
+	s.syncTasks(tasks, mid, tLogger)
+	if !strings.Contains(fake.objects[href].data, caldavEstimateProp+":4") || !strings.Contains(fake.objects[href].data, "DUE:20221129T100000Z") {
+		t.Errorf("Local copy should have won the conflict:\n%s", fake.objects[href].data)
+	}
+
+	// and the remote copy wins when asked to
+	s.conflict = conflictRemoteWins
+	report1.EstimatedHours = 5
+	report1.setField("Estimated Hours", "5")
+	fake.put(href, strings.Replace(fake.objects[href].data, "DUE:20221129T100000Z", "DUE:20221130T100000Z", 1))
+	if !s.syncTasks(tasks, mid, tLogger) || !strings.HasPrefix(report1.Deadline, "10:00 11/30/2022") {
+		t.Errorf("Remote copy should have won the conflict, deadline is %s", report1.Deadline)
+	}
+}
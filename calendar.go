@@ -2,37 +2,43 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/inconshreveable/log15"
 )
 
-// Off Sunday 09/11 2022 No DST
-// Or Sunday 11/20 2022 DST
-var primeDateFmt = "Mon 01/02 2006 MST"
+// The default anchor is Sunday 09/11 2022
+var anchorFmt = "Mon 01/02 2006"
+var anchorDateFmt = "01/02/2006"
 var specificDateTimeFmt = "Mon 15:04 01/02/2006 MST"
 var taskDateFmt = "15:04 01/02/2006 MST"
 var updateLineFmt = "15:04 01/02/2006 MST"
 
 // function used to set the global variable PrimeSunday, which is one of two literature values used to define
-// which sundays are prime (as opposed to being second sundays)
-func getPrimeSunday(timezone string) time.Time {
+// which sundays are prime (as opposed to being second sundays). The prime Sunday is the anchor of the rotation cycle,
+// at midnight on the clock of the given zone.
+func getPrimeSunday(loc *time.Location) time.Time {
 	logger := log15.New("function", "getPrimeSunday")
-	primeSunday, err := time.Parse(primeDateFmt, "Sun 09/11 2022 "+timezone)
+	anchor, err := time.Parse(anchorFmt, cycle.Anchor)
 	if err != nil {
-		logger.Error("Unable to parse Prime Sunday No DST String", "err", err.Error())
+		logger.Error("Unable to parse Prime Sunday", "err", err.Error())
 	}
-	return primeSunday
+	return time.Date(anchor.Year(), anchor.Month(), anchor.Day(), 0, 0, 0, 0, loc)
 }
 
 // function used to calculate the First Sunday corresponding to a given time.Time
 func getZeroSunday(now time.Time) time.Time {
-	zone, _ := now.Zone()
-	zeroSunday := getPrimeSunday(zone)
+	zeroSunday := getPrimeSunday(now.Location())
+	for zeroSunday.After(now) { // the anchor can be after now
+		zeroSunday = zeroSunday.AddDate(0, 0, -7*cycle.Weeks)
+	}
 	for {
-		nextZero := zeroSunday.Add(fullTwoWeeks * time.Hour)
+		nextZero := zeroSunday.AddDate(0, 0, 7*cycle.Weeks)
 		if nextZero.After(now) {
 			break
 		}
@@ -44,40 +50,226 @@ func getZeroSunday(now time.Time) time.Time {
 // an HourBlock is a simplified representation of an our of a day of a week.
 // 0 is  midnight thru one AM on the morning of First Sunday
 // 24 is 11 PM thru midnight on First Sunday
-// 336 is 11 PM thru midnight on the Second Saturday...and so on
+// 336 is 11 PM thru midnight on the Second Saturday...and so on, up to the length of the cycle
 // type hourBlock int
 
+// A rotation picks weeks of the cycle: first, second, "week 3", "weeks 1,3", "weeks 2-4", or all of them with
+// "all" (or "both", from when every cycle was two weeks)
 type rotation string
 
 const (
 	firstWeek  = rotation("first")
 	secondWeek = rotation("second")
 	bothWeeks  = rotation("both")
+	allWeeks   = rotation("all")
 
-	fullTwoWeeks = 336
+	weekHours = 168
 )
 
+// rotationCycle is how many weeks go by before the rotation starts over, counted from the Sunday of the anchor date
+type rotationCycle struct {
+	Weeks  int
+	Anchor string
+}
+
+// weekListMatcher matches the week numbers after "week" or "weeks" in a rotation, e.g. "1,3" or "2-4"
+var weekListMatcher = regexp.MustCompile(`^[\d,\-]+$`)
+
+// cycle is the rotation everything runs on. Two weeks from Sunday 09/11/2022 unless configured otherwise with
+// PERSPECTIVE_CYCLE_WEEKS and PERSPECTIVE_CYCLE_ANCHOR (a date like 01/02/2006).
+var cycle = defaultCycle()
+
+func defaultCycle() rotationCycle {
+	return rotationCycle{Weeks: 2, Anchor: "Sun 09/11 2022"}
+}
+
+// configureCycle reads the rotation cycle from the environment, keeping the default for anything that's off
+func configureCycle(logger log15.Logger) {
+	cycle = defaultCycle()
+	if weeks := os.Getenv("PERSPECTIVE_CYCLE_WEEKS"); weeks != "" {
+		number, err := strconv.Atoi(weeks)
+		if err != nil || number < 1 {
+			logger.Error("Cycle length has to be a whole number of weeks, keeping two", "PERSPECTIVE_CYCLE_WEEKS", weeks)
+		} else {
+			cycle.Weeks = number
+		}
+	}
+	if anchor := os.Getenv("PERSPECTIVE_CYCLE_ANCHOR"); anchor != "" {
+		anchorDate, err := time.Parse(anchorDateFmt, strings.TrimSpace(anchor))
+		if err != nil {
+			logger.Error("Unable to parse cycle anchor, keeping the default", "PERSPECTIVE_CYCLE_ANCHOR", anchor, "err", err.Error())
+			return
+		}
+		if anchorDate.Weekday() != time.Sunday {
+			anchorDate = anchorDate.AddDate(0, 0, -int(anchorDate.Weekday()))
+			logger.Info("Cycle anchor isn't a Sunday, starting the cycle on the Sunday before", "anchor", anchorDate.Format(anchorDateFmt))
+		}
+		cycle.Anchor = anchorDate.Format(anchorFmt)
+	}
+}
+
+// cycleHours is the number of hour blocks in a full cycle
+func cycleHours() int {
+	return cycle.Weeks * weekHours
+}
+
+// weeks lists the weeks of the cycle a rotation covers, counted from 0
+func (r rotation) weeks() ([]int, error) {
+	value := strings.ToLower(strings.TrimSpace(string(r)))
+	switch value {
+	case string(allWeeks), string(bothWeeks):
+		weeks := []int{}
+		for week := 0; week < cycle.Weeks; week++ {
+			weeks = append(weeks, week)
+		}
+		return weeks, nil
+	case string(firstWeek):
+		value = "week 1"
+	case string(secondWeek):
+		value = "week 2"
+	}
+	var list string
+	switch {
+	case strings.HasPrefix(value, "weeks "):
+		list = strings.TrimPrefix(value, "weeks ")
+	case strings.HasPrefix(value, "week "):
+		list = strings.TrimPrefix(value, "week ")
+	default:
+		return nil, fmt.Errorf("Rotation '%s' isn't first, second, all, or a list of weeks like 'weeks 1,3'", r)
+	}
+	picked := map[int]bool{}
+	for _, phrase := range strings.Split(list, ",") {
+		bounds := strings.Split(strings.TrimSpace(phrase), "-")
+		if len(bounds) > 2 {
+			return nil, fmt.Errorf("Unable to parse '%s' in rotation '%s' as a week or range of weeks", phrase, r)
+		}
+		numbers := []int{}
+		for _, bound := range bounds {
+			number, err := strconv.Atoi(strings.TrimSpace(bound))
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse '%s' in rotation '%s' as a week number", bound, r)
+			}
+			if number < 1 || number > cycle.Weeks {
+				return nil, fmt.Errorf("Week %d in rotation '%s' is outside the %d week cycle", number, r, cycle.Weeks)
+			}
+			numbers = append(numbers, number)
+		}
+		for week := numbers[0]; week <= numbers[len(numbers)-1]; week++ {
+			picked[week-1] = true
+		}
+	}
+	weeks := []int{}
+	for week := 0; week < cycle.Weeks; week++ {
+		if picked[week] {
+			weeks = append(weeks, week)
+		}
+	}
+	return weeks, nil
+}
+
+// weekRotation names the rotation for a single week of the cycle, counted from 0
+func weekRotation(week int) rotation {
+	switch week {
+	case 0:
+		return firstWeek
+	case 1:
+		return secondWeek
+	default:
+		return rotation(fmt.Sprintf("week %d", week+1))
+	}
+}
+
+// everyWeek names the rotation covering the whole cycle the way it reads best for the cycle length
+func everyWeek() rotation {
+	if cycle.Weeks == 2 {
+		return bothWeeks
+	}
+	return allWeeks
+}
+
+// modCycle wraps an hour block into the cycle, even when it's negative
+func modCycle(hourBlock int) int {
+	return ((hourBlock % cycleHours()) + cycleHours()) % cycleHours()
+}
+
+// modCycleMinutes is modCycle for minutes
+func modCycleMinutes(minute int) int {
+	return ((minute % cycleMinutes()) + cycleMinutes()) % cycleMinutes()
+}
+
 // function that takes a time and spits out the number of the upcoming hour block
 func nextHourBlock(now time.Time, logger log15.Logger) int {
-	zone, _ := now.Zone()
 	logger.Debug("The 'now' time is", "time", now.Format(specificDateTimeFmt), "rawTime.Time", now)
-	nowHour := now.Add(30 * time.Minute).Round(time.Hour) // round up to the next hour
-	primeDiff := nowHour.Sub(getPrimeSunday(zone))        // should be a whole number of hours
-	primeDiffHours := int(primeDiff / time.Hour)
+	return modCycle(absoluteHourBlock(now))
+}
+
+// absoluteHourBlock is the upcoming hour block counted from the prime Sunday without wrapping around the rotation,
+// for things that happen on a specific date rather than every cycle
+func absoluteHourBlock(now time.Time) int {
+	return upcomingWallHour(now) - primeWallHours()
+}
+
+// wallHours counts the hours on t's clock since 01/01/1970, so days are always 24 hours long, even the ones where
+// the clocks change
+func wallHours(t time.Time) int {
+	return floorDiv(wallMinutes(t), 60)
+}
 
-	return primeDiffHours % fullTwoWeeks
+// wallMinutes is wallHours to the minute
+func wallMinutes(t time.Time) int {
+	year, month, day := t.Date()
+	days := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
+	return int(days)*24*60 + t.Hour()*60 + t.Minute()
+}
+
+// fromWallHours is the reverse of wallHours, on the clock of the given zone
+func fromWallHours(hours int, loc *time.Location) time.Time {
+	return fromWallMinutes(hours*60, loc)
+}
+
+// fromWallMinutes is the reverse of wallMinutes, on the clock of the given zone
+func fromWallMinutes(minutes int, loc *time.Location) time.Time {
+	days := floorDiv(minutes, 24*60)
+	day := time.Unix(int64(days)*24*60*60, 0).UTC()
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, minutes-days*24*60, 0, 0, loc)
+}
+
+// upcomingWallHour is now rounded up to the next hour on the wall clock, in wallHours
+func upcomingWallHour(now time.Time) int {
+	wall := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), time.UTC)
+	return wallHours(wall.Add(30 * time.Minute).Round(time.Hour)) // round up to the next hour
+}
+
+// primeWallHours is midnight on the prime Sunday, in wallHours
+func primeWallHours() int {
+	return wallHours(getPrimeSunday(time.UTC))
+}
+
+// cycleMinutes is the length of the cycle in minutes
+func cycleMinutes() int {
+	return cycleHours() * 60
+}
+
+// floorDiv divides, rounding down even when a is negative
+func floorDiv(a, b int) int {
+	quotient := a / b
+	if a%b < 0 {
+		quotient--
+	}
+	return quotient
 }
 
 // function that takes a time and generates a string representation of what day and rotation
 // that time corresponds to.
 func whatDayIsIt(now time.Time, logger log15.Logger) string {
 	hourBlock := nextHourBlock(now, logger)
-	rotation := "first"
-	weekday := ""
-	if hourBlock >= 168 {
-		rotation = "second"
-		hourBlock -= 168
+	week := hourBlock / weekHours
+	hourBlock -= week * weekHours
+	rotation := string(weekRotation(week))
+	if week >= 2 {
+		rotation = strings.Replace(rotation, " ", "-", 1) // keep it one word
 	}
+	weekday := ""
 	switch {
 	case hourBlock >= 144:
 		weekday = "Saturday"
@@ -163,16 +355,13 @@ func getWeekday(input string) (time.Weekday, error) {
 }
 func generateBlockedHours(days []time.Weekday, rotation rotation, startTime, duration int) []int {
 	hourBlocks := []int{}
+	weeks, _ := rotation.weeks() // a bad rotation doesn't block anything, validation catches it
 	for _, day := range days {
-		firstWeekDayStartHour := 24 * int(day)
-		secondWeekDayStartHour := firstWeekDayStartHour + (24 * 7)
 		block := startTime
-		for blockOffset := 0; blockOffset < duration; blockOffset++ {
-			if rotation == firstWeek || rotation == bothWeeks {
-				hourBlocks = append(hourBlocks, (block + blockOffset + firstWeekDayStartHour))
-			}
-			if rotation == secondWeek || rotation == bothWeeks {
-				hourBlocks = append(hourBlocks, (block + blockOffset + secondWeekDayStartHour))
+		for _, week := range weeks {
+			weekDayStartHour := 24*int(day) + week*weekHours
+			for blockOffset := 0; blockOffset < duration; blockOffset++ {
+				hourBlocks = append(hourBlocks, modCycle(block+blockOffset+weekDayStartHour))
 			}
 		}
 	}
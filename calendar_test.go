@@ -1,6 +1,11 @@
 package main
 
-import "time"
+import (
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
 
 // import ("testing")
 
@@ -18,3 +23,120 @@ func generateTestingTimes() map[string]time.Time {
 // check that nextHourBlock correctly rounds Now and generates the correct hourBlock value
 
 // check parseDayStrings
+
+// useCycle switches the rotation cycle for the rest of a test
+func useCycle(t *testing.T, weeks int, anchor string) {
+	previous := cycle
+	cycle = rotationCycle{Weeks: weeks, Anchor: anchor}
+	t.Cleanup(func() { cycle = previous })
+}
+
+// check that the hour blocks and day names follow cycles other than two weeks, including anchors after now
+func TestLongerCycles(t *testing.T) {
+	tLogger := log15.New()
+	times := generateTestingTimes()
+	testCases := []struct {
+		weeks     int
+		anchor    string
+		time      string
+		hourBlock int
+		day       string
+		zero      string
+	}{
+		{2, "Sun 09/11 2022", "early", 9, "first Sunday", "11/20/2022"},
+		{3, "Sun 09/11 2022", "early", 177, "second Sunday", "11/13/2022"},
+		{3, "Sun 09/11 2022", "mid", 335, "second Saturday", "11/13/2022"},
+		{3, "Sun 09/11 2022", "late", 470, "week-3 Friday", "11/13/2022"},
+		{4, "Sun 11/20 2022", "late", 302, "second Friday", "11/20/2022"},
+		{4, "Sun 11/27 2022", "early", 513, "week-4 Sunday", "10/30/2022"},
+		{1, "Sun 09/11 2022", "late", 134, "first Friday", "11/27/2022"},
+	}
+	for _, testCase := range testCases {
+		useCycle(t, testCase.weeks, testCase.anchor)
+		now := times[testCase.time]
+		if hourBlock := nextHourBlock(now, tLogger); hourBlock != testCase.hourBlock {
+			t.Errorf("%d week cycle from %s: expected %s to be hour block %d, got %d", testCase.weeks, testCase.anchor, testCase.time, testCase.hourBlock, hourBlock)
+		}
+		if day := whatDayIsIt(now, tLogger); day != testCase.day {
+			t.Errorf("%d week cycle from %s: expected %s to be %s, got %s", testCase.weeks, testCase.anchor, testCase.time, testCase.day, day)
+		}
+		if zero := getZeroSunday(now).Format(anchorDateFmt); zero != testCase.zero {
+			t.Errorf("%d week cycle from %s: expected %s to be in the cycle from %s, got %s", testCase.weeks, testCase.anchor, testCase.time, testCase.zero, zero)
+		}
+	}
+}
+
+// check the ways of writing a rotation
+func TestRotationWeeks(t *testing.T) {
+	useCycle(t, 4, "Sun 09/11 2022")
+	testCases := []struct {
+		rotation rotation
+		weeks    []int
+		isError  bool
+	}{
+		{firstWeek, []int{0}, false},
+		{secondWeek, []int{1}, false},
+		{bothWeeks, []int{0, 1, 2, 3}, false},
+		{allWeeks, []int{0, 1, 2, 3}, false},
+		{"week 3", []int{2}, false},
+		{"weeks 1,3", []int{0, 2}, false},
+		{"Weeks 4, 2-3", []int{1, 2, 3}, false},
+		{"week 5", nil, true},
+		{"third", nil, true},
+		{"weeks 1,x", nil, true},
+	}
+	for _, testCase := range testCases {
+		weeks, err := testCase.rotation.weeks()
+		if (err != nil) != testCase.isError {
+			t.Errorf("Rotation '%s': expected error %v, got %v", testCase.rotation, testCase.isError, err)
+			continue
+		}
+		if len(weeks) != len(testCase.weeks) {
+			t.Errorf("Rotation '%s': expected weeks %v, got %v", testCase.rotation, testCase.weeks, weeks)
+			continue
+		}
+		for index, week := range weeks {
+			if week != testCase.weeks[index] {
+				t.Errorf("Rotation '%s': expected weeks %v, got %v", testCase.rotation, testCase.weeks, weeks)
+				break
+			}
+		}
+	}
+	blocked := generateBlockedHours([]time.Weekday{time.Monday}, "weeks 1,3", 9, 2)
+	expected := []int{33, 34, 369, 370}
+	if len(blocked) != len(expected) {
+		t.Errorf("Expected blocked hours %v, got %v", expected, blocked)
+		t.FailNow()
+	}
+	for index, hour := range blocked {
+		if hour != expected[index] {
+			t.Errorf("Expected blocked hours %v, got %v", expected, blocked)
+			break
+		}
+	}
+}
+
+// check that repeating deadlines land in the right week of a longer cycle
+func TestLongerCycleDeadlines(t *testing.T) {
+	tLogger := log15.New()
+	useCycle(t, 3, "Sun 09/11 2022")
+	early := generateTestingTimes()["early"] // second Sunday
+	task := &Task{Name: "On call handoff notes", Deadline: "18:00 weeks 1, 3 Mon, Thu", EstimatedHours: 1}
+	hour, weekRotation, days, err := task.parseRepeatingDays(tLogger)
+	if err != nil || hour != 18 || weekRotation != "weeks 1, 3" || !compareWeekdayArr(days, []time.Weekday{time.Monday, time.Thursday}) {
+		t.Errorf("Unexpected parse of '%s': %d %s %v %v", task.Deadline, hour, weekRotation, days, err)
+	}
+	hoursLeft, err := task.getHoursLeft(early, []int{}, tLogger)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+		t.FailNow()
+	}
+	// week 3 Monday at 18:00 is hour block 378, and we're at 177
+	if hoursLeft != 201 || !task.DeadlineTime.Equal(early.Add(201*time.Hour+time.Hour)) {
+		t.Errorf("Expected 201 hours left until %s, got %d until %s", early.Add(202*time.Hour), hoursLeft, task.DeadlineTime)
+	}
+	rotationless := &Task{Name: "Bad", Deadline: "18:00 week 4 Mon"}
+	if _, err := rotationless.getHoursLeft(early, []int{}, tLogger); err == nil {
+		t.Errorf("Expected an error for a week outside the cycle")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/inconshreveable/log15"
+)
+
+// runCommand handles the one-shot commands; with no command at all Perspective runs as a daemon instead.
+//
+//	perspective export [-format markdown|todotxt|taskwarrior|csv|json|ics] [-input file] [-output file]
+//	perspective import [-format todotxt|taskwarrior|csv] [-output file] <file>
+//	perspective check [-input file]
+func runCommand(args []string, logger log15.Logger) error {
+	// keep stdout clean for whatever the command prints
+	logger.SetHandler(log15.LvlFilterHandler(log15.LvlWarn, log15.StderrHandler))
+	switch args[0] {
+	case "export":
+		return exportCommand(args[1:], logger)
+	case "import":
+		return importCommand(args[1:], logger)
+	case "check":
+		return checkCommand(args[1:], logger)
+	default:
+		return fmt.Errorf("Unknown command '%s'; try export, import or check", args[0])
+	}
+}
+
+// exportCommand ranks the task list and writes it out in another format
+func exportCommand(args []string, logger log15.Logger) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", markdownFormat, "format to write: markdown, todotxt, taskwarrior, csv, json or ics")
+	input := flags.String("input", "", "file to read tasks from instead of the configured storage")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	store := getStorage(logger)
+	if *input != "" {
+		store = storageForPath(*input)
+	}
+	events, tasks, err := store.read(logger)
+	if err != nil {
+		return err
+	}
+	now := currentTime()
+	sortTasks(tasks, now, withBusyCalendars(events, now, logger), logger)
+	outStr := ""
+	switch *format {
+	case markdownFormat:
+		diags := diagnostics{}
+		if markdownStore, ok := store.(*markdownStorage); ok {
+			diags = markdownStore.diagnostics
+		}
+		outStr = outputMarkdown(events, tasks, diags, logger)
+	case todoTxtFormat:
+		unranked := []string{}
+		if todoStore, ok := store.(*todoTxtStorage); ok {
+			unranked = todoStore.unranked
+		}
+		outStr = outputTodoTxt(tasks, unranked, logger)
+	case taskwarriorFormat:
+		outStr, err = outputTaskwarrior(tasks)
+		if err != nil {
+			return err
+		}
+	case csvFormat:
+		outStr, err = outputCSV(events, tasks)
+		if err != nil {
+			return err
+		}
+	case jsonFormat:
+		outStr, err = outputJSON(now, events, tasks, logger)
+		if err != nil {
+			return err
+		}
+	case icsFormat:
+		outStr = outputICS(now, events, tasks, logger)
+	default:
+		return fmt.Errorf("Unknown export format '%s'", *format)
+	}
+	return writeOutput(*output, outStr)
+}
+
+// importCommand reads tasks from another format and prints them as To Do List sections, ready to paste in
+func importCommand(args []string, logger log15.Logger) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", todoTxtFormat, "format to read: todotxt, taskwarrior or csv")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import needs exactly one file to read")
+	}
+	path := flags.Arg(0)
+	tasks := []*Task{}
+	switch *format {
+	case todoTxtFormat:
+		var unranked []string
+		tasks, unranked = todoTxtToTasks(readLines(path, logger), logger)
+		for _, line := range unranked {
+			logger.Warn("Skipping todo.txt line without a due date", "line", line)
+		}
+	case taskwarriorFormat:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		tasks, err = taskwarriorToTasks(data, logger)
+		if err != nil {
+			return err
+		}
+	case csvFormat:
+		// spreadsheet rows already say which section they belong in, so there's nothing to rank
+		readFile, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer readFile.Close()
+		events, sections, err := csvToStructs(readFile)
+		if err != nil {
+			return err
+		}
+		return writeOutput(*output, outputImportedSections(events, sections))
+	default:
+		return fmt.Errorf("Unknown import format '%s'", *format)
+	}
+	// the sections tasks land in depend on their urgency, so rank them against our events if we have any
+	events, _, _, err := readFromFile(logger)
+	if err != nil {
+		logger.Warn("Unable to read events from the To Do List, ranking without them", "err", err.Error())
+		events = []*GeneralEvent{}
+	}
+	sortTasks(tasks, currentTime(), events, logger)
+	return writeOutput(*output, outputTasks(tasks))
+}
+
+// checkCommand lists everything in the To Do List that can't be understood, including the tasks and events that
+// would end up in Invalid Items and the events that overlap, and fails if any of it is an error
+func checkCommand(args []string, logger log15.Logger) error {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	input := flags.String("input", "", "To Do List to check instead of the one in the notes directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	path := *input
+	if path == "" {
+		path = notesDir(logger) + "/" + tasksFile
+	}
+	events, tasks, diags, err := readMarkdownFile(path, logger)
+	if err != nil {
+		return err
+	}
+	now := currentTime()
+	sortTasks(tasks, now, events, logger)
+	diags = append(diags, rankingDiagnostics(events, tasks)...)
+	diags = append(diags, overlapDiagnostics(now, events, logger)...)
+	for _, diag := range diags {
+		fmt.Println(diag.String())
+	}
+	if count := diags.errors(); count != 0 {
+		return fmt.Errorf("Found %d errors in %s", count, path)
+	}
+	return nil
+}
+
+func writeOutput(path, outStr string) error {
+	if path == "" {
+		_, err := fmt.Fprint(os.Stdout, outStr)
+		return err
+	}
+	return os.WriteFile(path, []byte(outStr), 0644)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Task and event rows share one CSV so a whole plan fits in a single spreadsheet. Kind says which columns apply;
+// the computed columns (Urgency, RemainingHours, BusyHours) are written out but ignored on the way back in. Hours
+// that aren't whole are written as decimals and StartTime can be a time like 18:30. Dated events leave Rotation and
+// Days empty, and whole-day ones StartTime and Duration too. Rows in the Invalid Items section come back in as
+// invalid items, mistakes and all, so an exported plan can always be imported again.
+const (
+	csvFormat = "csv"
+
+	csvTaskKind  = "task"
+	csvEventKind = "event"
+)
+
+var csvHeader = []string{
+	"Kind", "Section", "Name",
+	"Deadline", "EstimatedHours", "Urgency", "RemainingHours", "BusyHours",
+	"Rotation", "Days", "StartTime", "Duration", "Inactive",
+	"Date", "ActiveFrom", "ActiveUntil", "Schedule", "Except", "Zone",
+}
+
+// outputCSV writes ranked tasks in their sorted order followed by the events. Urgency is a percentage, like in the
+// To Do List.
+func outputCSV(events []*GeneralEvent, tasks []*Task) (string, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	rows := [][]string{csvHeader}
+	for _, task := range tasks {
+		rows = append(rows, []string{
+			csvTaskKind, task.section(), task.Name,
+			task.Deadline,
+			formatHours(task.estimateMinutes()),
+			fmt.Sprintf("%.2f", task.Urgency*100),
+			formatHours(task.FreeMinutes),
+			formatHours(task.BusyMinutes),
+			"", "", "", "", "",
+			"", "", "", "", "", "",
+		})
+	}
+	for _, event := range events {
+		startTime, duration := formatClock(event.StartTime, event.StartMinute), formatHours(event.lengthMinutes())
+		if event.Date != "" && event.lengthMinutes() == 0 {
+			duration = ""
+			if !event.hasStart {
+				startTime = ""
+			}
+		}
+		rows = append(rows, []string{
+			csvEventKind, event.section(), event.Name,
+			"", "", "", "", "",
+			string(event.Rotation),
+			event.Days,
+			startTime,
+			duration,
+			strconv.FormatBool(event.Inactive),
+			event.Date, event.ActiveFrom, event.ActiveUntil, event.Schedule, event.Except, event.Zone,
+		})
+	}
+	err := w.WriteAll(rows)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// csvToStructs reads rows back into tasks and events. Every bad row is reported, not just the first one, so a
+// spreadsheet can be fixed in one go. Tasks remember the section they were listed under.
+func csvToStructs(r io.Reader) ([]*GeneralEvent, map[string][]*Task, error) {
+	events := []*GeneralEvent{}
+	tasks := map[string][]*Task{}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return events, tasks, fmt.Errorf("Unable to read CSV: %s", err.Error())
+	}
+	if len(records) == 0 {
+		return events, tasks, errors.New("CSV is empty")
+	}
+	columns := map[string]int{}
+	for index, column := range records[0] {
+		columns[strings.TrimSpace(column)] = index
+	}
+	for _, required := range []string{"Kind", "Name"} {
+		if _, ok := columns[required]; !ok {
+			return events, tasks, fmt.Errorf("CSV header is missing the %s column", required)
+		}
+	}
+	rowErrors := []string{}
+	for index, record := range records[1:] {
+		row := csvRow{record: record, columns: columns}
+		// header is row 1, like in a spreadsheet
+		rowNum := index + 2
+		switch strings.ToLower(row.get("Kind")) {
+		case csvTaskKind:
+			task, section, err := row.toTask()
+			if err != nil {
+				rowErrors = append(rowErrors, fmt.Sprintf("row %d: %s", rowNum, err.Error()))
+				continue
+			}
+			tasks[section] = append(tasks[section], task)
+		case csvEventKind:
+			event, err := row.toEvent()
+			if err != nil {
+				rowErrors = append(rowErrors, fmt.Sprintf("row %d: %s", rowNum, err.Error()))
+				continue
+			}
+			events = append(events, event)
+		case "":
+			if strings.Join(record, "") != "" {
+				rowErrors = append(rowErrors, fmt.Sprintf("row %d: Kind is empty; expected task or event", rowNum))
+			}
+		default:
+			rowErrors = append(rowErrors, fmt.Sprintf("row %d: Kind '%s' isn't task or event", rowNum, row.get("Kind")))
+		}
+	}
+	if len(rowErrors) != 0 {
+		return events, tasks, errors.New(strings.Join(rowErrors, "\n"))
+	}
+	return events, tasks, nil
+}
+
+type csvRow struct {
+	record  []string
+	columns map[string]int
+}
+
+func (row csvRow) get(column string) string {
+	index, ok := row.columns[column]
+	if !ok || index >= len(row.record) {
+		return ""
+	}
+	return strings.TrimSpace(row.record[index])
+}
+
+func (row csvRow) toTask() (*Task, string, error) {
+	task := &Task{
+		Name:     row.get("Name"),
+		Deadline: row.get("Deadline"),
+	}
+	minutes, err := parseDuration(row.get("EstimatedHours"))
+	if err != nil || minutes < 0 {
+		return nil, "", fmt.Errorf("EstimatedHours '%s' of task '%s' isn't a number of hours", row.get("EstimatedHours"), task.Name)
+	}
+	task.setEstimate(minutes)
+	section := row.get("Section")
+	switch section {
+	case overdueTasks, upcomingTasks, completedTasks, invalidItems:
+	case "":
+		section = upcomingTasks
+	default:
+		return nil, "", fmt.Errorf("Section '%s' of task '%s' isn't %s, %s, %s or %s", section, task.Name, overdueTasks, upcomingTasks,
+			completedTasks, invalidItems)
+	}
+	task.buildRaw()
+	err = task.validate()
+	// deadlines in words are fine, they're written out once the To Do List is read (see naturalDeadlines.go)
+	if _, deadlineErr := classifyDeadline(task.Deadline); err == nil && deadlineErr != nil {
+		if _, naturalErr := parseNaturalDeadline(task.Deadline, currentTime()); naturalErr != nil {
+			err = fmt.Errorf("Deadline of task '%s': %s", task.Name, deadlineErr.Error())
+		}
+	}
+	if section != invalidItems {
+		return task, section, err
+	}
+	// an invalid task that's since become valid gets ranked again on the next refresh
+	task.invalid = err
+	if err == nil {
+		section = upcomingTasks
+	}
+	return task, section, nil
+}
+
+func (row csvRow) toEvent() (*GeneralEvent, error) {
+	event := &GeneralEvent{
+		Name:        row.get("Name"),
+		Rotation:    rotation(strings.ToLower(row.get("Rotation"))),
+		Days:        row.get("Days"),
+		Date:        row.get("Date"),
+		ActiveFrom:  row.get("ActiveFrom"),
+		ActiveUntil: row.get("ActiveUntil"),
+		Schedule:    row.get("Schedule"),
+		Except:      row.get("Except"),
+		Zone:        row.get("Zone"),
+	}
+	var start, duration int
+	var ranged bool
+	var err error
+	// whole-day dated events don't have a start time
+	if event.Date == "" || row.get("StartTime") != "" {
+		start, duration, ranged, err = parseClockRange(row.get("StartTime"))
+		if err != nil {
+			return nil, fmt.Errorf("StartTime '%s' of event '%s' isn't an hour between 0 and 23, a time like 18:30 or a range like 22:00-06:00", row.get("StartTime"), event.Name)
+		}
+	}
+	event.StartTime, event.StartMinute = start/60, start%60
+	event.hasStart = row.get("StartTime") != ""
+	if (!ranged && event.Date == "") || row.get("Duration") != "" {
+		duration, err = parseDuration(row.get("Duration"))
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("Duration '%s' of event '%s' isn't a number of hours", row.get("Duration"), event.Name)
+		}
+	}
+	event.Duration, event.DurationMinutes = duration/60, duration%60
+	if inactive := row.get("Inactive"); inactive != "" {
+		event.Inactive, err = strconv.ParseBool(inactive)
+		if err != nil {
+			return nil, fmt.Errorf("Inactive '%s' of event '%s' isn't true or false", inactive, event.Name)
+		}
+	} else if row.get("Section") == inactiveEvents {
+		// exported events say, but events outside their active dates are listed as inactive too
+		event.Inactive = true
+	}
+	event.buildRaw()
+	err = event.validate()
+	if err == nil && !event.isDated() {
+		if _, daysErr := parseDayStrings(event.Days); daysErr != nil {
+			err = fmt.Errorf("Days of event '%s': %s", event.Name, daysErr.Error())
+		}
+	}
+	if row.get("Section") != invalidItems {
+		return event, err
+	}
+	event.invalid = err
+	return event, nil
+}
+
+// outputImportedSections lays out imported tasks under the sections they were listed in, followed by the events
+func outputImportedSections(events []*GeneralEvent, tasks map[string][]*Task) string {
+	outStr := outputInvalid(events, tasks[invalidItems])
+	for _, section := range []string{overdueTasks, upcomingTasks, completedTasks} {
+		if len(tasks[section]) == 0 {
+			continue
+		}
+		outStr += fmt.Sprintf(headerLineFmt, section)
+		for _, task := range tasks[section] {
+			outStr += task.Raw
+		}
+	}
+	outStr = strings.Replace(outStr, "\n\n", "\n", -1)
+	return outStr + outputEvents(events)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that exported rows come back in as the same tasks and events, under the same sections
+func TestCSVRoundTrip(t *testing.T) {
+	tLogger := log15.New()
+	report1, report2, syllabus := createThreeTasks()
+	tasks := []*Task{report1, report2, syllabus}
+	for _, task := range tasks {
+		task.buildRaw()
+	}
+	events := []*GeneralEvent{
+		{Name: "sleeping", Rotation: bothWeeks, Days: "Sun-Sat", StartTime: 23, Duration: 8},
+		{Name: "conjugate", Rotation: firstWeek, Days: "Tue, Thur", StartTime: 16, Duration: 2, Inactive: true},
+	}
+	sortTasks(tasks, generateTestingTimes()["mid"], events, tLogger)
+	outStr, err := outputCSV(events, tasks)
+	if err != nil {
+		t.Errorf("Unexpected error writing CSV: %s", err.Error())
+		t.FailNow()
+	}
+	readEvents, sections, err := csvToStructs(strings.NewReader(outStr))
+	if err != nil {
+		t.Errorf("Unexpected error reading CSV back: %s", err.Error())
+		t.FailNow()
+	}
+	if len(sections[upcomingTasks]) != 2 || len(sections[overdueTasks]) != 1 || sections[overdueTasks][0].Name != syllabus.Name {
+		t.Errorf("Tasks came back under the wrong sections: %v", sections)
+	}
+	if len(readEvents) != 2 || readEvents[0].StartTime != 23 || readEvents[0].Duration != 8 || !readEvents[1].Inactive {
+		t.Errorf("Events didn't come back the same: %v", readEvents)
+	}
+	expected := "\n- Overdue Tasks\n" +
+		"\t- Read the syllabus and get it signed\n" +
+		"\t\t- Deadline; 16:00 09/28/2022 EST\n" +
+		"\t\t- Estimated Hours; 1"
+	if !strings.HasPrefix(outputImportedSections(readEvents, sections), expected) {
+		t.Errorf("Imported markdown didn't match;\nExpected to start with:\n%s\nActual:\n%s", expected, outputImportedSections(readEvents, sections))
+	}
+}
+
+// check that every bad row is reported with its row number
+func TestCSVRowErrors(t *testing.T) {
+	input := strings.Join([]string{
+		strings.Join(csvHeader, ","),
+		"task,Upcoming Tasks,Report,16:00 11/28/2022 EST,three,,,,,,,,",
+		"event,,Sleep,,,,,,both,Sun-Sat,23,8,",
+		"event,,Gym,,,,,,third,Mon,18,1,",
+		"chore,,Dishes,,,,,,,,,,",
+		"task,Upcoming Tasks,Taxes,16:00 04/31/2023,2,,,,,,,,",
+		"task,Upcoming Tasks,Book club,18:00 frist Tuesday,1,,,,,,,,",
+		"task,Upcoming Tasks,Call mom,tomorrow 5pm,1,,,,,,,,",
+		"task,Upcoming Tasks,Chores,15:00 last Friday of month,1,,,,,,,,",
+	}, "\n")
+	_, _, err := csvToStructs(strings.NewReader(input))
+	if err == nil {
+		t.Errorf("Expected row errors but got none")
+		t.FailNow()
+	}
+	for _, expected := range []string{
+		"row 2: EstimatedHours 'three'", "row 4: Rotation 'third'", "row 5: Kind 'chore'",
+		"row 6: Deadline of task 'Taxes': Unable to parse '04/31/2023'", "row 7: Deadline of task 'Book club': Unable to parse 'frist'",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %q;\nActual: %s", expected, err.Error())
+		}
+	}
+	for _, valid := range []string{"row 3", "row 8", "row 9"} {
+		if strings.Contains(err.Error(), valid) {
+			t.Errorf("%s is valid but was reported: %s", valid, err.Error())
+		}
+	}
+}
+
+// check that a plan with invalid items and events on dates, zones and schedules comes back in as the same plan
+func TestCSVRoundTripEverything(t *testing.T) {
+	tLogger := log15.New()
+	useSchedules(t, "Fall semester=08/29/2022, Winter break=12/17/2022")
+	report1, _, _ := createThreeTasks()
+	taxes := &Task{Name: "Taxes", Deadline: "16:00 04/31/2023", EstimatedHours: 2}
+	tasks := []*Task{report1, taxes}
+	for _, task := range tasks {
+		task.buildRaw()
+	}
+	events := []*GeneralEvent{
+		{Name: "Dentist", Date: "12/05/2022", StartTime: 9, StartMinute: 30, Duration: 1},
+		{Name: "Vacation", Date: "12/20/2022 - 01/02/2023"},
+		{Name: "Conference", Date: "09/01/2022", StartTime: 9, Duration: 8},
+		{Name: "Checkup", Date: "12/06/2022", StartTime: 14, hasStart: true}, // invalid without a duration
+		{Name: "Standup", Rotation: bothWeeks, Days: "Mon-Fri", StartTime: 9, Duration: 0, DurationMinutes: 15, Zone: "Europe/London",
+			ActiveFrom: "11/14/2022", ActiveUntil: "12/16/2022", Except: "11/28/2022"},
+		{Name: "Fall class", Rotation: firstWeek, Days: "Mon", StartTime: 10, Duration: 1, Schedule: "Fall semester"},
+		{Name: "Gym", Rotation: "third", Days: "Mon", StartTime: 18, Duration: 1},
+	}
+	for _, event := range events {
+		event.buildRaw()
+	}
+	sortTasks(tasks, generateTestingTimes()["mid"], events, tLogger)
+	outStr, err := outputCSV(events, tasks)
+	if err != nil {
+		t.Errorf("Unexpected error writing CSV: %s", err.Error())
+		t.FailNow()
+	}
+	readEvents, sections, err := csvToStructs(strings.NewReader(outStr))
+	if err != nil {
+		t.Errorf("Unexpected error reading an exported CSV back:\n%s\n%s", err.Error(), outStr)
+		t.FailNow()
+	}
+	if len(sections[invalidItems]) != 1 || sections[invalidItems][0].Name != taxes.Name || sections[invalidItems][0].invalid == nil {
+		t.Errorf("Expected the taxes to come back as an invalid task, got %v", sections)
+	}
+	if len(readEvents) != len(events) {
+		t.Errorf("Expected %d events back, got %d", len(events), len(readEvents))
+		t.FailNow()
+	}
+	if events[3].invalid == nil || events[len(events)-1].invalid == nil || events[len(events)-2].invalid != nil {
+		t.Errorf("Expected the checkup and the gym to be invalid")
+	}
+	for index, event := range events {
+		read := readEvents[index]
+		if read.Raw != event.Raw || (read.invalid == nil) != (event.invalid == nil) {
+			t.Errorf("Event '%s' didn't come back the same;\nExpected: %q, invalid %v\nActual: %q, invalid %v", event.Name, event.Raw, event.invalid, read.Raw, read.invalid)
+		}
+	}
+	// and the imported sections read back as the same items in the To Do List
+	mdEvents, mdTasks := mdToStructs(strings.Split(outputImportedSections(readEvents, sections), "\n"), tLogger)
+	if len(mdEvents) != len(events) || len(mdTasks) != len(tasks) {
+		t.Errorf("Imported sections didn't read back as %d events and %d tasks:\n%s", len(events), len(tasks), outputImportedSections(readEvents, sections))
+	}
+}
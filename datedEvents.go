@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// One-off events block real calendar dates instead of repeating on the rotation, like a conference or a vacation:
+//
+//	- Conference
+//		- Date; 11/14/2022
+//		- Start Time; 09:00-17:00
+//	- Vacation
+//		- Date; 12/20/2022 - 01/02/2023
+//
+// With a start time and duration the event blocks that part of every day in the range; without either it's an
+// absence and blocks the whole days. A start time without a duration is a mistake rather than an absence. Once an event's dates are over it moves to the Past Events section.
+
+const pastEvents = "Past Events"
+
+// parseDateRange reads a single date or an inclusive range of dates, at midnight in loc
+func parseDateRange(value string, loc *time.Location) (first, last time.Time, err error) {
+	parts := strings.Split(value, " - ")
+	if len(parts) > 2 {
+		return first, last, fmt.Errorf("Unable to parse '%s' as a date or a range like 12/20/2022 - 01/02/2023", value)
+	}
+	first, err = time.ParseInLocation(anchorDateFmt, strings.TrimSpace(parts[0]), loc)
+	if err != nil {
+		return first, last, fmt.Errorf("Unable to parse '%s' as a date like %s", strings.TrimSpace(parts[0]), anchorDateFmt)
+	}
+	last = first
+	if len(parts) == 2 {
+		last, err = time.ParseInLocation(anchorDateFmt, strings.TrimSpace(parts[1]), loc)
+		if err != nil {
+			return first, last, fmt.Errorf("Unable to parse '%s' as a date like %s", strings.TrimSpace(parts[1]), anchorDateFmt)
+		}
+		if last.Before(first) {
+			return first, last, fmt.Errorf("Date range '%s' ends before it starts", value)
+		}
+	}
+	return first, last, nil
+}
+
+// periods lists the calendar time a dated event blocks, either the periods it was given or the ones its Date works
+// out to
+func (e *GeneralEvent) periods() ([]busyPeriod, error) {
+	if e.Date == "" {
+		return e.Periods, nil
+	}
+	loc := homeLocation
+	if e.Zone != "" {
+		zone, err := time.LoadLocation(e.Zone)
+		if err != nil {
+			return nil, fmt.Errorf("Event '%s' has unknown time zone '%s'", e.Name, e.Zone)
+		}
+		loc = zone
+	}
+	first, last, err := parseDateRange(e.Date, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%s, in event '%s'", err.Error(), e.Name)
+	}
+	if e.lengthMinutes() == 0 {
+		if e.hasStart {
+			return nil, fmt.Errorf("Event '%s' has a Start Time but no Duration; leave both out to block the whole days", e.Name)
+		}
+		// an absence, the whole days are blocked
+		return []busyPeriod{{Start: first, End: last.AddDate(0, 0, 1)}}, nil
+	}
+	periods := []busyPeriod{}
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		start := time.Date(day.Year(), day.Month(), day.Day(), e.StartTime, e.StartMinute, 0, 0, loc)
+		periods = append(periods, busyPeriod{Start: start, End: start.Add(time.Duration(e.lengthMinutes()) * time.Minute)})
+	}
+	return periods, nil
+}
+
+// isPast is true for a one-off event whose dates are all over
+func (e *GeneralEvent) isPast(now time.Time) bool {
+	if e.Date == "" {
+		return false
+	}
+	periods, err := e.periods()
+	if err != nil || len(periods) == 0 {
+		return false
+	}
+	for _, period := range periods {
+		if period.End.After(now) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that one-off events work out to the right stretches of calendar time
+func TestDatedEventPeriods(t *testing.T) {
+	day := func(month time.Month, date, hour int) time.Time {
+		return time.Date(2022, month, date, hour, 0, 0, 0, homeLocation)
+	}
+	tests := []struct {
+		name    string
+		event   *GeneralEvent
+		periods []busyPeriod
+		fails   bool
+	}{
+		{
+			name:    "conference",
+			event:   &GeneralEvent{Name: "Conference", Date: "11/14/2022", StartTime: 9, Duration: 8},
+			periods: []busyPeriod{{day(11, 14, 9), day(11, 14, 17)}},
+		},
+		{
+			name:  "two day workshop",
+			event: &GeneralEvent{Name: "Workshop", Date: "11/14/2022 - 11/15/2022", StartTime: 13, Duration: 2},
+			periods: []busyPeriod{
+				{day(11, 14, 13), day(11, 14, 15)},
+				{day(11, 15, 13), day(11, 15, 15)},
+			},
+		},
+		{
+			name:    "vacation",
+			event:   &GeneralEvent{Name: "Vacation", Date: "12/20/2022 - 01/02/2023"},
+			periods: []busyPeriod{{day(12, 20, 0), time.Date(2023, 1, 3, 0, 0, 0, 0, homeLocation)}},
+		},
+		{
+			name:  "backwards range",
+			event: &GeneralEvent{Name: "Vacation", Date: "01/02/2023 - 12/20/2022"},
+			fails: true,
+		},
+		{
+			name:  "not a date",
+			event: &GeneralEvent{Name: "Vacation", Date: "next week"},
+			fails: true,
+		},
+		{
+			name:  "start time without a duration",
+			event: &GeneralEvent{Name: "Dentist", Date: "11/14/2022", StartTime: 14, hasStart: true},
+			fails: true,
+		},
+	}
+	for _, test := range tests {
+		periods, err := test.event.periods()
+		if (err != nil) != test.fails || (test.event.validate() != nil) != test.fails {
+			t.Errorf("Unexpected error state for %s: %v", test.name, err)
+			t.FailNow()
+		}
+		if len(periods) != len(test.periods) {
+			t.Errorf("Periods for %s didn't match;\nExpected: %v\nActual: %v", test.name, test.periods, periods)
+			t.FailNow()
+		}
+		for index, period := range periods {
+			if !period.Start.Equal(test.periods[index].Start) || !period.End.Equal(test.periods[index].End) {
+				t.Errorf("Periods for %s didn't match;\nExpected: %v\nActual: %v", test.name, test.periods, periods)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+// check that one-off events only take free time on their own dates
+func TestDatedEventUrgency(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	tests := []struct {
+		name        string
+		event       *GeneralEvent
+		freeMinutes int
+	}{
+		{name: "nothing", event: &GeneralEvent{Name: "Later", Date: "11/30/2022", StartTime: 9, Duration: 2}, freeMinutes: 42 * 60},
+		{name: "dentist", event: &GeneralEvent{Name: "Dentist", Date: "11/28/2022", StartTime: 9, Duration: 2}, freeMinutes: 40 * 60},
+		{name: "day off", event: &GeneralEvent{Name: "Away", Date: "11/27/2022"}, freeMinutes: 18 * 60},
+		{name: "inactive", event: &GeneralEvent{Name: "Away", Date: "11/27/2022", Inactive: true}, freeMinutes: 42 * 60},
+	}
+	for _, test := range tests {
+		report := &Task{Name: "Report", Deadline: "16:00 11/28/2022 EST", EstimatedHours: 1}
+		err := report.calculateUrgency(mid, []*GeneralEvent{test.event}, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error calculating urgency for %s: %s", test.name, err.Error())
+			t.FailNow()
+		}
+		if report.FreeMinutes != test.freeMinutes {
+			t.Errorf("Free time for %s didn't match;\nExpected: %d\nActual: %d", test.name, test.freeMinutes, report.FreeMinutes)
+			t.FailNow()
+		}
+	}
+}
+
+// check that one-off events that are over move to Past Events, and get read back from there
+func TestPastEvents(t *testing.T) {
+	tLogger := log15.New()
+	lines := []string{
+		"- " + repeatingEvents,
+		"\t- Conference",
+		"\t\t- Date; 11/14/2022",
+		"\t\t- Start Time; 09:00-17:00",
+		"\t- Sleeping",
+		"\t\t- Rotation; both",
+		"\t\t- Days; Sun-Sat",
+		"\t\t- Start Time; 23",
+		"\t\t- Duration; 8",
+	}
+	events, _ := mdToStructs(lines, tLogger)
+	if len(events) != 2 || !events[0].isDated() || events[0].lengthMinutes() != 8*60 {
+		t.Errorf("Expected a dated conference and sleeping, got %v", events)
+		t.FailNow()
+	}
+	mid := generateTestingTimes()["mid"]
+	if !events[0].isPast(mid) || events[1].isPast(mid) {
+		t.Errorf("Only the conference should be over by %s", mid)
+	}
+	outStr := outputEvents(events)
+	if !strings.Contains(outStr, "\n- "+pastEvents+"\n\t- Conference\n") || strings.Index(outStr, pastEvents) < strings.Index(outStr, "Sleeping") {
+		t.Errorf("Conference should be under %s after the regular events, got:\n%s", pastEvents, outStr)
+	}
+	reread, _ := mdToStructs(strings.Split(outStr, "\n"), tLogger)
+	if len(reread) != 2 || reread[1].Name != "Conference" || reread[1].Date != "11/14/2022" {
+		t.Errorf("Past events should be read back in, got %v", reread)
+	}
+}
+
+// check that a dated event with a start time but no duration is reported instead of blocking the whole day
+func TestDatedEventMissingDuration(t *testing.T) {
+	tLogger := log15.New()
+	lines := []string{
+		"- " + repeatingEvents,
+		"\t- Dentist",
+		"\t\t- Date; 12/05/2022",
+		"\t\t- Start Time; 14",
+		"\t- Vacation",
+		"\t\t- Date; 12/20/2022 - 01/02/2023",
+	}
+	events, _ := mdToStructs(lines, tLogger)
+	report1, _, _ := createThreeTasks()
+	sortTasks([]*Task{report1}, generateTestingTimes()["mid"], events, tLogger)
+	if len(events) != 2 || events[0].invalid == nil || events[1].invalid != nil {
+		t.Errorf("Expected only the dentist to be invalid, got %v", events)
+		t.FailNow()
+	}
+	diags := rankingDiagnostics(events, nil)
+	if len(diags) != 1 || !strings.Contains(diags[0].Message, "Start Time but no Duration") {
+		t.Errorf("Expected the missing duration to be reported, got %v", diags)
+	}
+	if outStr := outputInvalid(events, nil); !strings.Contains(outStr, "\t- Dentist\n\t\t- Date; 12/05/2022\n\t\t- Start Time; 14\n") {
+		t.Errorf("Expected the dentist to keep its start time under %s, got:\n%s", invalidItems, outStr)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A deadline is dated ("16:00 11/28/2022 EST", see timezone.go), follows the calendar ("15:00 last Friday of month",
+// see deadlineRules.go) or follows the rotation ("18:00 first Monday"). classifyDeadline tells which, and when it's
+// none of them it works out which kind was meant, names the part that doesn't fit and shows what that kind looks like,
+// so a typo in a date doesn't come out as a complaint about repeating deadlines.
+
+type deadlineKind int
+
+const (
+	datedKind deadlineKind = iota
+	ruleKind
+	rotationKind
+)
+
+const (
+	datedExample    = "16:00 11/28/2022 EST"
+	ruleExample     = "15:00 last Friday of month"
+	rotationExample = "18:00 first Monday"
+	naturalExample  = "tomorrow 5pm"
+)
+
+// dateLikeMatcher spots a token that was meant to be a date, like 11/28/2022, 11-28 or 2022/11/28
+var dateLikeMatcher = regexp.MustCompile(`^\d{1,4}[/-]\d{1,2}([/-]\d{1,4})?$`)
+
+var weekdayNames = []string{
+	"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday",
+	"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat",
+}
+
+var rotationNames = []string{string(firstWeek), string(secondWeek), string(bothWeeks), string(allWeeks), "week", "weeks"}
+
+// classifyDeadline says what kind of deadline value is, or what's wrong with it, see the top of this file
+func classifyDeadline(value string) (deadlineKind, error) {
+	if _, err := parseDeadline(value); err == nil {
+		return datedKind, nil
+	}
+	if isRuleDeadline(value) {
+		if _, err := parseDeadlineRule(value, homeLocation); err != nil {
+			return ruleKind, fmt.Errorf("%s; calendar deadlines look like '%s'", err.Error(), ruleExample)
+		}
+		return ruleKind, nil
+	}
+	tokens := strings.Fields(value)
+	if len(tokens) == 0 {
+		return datedKind, fmt.Errorf("Deadline is empty; deadlines look like '%s' or '%s'", datedExample, rotationExample)
+	}
+	for _, token := range tokens {
+		if dateLikeMatcher.MatchString(token) {
+			return datedKind, diagnoseDated(tokens, value)
+		}
+	}
+	return rotationKind, diagnoseRotation(tokens, value)
+}
+
+// diagnoseDated finds what's wrong with a deadline that was meant to be dated
+func diagnoseDated(tokens []string, value string) error {
+	hint := fmt.Sprintf("dated deadlines look like '%s'", datedExample)
+	if _, _, err := parseClock(tokens[0]); err != nil {
+		return fmt.Errorf("Unable to parse '%s' in deadline '%s' as a time like 16:00; %s", tokens[0], value, hint)
+	}
+	if len(tokens) < 2 {
+		return fmt.Errorf("Deadline '%s' is missing its date; %s", value, hint)
+	}
+	if _, err := time.Parse(anchorDateFmt, tokens[1]); err != nil {
+		return fmt.Errorf("Unable to parse '%s' in deadline '%s' as a date like %s; %s", tokens[1], value, anchorDateFmt, hint)
+	}
+	if len(tokens) > 3 {
+		return fmt.Errorf("Unable to parse '%s' in deadline '%s'; only a time zone can come after the date, %s", strings.Join(tokens[3:], " "), value, hint)
+	}
+	return fmt.Errorf("Unknown time zone '%s' in deadline '%s'; use an IANA name like America/New_York or %s", tokens[2], value, homeAbbreviations())
+}
+
+// homeAbbreviations lists the home zone's abbreviations for suggesting a time zone
+func homeAbbreviations() string {
+	names := []string{}
+	for _, month := range []time.Month{time.January, time.July} {
+		name, _ := time.Date(currentTime().Year(), month, 1, 12, 0, 0, 0, homeLocation).Zone()
+		if len(names) == 0 || names[0] != name {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+// diagnoseRotation finds what's wrong with a deadline that was meant to follow the rotation, or to be in words
+func diagnoseRotation(tokens []string, value string) error {
+	hint := fmt.Sprintf("repeating deadlines look like '%s'", rotationExample)
+	if _, _, err := parseClock(tokens[0]); err != nil {
+		if _, naturalErr := parseNaturalDeadline(value, currentTime()); naturalErr != nil {
+			return fmt.Errorf("Unable to parse '%s' in deadline '%s' as a time like 18:00; deadlines look like '%s', '%s' or '%s'",
+				tokens[0], value, datedExample, rotationExample, naturalExample)
+		}
+		// these are written out as dated deadlines when the To Do List is read, see naturalDeadlines.go
+		return fmt.Errorf("Deadline '%s' hasn't been written out as a dated deadline like '%s' yet", value, datedExample)
+	}
+	if len(tokens) < 3 {
+		return fmt.Errorf("Deadline '%s' is missing its rotation or days; %s", value, hint)
+	}
+	lower := strings.Fields(strings.ToLower(value))
+	daysFrom := 2
+	if lower[1] == "week" || lower[1] == "weeks" {
+		for daysFrom < len(lower) && weekListMatcher.MatchString(lower[daysFrom]) {
+			daysFrom++
+		}
+	}
+	if _, err := rotation(strings.Join(lower[1:daysFrom], " ")).weeks(); err != nil {
+		if daysFrom > 2 {
+			return fmt.Errorf("%s, in deadline '%s'; %s", err.Error(), value, hint)
+		}
+		if _, dayErr := getWeekday(strings.Trim(tokens[1], ",")); dayErr == nil {
+			return fmt.Errorf("Deadline '%s' is missing its rotation before '%s'; %s", value, tokens[1], hint)
+		}
+		return fmt.Errorf("Unable to parse '%s' in deadline '%s' as a rotation like first, second, all or weeks 1,3%s; %s",
+			tokens[1], value, didYouMean(tokens[1], rotationNames), hint)
+	}
+	for _, phrase := range strings.Split(strings.Join(tokens[daysFrom:], " "), ",") {
+		for _, day := range strings.Split(phrase, "-") {
+			day = strings.TrimSpace(day)
+			if _, err := getWeekday(day); err != nil {
+				return fmt.Errorf("Unable to parse '%s' in deadline '%s' as a weekday%s; %s", day, value, didYouMean(day, weekdayNames), hint)
+			}
+		}
+	}
+	return nil
+}
+
+// didYouMean suggests the closest of options to a misspelled word, or nothing if none is close enough
+func didYouMean(word string, options []string) string {
+	closest := closestWord(word, options)
+	if closest == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean '%s'?)", closest)
+}
+
+// closestWord is the option a word is most likely a typo of, ignoring case, or empty if none are within a couple of
+// letters of it
+func closestWord(word string, options []string) string {
+	best, bestDistance := "", 3
+	for _, option := range options {
+		distance := editDistance(strings.ToLower(word), strings.ToLower(option))
+		if distance < bestDistance && distance < len(word) {
+			best, bestDistance = option, distance
+		}
+	}
+	return best
+}
+
+// editDistance counts the letters added, removed or changed to turn one word into the other
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// atLine puts the line of the To Do List the deadline came from in front of an error about it
+func (t *Task) atLine(err error) error {
+	if t.deadlineLine == 0 {
+		return err
+	}
+	return fmt.Errorf("Line %d: %s", t.deadlineLine, err.Error())
+}
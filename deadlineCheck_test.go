@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that deadlines are told apart and that broken ones say which part is wrong and what they should look like
+func TestClassifyDeadline(t *testing.T) {
+	tests := []struct {
+		deadline string
+		kind     deadlineKind
+		mentions []string
+	}{
+		{deadline: "16:00 11/28/2022", kind: datedKind},
+		{deadline: "16:00 11/28/2022 America/Chicago", kind: datedKind},
+		{deadline: "15:00 last Friday of month", kind: ruleKind},
+		{deadline: "18:00 first Monday", kind: rotationKind},
+		{deadline: "09:00 weeks 1,2 Mon-Fri", kind: rotationKind},
+		{deadline: "09:00 weeks 1,3 Mon-Fri", kind: rotationKind, mentions: []string{"Week 3", "cycle"}},
+		// a typo in a date isn't blamed on repeating deadlines
+		{deadline: "16:00 11/31/2022", kind: datedKind, mentions: []string{"'11/31/2022'", "as a date", datedExample}},
+		{deadline: "16:00 28/11/2022", kind: datedKind, mentions: []string{"'28/11/2022'", datedExample}},
+		{deadline: "1600 11/28/2022", kind: datedKind, mentions: []string{"'1600'", "as a time"}},
+		{deadline: "16:00 11/28/2022 Americas/Chicago", kind: datedKind, mentions: []string{"'Americas/Chicago'", "time zone"}},
+		{deadline: "16:00 11/28/2022 EST please", kind: datedKind, mentions: []string{"'please'"}},
+		{deadline: "18:00 frist Monday", kind: rotationKind, mentions: []string{"'frist'", "did you mean 'first'", rotationExample}},
+		{deadline: "18:00 first Mondya", kind: rotationKind, mentions: []string{"'Mondya'", "did you mean 'Monday'"}},
+		{deadline: "18:00 both Mon-Fir", kind: rotationKind, mentions: []string{"'Fir'", "did you mean 'Fri'"}},
+		{deadline: "18:00 Mon, Wed", kind: rotationKind, mentions: []string{"missing its rotation before 'Mon,'"}},
+		{deadline: "18:00 Monday", kind: rotationKind, mentions: []string{"missing its rotation or days"}},
+		{deadline: "someday soon", kind: rotationKind, mentions: []string{"'someday'", datedExample, naturalExample}},
+		{deadline: "15:00 last Fridya of month", kind: ruleKind, mentions: []string{"'Fridya'", ruleExample}},
+	}
+	for _, test := range tests {
+		kind, err := classifyDeadline(test.deadline)
+		if kind != test.kind {
+			t.Errorf("Expected '%s' to be kind %d, got %d", test.deadline, test.kind, kind)
+		}
+		if len(test.mentions) == 0 {
+			if err != nil {
+				t.Errorf("Unexpected error classifying '%s': %s", test.deadline, err.Error())
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Expected an error for '%s'", test.deadline)
+			continue
+		}
+		for _, mention := range test.mentions {
+			if !strings.Contains(err.Error(), mention) {
+				t.Errorf("Expected the error for '%s' to mention %s, got %s", test.deadline, mention, err.Error())
+			}
+		}
+	}
+}
+
+// check that a broken deadline points at its line of the To Do List
+func TestDeadlineLine(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	_, tasks := mdToStructs([]string{
+		"- " + upcomingTasks,
+		"\t- Report",
+		"\t\t- Estimated Hours; 2",
+		"\t\t- Deadline; 16:00 11/31/2022",
+		"\t- Chores",
+		"\t\t- Deadline; 18:00 both Sunday",
+	}, tLogger)
+	if len(tasks) != 2 || tasks[0].line != 2 || tasks[0].deadlineLine != 4 || tasks[1].line != 5 || tasks[1].deadlineLine != 6 {
+		t.Errorf("Tasks didn't keep their lines of the To Do List")
+		t.FailNow()
+	}
+	err := tasks[0].calculateUrgency(mid, []*GeneralEvent{}, tLogger)
+	if err == nil || !strings.HasPrefix(err.Error(), "Line 4: ") || !strings.Contains(err.Error(), "'11/31/2022'") {
+		t.Errorf("Expected the error to point at line 4 and the date, got %v", err)
+	}
+}
+
+// check the suggestions for misspelled words
+func TestClosestWord(t *testing.T) {
+	tests := []struct {
+		word    string
+		closest string
+	}{
+		{word: "Thrusday", closest: "Thursday"},
+		{word: "wednseday", closest: "Wednesday"},
+		{word: "fri", closest: "Fri"},
+		{word: "xyz", closest: ""},
+		{word: "Banana", closest: ""},
+	}
+	for _, test := range tests {
+		if closest := closestWord(test.word, weekdayNames); closest != test.closest {
+			t.Errorf("Expected '%s' for '%s', got '%s'", test.closest, test.word, closest)
+		}
+	}
+}
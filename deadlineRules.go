@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Besides following the rotation ("18:00 first Monday"), repeating deadlines can follow the calendar:
+//
+//	15:00 last Friday of month     any of first through fifth (or 1st through 5th) and last
+//	09:00 the 1st                  any day of the month, or "the last day", optionally followed by "of month"
+//	17:00 every 3 days             counted from the prime Sunday, or "every 3 days from 11/20/2022"; "every day" too
+//	09:00 every year on 04/15
+//	17:00 RRULE:FREQ=MONTHLY;BYDAY=-1FR;BYMONTH=3,6,9,12
+//
+// They all become RFC 5545 recurrence rules (see recurrence.go) starting on the prime Sunday at the deadline's time,
+// unless they say when to start from.
+
+// deadlineRule is a repeating deadline that follows the calendar
+type deadlineRule struct {
+	rule  *recurrenceRule
+	start time.Time
+}
+
+var deadlineOrdinals = map[string]int{
+	"first": 1, "1st": 1, "second": 2, "2nd": 2, "third": 3, "3rd": 3, "fourth": 4, "4th": 4, "fifth": 5, "5th": 5, "last": -1,
+}
+
+var monthDayMatcher = regexp.MustCompile(`^(\d{1,2})(st|nd|rd|th)$`)
+
+// the furthest ahead we look for the next deadline, far enough for a yearly one on 02/29
+const deadlineRuleYears = 8
+
+// isRuleDeadline tells repeating deadlines that follow the calendar from ones that follow the rotation
+func isRuleDeadline(value string) bool {
+	tokens := strings.Fields(strings.ToLower(value))
+	if len(tokens) < 2 {
+		return false
+	}
+	if tokens[1] == "every" || tokens[1] == "the" || strings.HasPrefix(tokens[1], "rrule:") || strings.HasPrefix(tokens[1], "freq=") {
+		return true
+	}
+	return tokens[len(tokens)-1] == "month"
+}
+
+// parseDeadlineRule reads a repeating deadline that follows the calendar, see the top of this file. Errors name the
+// part of the deadline that couldn't be understood.
+func parseDeadlineRule(value string, loc *time.Location) (*deadlineRule, error) {
+	tokens := strings.Fields(value)
+	if len(tokens) < 2 {
+		return nil, fmt.Errorf("Deadline '%s' needs a time and when it repeats", value)
+	}
+	hour, minute, err := parseClock(tokens[0])
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse '%s' in deadline '%s' as a time like 15:04", tokens[0], value)
+	}
+	prime := getPrimeSunday(loc)
+	deadline := &deadlineRule{start: time.Date(prime.Year(), prime.Month(), prime.Day(), hour, minute, 0, 0, loc)}
+	words := tokens[1:]
+	rrule := ""
+	switch first := strings.ToLower(words[0]); {
+	case strings.HasPrefix(first, "rrule:") || strings.HasPrefix(first, "freq="):
+		rrule = strings.Join(words, "")
+	case first == "every":
+		rrule, err = deadline.parseEvery(words[1:], value, loc)
+	case first == "the":
+		rrule, err = parseMonthDay(trimOfMonth(words[1:]), value)
+	default:
+		rrule, err = parseMonthWeekday(words, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	deadline.rule, err = parseRRule(rrule)
+	if err != nil {
+		return nil, fmt.Errorf("%s, in deadline '%s'", err.Error(), value)
+	}
+	return deadline, nil
+}
+
+// trimOfMonth drops a trailing "of month", "of the month" or "of every month"
+func trimOfMonth(words []string) []string {
+	if len(words) == 0 || !strings.EqualFold(words[len(words)-1], "month") {
+		return words
+	}
+	words = words[:len(words)-1]
+	if len(words) > 0 && (strings.EqualFold(words[len(words)-1], "the") || strings.EqualFold(words[len(words)-1], "every")) {
+		words = words[:len(words)-1]
+	}
+	if len(words) > 0 && strings.EqualFold(words[len(words)-1], "of") {
+		words = words[:len(words)-1]
+	}
+	return words
+}
+
+// parseEvery reads what comes after "every": "day", "N days", either one followed by "from <date>", or "year on <date>"
+func (d *deadlineRule) parseEvery(words []string, value string, loc *time.Location) (string, error) {
+	if len(words) == 0 {
+		return "", fmt.Errorf("Deadline '%s' is missing what it repeats every", value)
+	}
+	if strings.EqualFold(words[0], "year") {
+		if len(words) != 3 || !strings.EqualFold(words[1], "on") {
+			return "", fmt.Errorf("Deadline '%s' should end like 'every year on 04/15'", value)
+		}
+		date, err := time.Parse("01/02", words[2])
+		if err != nil {
+			return "", fmt.Errorf("Unable to parse '%s' in deadline '%s' as a date like 04/15", words[2], value)
+		}
+		return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYMONTHDAY=%d", date.Month(), date.Day()), nil
+	}
+	interval := 1
+	if !strings.EqualFold(words[0], "day") {
+		num, err := strconv.Atoi(words[0])
+		if err != nil || num < 1 {
+			return "", fmt.Errorf("Unable to parse '%s' in deadline '%s' as a number of days", words[0], value)
+		}
+		if len(words) < 2 || !strings.EqualFold(words[1], "days") {
+			return "", fmt.Errorf("Deadline '%s' should say 'every %d days'", value, num)
+		}
+		interval = num
+		words = words[1:]
+	}
+	words = words[1:]
+	if len(words) > 0 {
+		if !strings.EqualFold(words[0], "from") || len(words) != 2 {
+			return "", fmt.Errorf("Unable to parse '%s' in deadline '%s'; expected 'from' and a date", strings.Join(words, " "), value)
+		}
+		from, err := time.ParseInLocation(anchorDateFmt, words[1], loc)
+		if err != nil {
+			return "", fmt.Errorf("Unable to parse '%s' in deadline '%s' as a date like %s", words[1], value, anchorDateFmt)
+		}
+		d.start = time.Date(from.Year(), from.Month(), from.Day(), d.start.Hour(), d.start.Minute(), 0, 0, loc)
+	}
+	return fmt.Sprintf("FREQ=DAILY;INTERVAL=%d", interval), nil
+}
+
+// parseMonthDay reads what comes after "the": a day of the month like "1st" or "15th", or "last day"
+func parseMonthDay(words []string, value string) (string, error) {
+	if len(words) == 2 && strings.EqualFold(words[0], "last") && strings.EqualFold(words[1], "day") {
+		return "FREQ=MONTHLY;BYMONTHDAY=-1", nil
+	}
+	if len(words) != 1 {
+		return "", fmt.Errorf("Deadline '%s' should be like 'the 1st' or 'the last day'", value)
+	}
+	matches := monthDayMatcher.FindStringSubmatch(strings.ToLower(words[0]))
+	day := 0
+	if matches != nil {
+		day, _ = strconv.Atoi(matches[1])
+	}
+	if day < 1 || day > 31 {
+		return "", fmt.Errorf("Unable to parse '%s' in deadline '%s' as a day of the month like 1st or 15th", words[0], value)
+	}
+	return fmt.Sprintf("FREQ=MONTHLY;BYMONTHDAY=%d", day), nil
+}
+
+// parseMonthWeekday reads a weekday of the month like "last Friday of month"
+func parseMonthWeekday(words []string, value string) (string, error) {
+	if !strings.EqualFold(words[len(words)-1], "month") {
+		return "", fmt.Errorf("Deadline '%s' doesn't say when it repeats", value)
+	}
+	words = trimOfMonth(words)
+	if len(words) != 2 {
+		return "", fmt.Errorf("Deadline '%s' should be like 'last Friday of month'", value)
+	}
+	ordinal, ok := deadlineOrdinals[strings.ToLower(words[0])]
+	if !ok {
+		return "", fmt.Errorf("Unable to parse '%s' in deadline '%s' as first through fifth or last", words[0], value)
+	}
+	day, err := getWeekday(words[1])
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse '%s' in deadline '%s' as a weekday", words[1], value)
+	}
+	return fmt.Sprintf("FREQ=MONTHLY;BYDAY=%d%s", ordinal, icsWeekdays[day]), nil
+}
+
+// next is the first time the deadline comes up after after. It comes back false once a rule with a COUNT or UNTIL
+// has run out.
+func (d *deadlineRule) next(after time.Time) (time.Time, bool) {
+	for years := 1; years <= deadlineRuleYears; years *= 2 {
+		for _, occurrence := range d.rule.occurrences(d.start, after, after.AddDate(years, 0, 0)) {
+			if occurrence.After(after) {
+				return occurrence, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// rrule writes the rule back out as an RRULE value for a calendar starting from its next occurrence, so a COUNT
+// becomes the UNTIL of the last one
+func (d *deadlineRule) rrule() string {
+	rule := d.rule
+	parts := []string{"FREQ=" + rule.freq}
+	if rule.interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", rule.interval))
+	}
+	if rule.freq == "WEEKLY" {
+		parts = append(parts, "WKST="+icsWeekdays[rule.weekStart])
+	}
+	if len(rule.byDay) != 0 {
+		days := []string{}
+		for _, byDay := range rule.byDay {
+			ordinal := ""
+			if byDay.ordinal != 0 {
+				ordinal = strconv.Itoa(byDay.ordinal)
+			}
+			days = append(days, ordinal+icsWeekdays[byDay.day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(rule.byMonthDay) != 0 {
+		days := []string{}
+		for _, day := range rule.byMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(rule.byMonth) != 0 {
+		months := []string{}
+		for _, month := range rule.byMonth {
+			months = append(months, strconv.Itoa(int(month)))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	until := rule.until
+	if rule.count != 0 {
+		occurrences := rule.occurrences(d.start, d.start, d.start.AddDate(100, 0, 0))
+		until = occurrences[len(occurrences)-1]
+	}
+	if !until.IsZero() {
+		parts = append(parts, "UNTIL="+icsTime(until))
+	}
+	return strings.Join(parts, ";")
+}
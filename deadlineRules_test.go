@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that each kind of calendar deadline comes up next when it should
+func TestDeadlineRuleNext(t *testing.T) {
+	mid := generateTestingTimes()["mid"]
+	at := func(month time.Month, day, hour, year int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, mid.Location())
+	}
+	tests := []struct {
+		deadline string
+		next     time.Time
+		done     bool
+	}{
+		// the last Friday in November was the day before
+		{deadline: "15:00 last Friday of month", next: at(12, 30, 15, 2022)},
+		{deadline: "15:00 Last Fri of the month", next: at(12, 30, 15, 2022)},
+		{deadline: "15:00 2nd Tuesday of every month", next: at(12, 13, 15, 2022)},
+		{deadline: "09:00 the 1st", next: at(12, 1, 9, 2022)},
+		{deadline: "09:00 the 27th of month", next: at(11, 27, 9, 2022)},
+		{deadline: "09:00 the last day", next: at(11, 30, 9, 2022)},
+		// November only has 30 days
+		{deadline: "09:00 the 31st", next: at(12, 31, 9, 2022)},
+		{deadline: "17:00 every day", next: at(11, 27, 17, 2022)},
+		// 11/20, 11/23 and 11/26 at 17:00 have gone by
+		{deadline: "17:00 every 3 days from 11/20/2022", next: at(11, 29, 17, 2022)},
+		{deadline: "09:00 every year on 04/15", next: at(4, 15, 9, 2023)},
+		{deadline: "09:00 every year on 02/29", next: at(2, 29, 9, 2024)},
+		{deadline: "17:00 RRULE:FREQ=MONTHLY;BYDAY=-1FR;BYMONTH=3,6,9,12", next: at(12, 30, 17, 2022)},
+		{deadline: "17:00 FREQ=DAILY;UNTIL=20221120T000000Z", done: true},
+	}
+	for _, test := range tests {
+		if !isRuleDeadline(test.deadline) {
+			t.Errorf("Expected '%s' to follow the calendar", test.deadline)
+			t.FailNow()
+		}
+		rule, err := parseDeadlineRule(test.deadline, mid.Location())
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %s", test.deadline, err.Error())
+			t.FailNow()
+		}
+		next, ok := rule.next(mid)
+		if ok == test.done || !next.Equal(test.next) {
+			t.Errorf("Next deadline for '%s' didn't match;\nExpected: %s\nActual: %s (%t)", test.deadline, test.next, next, ok)
+		}
+	}
+}
+
+// check that rotation deadlines aren't mistaken for calendar ones, and that bad rules name what's wrong with them
+func TestDeadlineRuleErrors(t *testing.T) {
+	mid := generateTestingTimes()["mid"]
+	for _, rotationDeadline := range []string{"18:00 first Monday", "09:00 both Mon-Fri", "16:00 11/28/2022"} {
+		if isRuleDeadline(rotationDeadline) {
+			t.Errorf("Expected '%s' not to follow the calendar", rotationDeadline)
+		}
+	}
+	tests := []struct {
+		deadline string
+		token    string
+	}{
+		{deadline: "15:00 last Fridya of month", token: "'Fridya'"},
+		{deadline: "15:00 sixth Friday of month", token: "'sixth'"},
+		{deadline: "25:00 the 1st", token: "'25:00'"},
+		{deadline: "09:00 the 32nd", token: "'32nd'"},
+		{deadline: "17:00 every three days", token: "'three'"},
+		{deadline: "17:00 every 3 days from someday", token: "'someday'"},
+		{deadline: "09:00 every year on 13/01", token: "'13/01'"},
+		{deadline: "17:00 RRULE:FREQ=HOURLY", token: "'HOURLY'"},
+		{deadline: "17:00 RRULE:FREQ=DAILY;BYDAY=XX", token: "'XX'"},
+	}
+	for _, test := range tests {
+		_, err := parseDeadlineRule(test.deadline, mid.Location())
+		if err == nil || !strings.Contains(err.Error(), test.token) {
+			t.Errorf("Expected the error for '%s' to name %s, got %v", test.deadline, test.token, err)
+		}
+	}
+}
+
+// check that the free time runs up to the next calendar deadline
+func TestDeadlineRuleUrgency(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	rent := &Task{Name: "Pay rent", Deadline: "09:00 the 1st", EstimatedHours: 1}
+	err := rent.calculateUrgency(mid, []*GeneralEvent{}, tLogger)
+	if err != nil {
+		t.Errorf("Unexpected error calculating urgency: %s", err.Error())
+		t.FailNow()
+	}
+	// from 23:00 through the rest of November and up to 09:00 on the 1st
+	if rent.FreeMinutes != (1+4*24+9)*60 || !rent.DeadlineTime.Equal(time.Date(2022, 12, 1, 9, 0, 0, 0, mid.Location())) {
+		t.Errorf("Expected 106 free hours up to 12/01 09:00, got %d minutes up to %s", rent.FreeMinutes, rent.DeadlineTime)
+	}
+	broken := &Task{Name: "Pay rent", Deadline: "09:00 the 1th of mnth", EstimatedHours: 1}
+	if err := broken.calculateUrgency(mid, []*GeneralEvent{}, tLogger); err == nil {
+		t.Errorf("Expected an error for a malformed deadline")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Whatever can't be understood while reading the To Do List is noted as a diagnostic: how serious it is, where it was
+// when the list was read (line and column, counting from 1) and which field of which item. Problems are still read
+// past, with the field left at nothing, but the diagnostics are written into the Background Perspective Stuff section
+// so they don't go unseen. The lines move as soon as the list is rewritten, so there they only say the item and field;
+// `perspective check` lists them with their lines.
+
+type severity string
+
+const (
+	severityError   severity = "error"
+	severityWarning severity = "warning"
+)
+
+type diagnostic struct {
+	Severity severity
+	Line     int
+	Column   int
+	Item     string
+	Field    string
+	Message  string
+}
+
+func (d diagnostic) String() string {
+	return fmt.Sprintf("Line %d, column %d: %s", d.Line, d.Column, d.describe())
+}
+
+// describe is the diagnostic without where it was in the file
+func (d diagnostic) describe() string {
+	out := string(d.Severity)
+	if d.Field != "" {
+		out += " in " + d.Field
+	}
+	if d.Item != "" {
+		out += fmt.Sprintf(" of '%s'", d.Item)
+	}
+	return out + ": " + d.Message
+}
+
+type diagnostics []diagnostic
+
+// add notes a problem with value on a line of the To Do List, pointing the column at where value starts in raw
+func (d *diagnostics) add(level severity, line int, raw, value, item, field, message string) {
+	if d == nil {
+		return
+	}
+	column := strings.Index(raw, value) + 1
+	if value == "" || column == 0 {
+		column = len(raw) - len(strings.TrimLeft(raw, "\t- ")) + 1
+	}
+	*d = append(*d, diagnostic{Severity: level, Line: line, Column: column, Item: item, Field: field, Message: message})
+}
+
+// errors counts the diagnostics that are errors rather than warnings
+func (d diagnostics) errors() int {
+	count := 0
+	for _, diag := range d {
+		if diag.Severity == severityError {
+			count++
+		}
+	}
+	return count
+}
+
+// outputDiagnostics writes the diagnostics for the Background Perspective Stuff section
+func outputDiagnostics(diags diagnostics) string {
+	if len(diags) == 0 {
+		return ""
+	}
+	outStr := "\t- Diagnostics\n"
+	for _, diag := range diags {
+		outStr += "\t\t- " + diag.describe() + "\n"
+	}
+	return outStr
+}
+
+// rankingDiagnostics are the errors for the tasks and events that couldn't be ranked (see invalid.go), pointing at
+// the deadline for tasks and at the name for events
+func rankingDiagnostics(events []*GeneralEvent, tasks []*Task) diagnostics {
+	diags := diagnostics{}
+	for _, task := range tasks {
+		if task.invalid == nil {
+			continue
+		}
+		line, field, value := task.line, "", task.Name
+		if task.deadlineLine != 0 {
+			line, field, value = task.deadlineLine, "Deadline", task.Deadline
+		}
+		diags.add(severityError, line, rawLineOf(task.Raw, line-task.line), value, task.Name, field, task.invalidMessage())
+	}
+	for _, event := range events {
+		if event.invalid != nil {
+			diags.add(severityError, event.line, rawLineOf(event.Raw, 0), event.Name, event.Name, "", event.invalid.Error())
+		}
+	}
+	return diags
+}
+
+// overlapDiagnostics are warnings for the events that block the same time (see findOverlaps), pointing at the name of
+// the second one. They're only warnings since the shared time is counted once anyway.
+func overlapDiagnostics(now time.Time, events []*GeneralEvent, logger log15.Logger) diagnostics {
+	diags := diagnostics{}
+	for _, overlap := range findOverlaps(now, events, logger) {
+		for _, event := range events {
+			if event.Name == overlap.Second {
+				diags.add(severityWarning, event.line, rawLineOf(event.Raw, 0), event.Name, event.Name, "", overlap.String())
+				break
+			}
+		}
+	}
+	return diags
+}
+
+// rawLineOf is the line of an item's markdown that's index lines after its name
+func rawLineOf(raw string, index int) string {
+	lines := strings.Split(strings.TrimPrefix(raw, "\n"), "\n")
+	if index < 0 || index >= len(lines) {
+		return ""
+	}
+	return lines[index]
+}
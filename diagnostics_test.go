@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+var diagnosticsList = []string{
+	"Updated at 22:00 11/26/2022",
+	"- " + upcomingTasks,
+	"\t- Report",
+	"\t\t- Deadline; 16:00 11/31/2022",
+	"\t\t- Estimated Hours; two",
+	"\t\t- Streak; many",
+	"- " + repeatingEvents,
+	"\t- Gym",
+	"\t\t- Rotation; frist",
+	"\t\t- Days; Tue, Thur",
+	"\t\t- Start Time; 5pm",
+	"\t\t- Duration; long",
+	"\t\t- Inactive; maybe",
+}
+
+// check that what can't be read from the To Do List is noted with where it is
+func TestParseDiagnostics(t *testing.T) {
+	tLogger := log15.New()
+	_, _, diags := parseMarkdown(diagnosticsList, tLogger)
+	expected := []string{
+		"Line 5, column 22: error in Estimated Hours of 'Report': Unable to parse 'two' as hours or a duration like 1h30m",
+		"Line 6, column 13: error in Streak of 'Report': Unable to parse 'many' as a whole number",
+		"Line 11, column 17: error in Start Time of 'Gym': ",
+		"Line 12, column 15: error in Duration of 'Gym': Unable to parse 'long'",
+		"Line 13, column 15: error in Inactive of 'Gym': Unable to parse 'maybe' as true or false",
+	}
+	if len(diags) != len(expected) || diags.errors() != len(expected) {
+		t.Errorf("Expected %d errors, got %v", len(expected), diags)
+		t.FailNow()
+	}
+	for index, diag := range diags {
+		if !strings.HasPrefix(diag.String(), expected[index]) {
+			t.Errorf("Diagnostic didn't match;\nExpected: %s...\nActual: %s", expected[index], diag.String())
+		}
+	}
+	// the deadline and the rotation only come up when ranking
+	events, tasks, _ := parseMarkdown(diagnosticsList, tLogger)
+	sortTasks(tasks, generateTestingTimes()["mid"], events, tLogger)
+	ranking := rankingDiagnostics(events, tasks)
+	if len(ranking) != 2 ||
+		!strings.HasPrefix(ranking[0].String(), "Line 4, column 15: error in Deadline of 'Report': Unable to parse '11/31/2022'") ||
+		!strings.HasPrefix(ranking[1].String(), "Line 8, column 4: error of 'Gym': Rotation 'frist'") {
+		t.Errorf("Ranking diagnostics didn't match, got %v", ranking)
+	}
+}
+
+// check that the diagnostics end up in the Background Perspective Stuff section and the check command
+func TestDiagnosticsOutput(t *testing.T) {
+	tLogger := log15.New()
+	events, tasks, diags := parseMarkdown(diagnosticsList, tLogger)
+	out := outputMarkdown(events, tasks, diags, tLogger)
+	if !strings.Contains(out, "- "+backgroundStuff+"\n\t- Diagnostics\n\t\t- error in Estimated Hours of 'Report': Unable to parse 'two'") {
+		t.Errorf("Expected the diagnostics in the background section:\n%s", out)
+	}
+	// the lines they were on are only right until the list is rewritten
+	if strings.Contains(out, "Line 5") {
+		t.Errorf("Expected the diagnostics without their lines:\n%s", out)
+	}
+	// and they're rebuilt rather than piling up
+	_, _, reread := parseMarkdown(strings.Split(out, "\n"), tLogger)
+	if len(reread) != len(diags) {
+		t.Errorf("Expected %d diagnostics after a write, got %v", len(diags), reread)
+	}
+	if background := outputBackground(generateTestingTimes()["mid"], []*GeneralEvent{}, nil, tLogger); background != "" {
+		t.Errorf("Expected no background section without anything to say, got %s", background)
+	}
+
+	path := filepath.Join(t.TempDir(), tasksFile)
+	if err := os.WriteFile(path, []byte(strings.Join(diagnosticsList, "\n")), 0644); err != nil {
+		t.Errorf("Unable to write To Do List: %s", err.Error())
+		t.FailNow()
+	}
+	err := checkCommand([]string{"-input", path}, tLogger)
+	if err == nil || !strings.Contains(err.Error(), "Found 7 errors") {
+		t.Errorf("Expected check to find 7 errors, got %v", err)
+	}
+	fixed := strings.Join(diagnosticsList[:4], "\n") + "\n\t\t- Estimated Hours; 2\n"
+	fixed = strings.Replace(fixed, "11/31/2022", "11/30/2022", 1)
+	if err := os.WriteFile(path, []byte(fixed), 0644); err != nil {
+		t.Errorf("Unable to write To Do List: %s", err.Error())
+		t.FailNow()
+	}
+	if err := checkCommand([]string{"-input", path}, tLogger); err != nil {
+		t.Errorf("Expected a clean check, got %s", err.Error())
+	}
+}
+
+// check that the check command warns about overlapping events without failing over them
+func TestOverlapDiagnostics(t *testing.T) {
+	tLogger := log15.New()
+	lines := []string{
+		"- " + repeatingEvents,
+		"\t- Work",
+		"\t\t- Rotation; both",
+		"\t\t- Days; Mon-Fri",
+		"\t\t- Start Time; 9",
+		"\t\t- Duration; 8",
+		"\t- Team Standup",
+		"\t\t- Rotation; second",
+		"\t\t- Days; Mon",
+		"\t\t- Start Time; 16:30",
+		"\t\t- Duration; 1",
+	}
+	events, _, _ := parseMarkdown(lines, tLogger)
+	diags := overlapDiagnostics(generateTestingTimes()["mid"], events, tLogger)
+	expected := "Line 7, column 4: warning of 'Team Standup': 'Work' and 'Team Standup' overlap on second Monday 16:30-17:00"
+	if len(diags) != 1 || diags[0].String() != expected || diags.errors() != 0 {
+		t.Errorf("Overlap diagnostics didn't match;\nExpected: %s\nActual: %v", expected, diags)
+	}
+	path := filepath.Join(t.TempDir(), tasksFile)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Errorf("Unable to write To Do List: %s", err.Error())
+		t.FailNow()
+	}
+	if err := checkCommand([]string{"-input", path}, tLogger); err != nil {
+		t.Errorf("Expected overlaps to only be warnings, got %s", err.Error())
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// The calendar feed serves the same calendar as the .ics export at /calendar.ics, so calendar apps can subscribe to
+// it instead of having the file synced to them. Every request needs the feed token, either as ?token= in the URL
+// (what most calendar apps can manage) or as the basic auth password.
+//
+//	PERSPECTIVE_FEED_ADDR         address to listen on, e.g. ":8642"; no feed without it
+//	PERSPECTIVE_FEED_TOKEN        secret the subscription URL has to carry
+//	PERSPECTIVE_FEED_WORK_BLOCKS  how many of the most urgent tasks get suggested work blocks, none by default
+const (
+	feedPath = "/calendar.ics"
+
+	// work blocks aren't suggested further out than this many cycles
+	workBlockCycles = 2
+)
+
+type calendarFeed struct {
+	token      string
+	workBlocks int
+
+	mu       sync.RWMutex
+	body     []byte
+	etag     string
+	modified time.Time
+}
+
+// workBlock is a stretch of free time set aside for working on a task
+type workBlock struct {
+	Task  string
+	Start time.Time
+	End   time.Time
+}
+
+// newCalendarFeed is nil when the feed isn't configured
+func newCalendarFeed(logger log15.Logger) *calendarFeed {
+	if os.Getenv("PERSPECTIVE_FEED_ADDR") == "" {
+		return nil
+	}
+	token := os.Getenv("PERSPECTIVE_FEED_TOKEN")
+	if token == "" {
+		logger.Error("Not serving the calendar feed without PERSPECTIVE_FEED_TOKEN")
+		return nil
+	}
+	feed := &calendarFeed{token: token}
+	if count := os.Getenv("PERSPECTIVE_FEED_WORK_BLOCKS"); count != "" {
+		workBlocks, err := strconv.Atoi(count)
+		if err != nil || workBlocks < 0 {
+			logger.Warn("Ignoring bad number of tasks to suggest work blocks for", "PERSPECTIVE_FEED_WORK_BLOCKS", count)
+		} else {
+			feed.workBlocks = workBlocks
+		}
+	}
+	return feed
+}
+
+// serve listens for subscribers until the listener fails
+func (f *calendarFeed) serve(logger log15.Logger) {
+	addr := os.Getenv("PERSPECTIVE_FEED_ADDR")
+	mux := http.NewServeMux()
+	mux.Handle(feedPath, f)
+	logger.Info("Serving calendar feed", "addr", addr, "path", feedPath)
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		logger.Error("Calendar feed stopped", "err", err.Error())
+	}
+}
+
+// update regenerates the calendar from sorted tasks. The ETag and Last-Modified only move when the plan itself
+// changed, not just the DTSTAMPs, so subscribers polling an unchanged plan get 304s.
+func (f *calendarFeed) update(now time.Time, events, busyEvents []*GeneralEvent, tasks []*Task, logger log15.Logger) {
+	work := []workBlock{}
+	if f.workBlocks > 0 {
+		work = suggestWorkBlocks(now, busyEvents, tasks, f.workBlocks, logger)
+	}
+	body := outputICSWithWork(now, events, tasks, work, logger)
+	etag := feedETag(body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if etag == f.etag {
+		return
+	}
+	f.body = []byte(body)
+	f.etag = etag
+	f.modified = now.UTC().Truncate(time.Second)
+	logger.Debug("Calendar feed changed", "etag", etag)
+}
+
+// feedETag hashes the calendar, leaving out the DTSTAMPs that change on every refresh
+func feedETag(body string) string {
+	hash := sha1.New()
+	for _, line := range strings.Split(body, "\r\n") {
+		if !strings.HasPrefix(line, "DTSTAMP:") {
+			hash.Write([]byte(line + "\n"))
+		}
+	}
+	return fmt.Sprintf(`"%x"`, hash.Sum(nil))
+}
+
+func (f *calendarFeed) authorized(r *http.Request) bool {
+	given := r.URL.Query().Get("token")
+	if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(f.token)) == 1
+}
+
+func (f *calendarFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !f.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Perspective"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	f.mu.RLock()
+	body, etag, modified := f.body, f.etag, f.modified
+	f.mu.RUnlock()
+	if body == nil {
+		http.Error(w, "Calendar isn't ready yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	// ServeContent takes care of If-None-Match, If-Modified-Since and HEAD
+	http.ServeContent(w, r, feedPath, modified, bytes.NewReader(body))
+}
+
+// suggestWorkBlocks sets aside free hours for the most urgent unfinished tasks, earliest first, before each one's
+// deadline. Tasks need to be sorted already; the earlier tasks get first pick of the hours. Invalid events are left
+// out, the same as when ranking.
+func suggestWorkBlocks(now time.Time, genEvents []*GeneralEvent, tasks []*Task, count int, logger log15.Logger) []workBlock {
+	genEvents = rankableEvents(genEvents, logger)
+	upcomingHour := nextHourBlock(now, logger)
+	startWall := upcomingWallHour(now)
+	start := fromWallHours(startWall, now.Location())
+	startBlock := absoluteHourBlock(now)
+	workBlockHorizon := workBlockCycles * cycleHours()
+
+	taken := map[int]bool{}
+	repeating, _ := getNextBlockedHours(now, genEvents, logger) // validated above
+	busyCycle := map[int]bool{}
+	for _, hour := range repeating {
+		busyCycle[hour%cycleHours()] = true
+	}
+	for _, hour := range getDatedBlockedHours(now, start.Add(time.Duration(workBlockHorizon)*time.Hour), genEvents, logger) {
+		taken[hour-startBlock] = true
+	}
+	for offset := 0; offset < workBlockHorizon; offset++ {
+		if busyCycle[(upcomingHour+offset)%cycleHours()] {
+			taken[offset] = true
+		}
+	}
+
+	blocks := []workBlock{}
+	for _, task := range tasks {
+		if count == 0 {
+			break
+		}
+		if task.estimateMinutes() <= 0 || !task.DeadlineTime.After(start) {
+			continue
+		}
+		count--
+		needed := (task.estimateMinutes() + 59) / 60 // work blocks are whole hours
+		current := -1
+		for offset := 0; offset < workBlockHorizon && needed > 0; offset++ {
+			// hours on the wall clock, so the blocks line up with the events when the clocks change
+			hourStart := fromWallHours(startWall+offset, now.Location())
+			hourEnd := fromWallHours(startWall+offset+1, now.Location())
+			if hourEnd.After(task.DeadlineTime) {
+				break
+			}
+			if taken[offset] {
+				current = -1
+				continue
+			}
+			taken[offset] = true
+			needed--
+			if current != -1 {
+				blocks[current].End = hourEnd
+				continue
+			}
+			blocks = append(blocks, workBlock{Task: task.Name, Start: hourStart, End: hourEnd})
+			current = len(blocks) - 1
+		}
+		if needed > 0 {
+			logger.Debug("Not enough free time for all of a task's work blocks", "task", task.Name, "short", needed)
+		}
+	}
+	return blocks
+}
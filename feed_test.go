@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that the feed wants its token and only hands out the calendar again when the plan changed
+func TestCalendarFeed(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	events := []*GeneralEvent{
+		{Name: "sleeping", Rotation: bothWeeks, Days: "Sun-Sat", StartTime: 23, Duration: 8},
+	}
+	report1, _, _ := createThreeTasks()
+	tasks := []*Task{report1}
+	sortTasks(tasks, mid, events, tLogger)
+	feed := &calendarFeed{token: "s3cret"}
+
+	get := func(target string, header map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		for key, value := range header {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		feed.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if code := get("/calendar.ics?token=s3cret", nil).Code; code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the first refresh, got %d", code)
+	}
+	feed.update(mid, events, events, tasks, tLogger)
+	if code := get("/calendar.ics", nil).Code; code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", code)
+	}
+	if code := get("/calendar.ics?token=wrong", nil).Code; code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with the wrong token, got %d", code)
+	}
+	first := get("/calendar.ics?token=s3cret", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Errorf("Expected the calendar with validators, got %d %v", first.Code, first.Header())
+		t.FailNow()
+	}
+	if !strings.Contains(first.Body.String(), "SUMMARY:Finish first book report for class") {
+		t.Errorf("Feed is missing the task deadline:\n%s", first.Body.String())
+	}
+
+	// an hour later nothing about the plan changed
+	feed.update(mid.Add(time.Hour), events, events, tasks, tLogger)
+	if code := get("/calendar.ics?token=s3cret", map[string]string{"If-None-Match": etag}).Code; code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged plan, got %d", code)
+	}
+	if code := get("/calendar.ics?token=s3cret", map[string]string{"If-Modified-Since": first.Header().Get("Last-Modified")}).Code; code != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged plan, got %d", code)
+	}
+
+	report1.Deadline = "16:00 11/29/2022 EST"
+	sortTasks(tasks, mid, events, tLogger)
+	feed.update(mid.Add(time.Hour), events, events, tasks, tLogger)
+	changed := get("/calendar.ics?token=s3cret", map[string]string{"If-None-Match": etag})
+	if changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Errorf("Expected a new calendar once the plan changed, got %d", changed.Code)
+	}
+}
+
+// check that work blocks go in the earliest free hours, most urgent task first
+func TestSuggestWorkBlocks(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"] // saturday night
+	sunday := mid.Add(2 * time.Hour)     // midnight
+	events := []*GeneralEvent{
+		{Name: "sleeping", Rotation: bothWeeks, Days: "Sun-Sat", StartTime: 23, Duration: 8},
+		{Name: "Dentist", Periods: []busyPeriod{{Start: sunday.Add(8 * time.Hour), End: sunday.Add(8*time.Hour + 30*time.Minute)}}},
+		// invalid events are left out instead of holding up the rest
+		{Name: "Gym", Rotation: "third", Days: "Mon", StartTime: 18, Duration: 1},
+	}
+	report1, report2, _ := createThreeTasks()
+	report1.EstimatedHours = 3
+	report2.EstimatedHours = 2
+	tasks := []*Task{report2, report1}
+	sortTasks(tasks, mid, events, tLogger)
+	if tasks[0] != report1 {
+		t.Errorf("Expected the first book report to be most urgent")
+		t.FailNow()
+	}
+
+	testCases := []struct {
+		count    int
+		expected []workBlock
+	}{
+		{1, []workBlock{
+			{report1.Name, sunday.Add(7 * time.Hour), sunday.Add(8 * time.Hour)},
+			{report1.Name, sunday.Add(9 * time.Hour), sunday.Add(11 * time.Hour)},
+		}},
+		{2, []workBlock{
+			{report1.Name, sunday.Add(7 * time.Hour), sunday.Add(8 * time.Hour)},
+			{report1.Name, sunday.Add(9 * time.Hour), sunday.Add(11 * time.Hour)},
+			{report2.Name, sunday.Add(11 * time.Hour), sunday.Add(13 * time.Hour)},
+		}},
+	}
+	for _, testCase := range testCases {
+		actual := suggestWorkBlocks(mid, events, tasks, testCase.count, tLogger)
+		if len(actual) != len(testCase.expected) {
+			t.Errorf("Expected %d work blocks for %d tasks, got %v", len(testCase.expected), testCase.count, actual)
+			continue
+		}
+		for index, block := range actual {
+			expected := testCase.expected[index]
+			if block.Task != expected.Task || !block.Start.Equal(expected.Start) || !block.End.Equal(expected.End) {
+				t.Errorf("Expected work block %v, got %v", expected, block)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Field names in the To Do List don't care about case, and a few have shorter names: "due" for Deadline, "estimate"
+// for Estimated Hours, "start" for Start Time and "length" for Duration. A line that looks like a field but isn't one
+// is noted in the diagnostics (see diagnostics.go) along with the field it was most likely meant to be. Fields are
+// written "Deadline; 16:00 11/28/2022", but a colon or missing space, like "Deadline: 16:00 11/28/2022" or
+// "Deadlin;16:00 11/28/2022", still reads as a field so that typos like those get noticed.
+
+// fieldMatcher splits a line into a field name and its value
+var fieldMatcher = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*?)\s*[;:]\s*(.*)$`)
+
+var taskFields = []string{
+	"Deadline", "Estimated Hours", "Priority", "Projects", "Contexts", "UUID", "Base Estimate", "Occurrence", "Overdue",
+	"Completed", "Repeat After", "History", "Streak",
+}
+
+var eventFields = []string{
+	"Rotation", "Days", "Start Time", "Duration", "Inactive", "Active From", "Active Until", "Schedule", "Except", "Date",
+	"Time Zone",
+}
+
+var taskFieldAliases = map[string]string{"due": "Deadline", "estimate": "Estimated Hours"}
+
+var eventFieldAliases = map[string]string{"start": "Start Time", "length": "Duration"}
+
+// splitField is the name and value of a line that's a field, or ok is false if it isn't one, like a link
+func splitField(line string) (key, value string, ok bool) {
+	matches := fieldMatcher.FindStringSubmatch(strings.TrimSpace(line))
+	if matches == nil || strings.HasPrefix(matches[2], "//") {
+		return "", "", false
+	}
+	return matches[1], matches[2], true
+}
+
+// taskField is the field a key on a task's line stands for, or the key itself if it isn't one
+func taskField(key string) string {
+	return canonicalField(key, taskFields, taskFieldAliases)
+}
+
+// eventField is taskField for events
+func eventField(key string) string {
+	return canonicalField(key, eventFields, eventFieldAliases)
+}
+
+func canonicalField(key string, fields []string, aliases map[string]string) string {
+	lower := strings.ToLower(strings.TrimSpace(key))
+	for _, field := range fields {
+		if strings.ToLower(field) == lower {
+			return field
+		}
+	}
+	if field, ok := aliases[lower]; ok {
+		return field
+	}
+	return key
+}
+
+// unknownField says a key isn't a field, suggesting the field or short name it's closest to
+func unknownField(key string, fields []string, aliases map[string]string) string {
+	names := []string{}
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	options := append(append([]string{}, fields...), names...)
+	return fmt.Sprintf("Unknown field '%s'%s, so it's been skipped", key, didYouMean(key, options))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that fields are read whatever their case or short name, and that misspelled ones are pointed out
+func TestFieldNames(t *testing.T) {
+	tLogger := log15.New()
+	events, tasks, diags := parseMarkdown([]string{
+		"- " + upcomingTasks,
+		"\t- Report",
+		"\t\t- deadline; 16:00 11/28/2022",
+		"\t\t- Estimated hours; 2",
+		"\t\t- Deadlin;16:00 11/29/2022",
+		"\t- Taxes",
+		"\t\t- Due: 16:00 04/18/2023",
+		"\t\t- estimate; 1h30m",
+		"\t\t- Colour; blue",
+		"\t\t- a note; with a semicolon in it",
+		"\t\t- Remember: receipts",
+		"\t\t- forms at https://example.com/forms",
+		"- " + repeatingEvents,
+		"\t- Work",
+		"\t\t- ROTATION; both",
+		"\t\t- days; Mon-Fri",
+		"\t\t- start; 9",
+		"\t\t- Length; 8",
+		"\t\t- Duraton; 9",
+	}, tLogger)
+	if len(tasks) != 2 || len(events) != 1 {
+		t.Errorf("Expected 2 tasks and an event, got %d and %d", len(tasks), len(events))
+		t.FailNow()
+	}
+	if tasks[0].Deadline != "16:00 11/28/2022" || tasks[0].estimateMinutes() != 120 ||
+		tasks[1].Deadline != "16:00 04/18/2023" || tasks[1].estimateMinutes() != 90 {
+		t.Errorf("Tasks didn't match, got %q %d and %q %d",
+			tasks[0].Deadline, tasks[0].estimateMinutes(), tasks[1].Deadline, tasks[1].estimateMinutes())
+	}
+	work := events[0]
+	if work.Rotation != bothWeeks || work.Days != "Mon-Fri" || work.StartTime != 9 || work.Duration != 8 || work.validate() != nil {
+		t.Errorf("Event didn't match, got %v", work)
+	}
+	expected := []string{
+		"Line 5, column 5: warning of 'Report': Unknown field 'Deadlin' (did you mean 'Deadline'?), so it's been skipped",
+		"Line 9, column 5: warning of 'Taxes': Unknown field 'Colour', so it's been skipped",
+		"Line 10, column 5: warning of 'Taxes': Unknown field 'a note', so it's been skipped",
+		"Line 11, column 5: warning of 'Taxes': Unknown field 'Remember', so it's been skipped",
+		"Line 19, column 5: warning of 'Work': Unknown field 'Duraton' (did you mean 'Duration'?), so it's been skipped",
+	}
+	if len(diags) != len(expected) {
+		t.Errorf("Expected %d warnings, got %v", len(expected), diags)
+		t.FailNow()
+	}
+	for index, diag := range diags {
+		if diag.String() != expected[index] || diag.Severity != severityWarning {
+			t.Errorf("Diagnostic didn't match;\nExpected: %s\nActual: %s", expected[index], diag.String())
+		}
+	}
+}
+
+// check that changing a field given by its short name changes that line rather than adding another
+func TestSetFieldAlias(t *testing.T) {
+	tLogger := log15.New()
+	_, tasks := mdToStructs([]string{
+		"- " + upcomingTasks,
+		"\t- Report",
+		"\t\t- due; tomorrow 5pm",
+		"\t\t- estimate; 2",
+	}, tLogger)
+	report := tasks[0]
+	if !normalizeDeadlines(tasks, generateTestingTimes()["mid"], tLogger) {
+		t.Errorf("Expected the deadline to be written out")
+	}
+	report.setField("Estimated Hours", "1")
+	if strings.Count(report.Raw, "; ") != 2 || !strings.Contains(report.Raw, "\t\t- Deadline; 17:00 11/27/2022 EST") ||
+		!strings.Contains(report.Raw, "\t\t- Estimated Hours; 1") {
+		t.Errorf("Expected the short names to be replaced:\n%s", report.Raw)
+	}
+	report.removeField("deadline")
+	if strings.Contains(report.Raw, "Deadline") {
+		t.Errorf("Expected the deadline to be removed:\n%s", report.Raw)
+	}
+	_, tasks = mdToStructs([]string{"- " + upcomingTasks, "\t- Taxes", "\t\t- Deadline: 16:00 04/18/2023"}, tLogger)
+	tasks[0].setField("Deadline", "16:00 04/17/2023")
+	if strings.Count(tasks[0].Raw, "Deadline") != 1 || !strings.Contains(tasks[0].Raw, "\t\t- Deadline; 16:00 04/17/2023") {
+		t.Errorf("Expected the deadline written with a colon to be replaced:\n%s", tasks[0].Raw)
+	}
+	unwritten := &Task{Name: "Report", Deadline: "16:00 11/28/2022", EstimatedHours: 2}
+	if !strings.Contains(unwritten.PrintRaw(), "Estimated Hours; 2") {
+		t.Errorf("Expected the estimate to be written as a field that can be read back:\n%s", unwritten.PrintRaw())
+	}
+	unwritten.EstimatedMinutes = 30
+	if !strings.Contains(unwritten.PrintRaw(), "Estimated Hours; 2h30m") {
+		t.Errorf("Expected the estimate to keep its minutes:\n%s", unwritten.PrintRaw())
+	}
+}
@@ -15,40 +15,151 @@ import (
 type GeneralEvent struct {
 	// Friendly name for the event, i.e. Sleeping, School, Work, Church, etc
 	Name string
-	// first, second, or both
+	// first, second, all, or the weeks of the cycle, e.g. "weeks 1,3"
 	Rotation rotation
 	// a comma separated list of days of the week, also accepts hyphenated ranges and abbreviations
 	Days string
 	// StartTime is in military time e.g. "18" is the one hour block starting at 6 pm
 	StartTime int
-	// Duration is the number of hours that an event lasts; round up when needed.
+	// StartMinute is how far past StartTime the event starts, for events like "18:30"
+	StartMinute int
+	// Duration is the number of hours that an event lasts; round up when needed. A Start Time range like
+	// "22:00-06:00" sets it from the end time instead.
 	Duration int
+	// DurationMinutes is how many minutes the event lasts on top of Duration, for events like "1h30m" or "45m"
+	DurationMinutes int
 	// Inactive is used to turn on and off events as needed, for example when traveling long term, without
 	// having to remove the events. Inactive events are not counted towards busy hours.
 	Inactive bool
-	Raw      string
+	// ActiveFrom, ActiveUntil and Schedule limit the event to a stretch of dates, see schedules.go
+	ActiveFrom  string
+	ActiveUntil string
+	Schedule    string
+	// Except lists the dates the event doesn't happen on, and can include holidays, see holidays.go
+	Except string
+	// Zone is the IANA name of the time zone StartTime is on the clock of, when it isn't the home zone, e.g. a
+	// meeting that's always 09:00 in America/Los_Angeles
+	Zone string
+	// Date is a date or a range of dates for one-off events and absences, see datedEvents.go. Dated events ignore
+	// the rotation fields.
+	Date string
+	// Periods are specific stretches of calendar time the event blocks, for events that happen on dates rather than
+	// on the rotation, such as meetings read from an .ics file. Events with periods ignore the rotation fields.
+	Periods []busyPeriod
+	Raw     string
+	// invalid is why the event can't block any time, if it can't, see invalid.go
+	invalid error
+	// line is where the event's name is in the To Do List, counting from 1, or 0 if it didn't come from one
+	line int
+	// hasStart is true when a Start Time was written down, which tells a dated event missing its Duration from an
+	// absence
+	hasStart bool
+}
+
+// busyPeriod is a stretch of real calendar time that's blocked off once, as opposed to the repeating hour blocks
+// of the rotation
+type busyPeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+// isDated is true for events that block specific dates instead of repeating on the rotation
+func (ge *GeneralEvent) isDated() bool {
+	return len(ge.Periods) != 0 || ge.Date != ""
 }
 
 func (ge *GeneralEvent) validate() error {
 	if ge.Name == "" {
 		return fmt.Errorf("Event is missing a name")
 	}
+	if ge.isDated() {
+		_, err := ge.periods()
+		return err
+	}
 	if ge.Rotation == "" {
 		return fmt.Errorf("Event '%s' has no deadline", ge.Name)
 	}
+	if _, err := ge.Rotation.weeks(); err != nil {
+		return fmt.Errorf("%s, in event '%s'", err.Error(), ge.Name)
+	}
 	if ge.Days == "" {
 		return fmt.Errorf("Event '%s' has no listed days", ge.Name)
 	}
-	if ge.Duration == 0 {
+	if ge.lengthMinutes() == 0 {
 		return fmt.Errorf("Event '%s' has missing or zero duration", ge.Name)
 	}
+	if ge.Zone != "" {
+		if _, err := time.LoadLocation(ge.Zone); err != nil {
+			return fmt.Errorf("Event '%s' has unknown time zone '%s'", ge.Name, ge.Zone)
+		}
+	}
+	if _, err := ge.activeWindow(); err != nil {
+		return err
+	}
+	if _, err := ge.exceptions(); err != nil {
+		return err
+	}
 	return nil
 }
 
 func (e *GeneralEvent) AddRaw(line string) {
+	if genTextMatcher.MatchString(line) {
+		return
+	}
 	e.Raw += line + "\n"
 }
 
+// buildRaw fills in the markdown lines for an event that didn't come from the To Do List
+func (e *GeneralEvent) buildRaw() {
+	e.Raw = ""
+	e.AddRaw("\t- " + e.Name)
+	if e.Date != "" {
+		e.AddRaw("\t\t- Date; " + e.Date)
+	} else {
+		e.AddRaw("\t\t- Rotation; " + string(e.Rotation))
+		e.AddRaw("\t\t- Days; " + e.Days)
+	}
+	if e.Date == "" || e.hasStart || e.lengthMinutes() != 0 {
+		e.AddRaw("\t\t- Start Time; " + formatClock(e.StartTime, e.StartMinute))
+	}
+	if e.Date == "" || e.lengthMinutes() != 0 {
+		e.AddRaw("\t\t- Duration; " + formatDuration(e.lengthMinutes()))
+	}
+	if e.Zone != "" {
+		e.AddRaw("\t\t- Time Zone; " + e.Zone)
+	}
+	if e.ActiveFrom != "" {
+		e.AddRaw("\t\t- Active From; " + e.ActiveFrom)
+	}
+	if e.ActiveUntil != "" {
+		e.AddRaw("\t\t- Active Until; " + e.ActiveUntil)
+	}
+	if e.Schedule != "" {
+		e.AddRaw("\t\t- Schedule; " + e.Schedule)
+	}
+	if e.Except != "" {
+		e.AddRaw("\t\t- Except; " + e.Except)
+	}
+	if e.Inactive {
+		e.AddRaw("\t\t- Inactive; true")
+	}
+}
+
+// section is the To Do List header an event belongs under. Events that are only active for some dates move
+// between Regular and Inactive Events on their own.
+func (e *GeneralEvent) section() string {
+	if e.invalid != nil {
+		return invalidItems
+	}
+	if e.Inactive || (e.isBounded() && !e.isActive(currentTime())) {
+		return inactiveEvents
+	}
+	if e.isPast(currentTime()) {
+		return pastEvents
+	}
+	return repeatingEvents
+}
+
 func (e *GeneralEvent) PrintRaw() string {
 	return e.Raw
 }
@@ -57,46 +168,229 @@ func (e *GeneralEvent) String() string {
 	return e.PrintRaw()
 }
 
-// Method for a GeneralEvent that returns a list of hourBlocks for an arbitrary 2 week rotation
+// startMinutes is when the event starts, in minutes after midnight
+func (e *GeneralEvent) startMinutes() int {
+	return e.StartTime*60 + e.StartMinute
+}
+
+// lengthMinutes is how long the event lasts in minutes
+func (e *GeneralEvent) lengthMinutes() int {
+	return e.Duration*60 + e.DurationMinutes
+}
+
+// Method for a GeneralEvent that returns a list of hourBlocks for an arbitrary 2 week rotation. Hours the event
+// only takes part of are included.
 func (event *GeneralEvent) generateBlockedHours(logger log15.Logger) []int {
+	return hoursOfSpans(event.generateBlockedSpans(logger))
+}
+
+// generateBlockedSpans is generateBlockedHours to the minute, counted in minutes from the start of the rotation.
+// Events running past the end of the rotation wrap around to the start of it.
+func (event *GeneralEvent) generateBlockedSpans(logger log15.Logger) []span {
+	if event.isDated() {
+		return []span{} // dated events block calendar time instead, see getDatedBlockedSpans
+	}
+	return wrapSpans(event.cycleOccurrences(logger))
+}
+
+// cycleOccurrences lists each time the event happens in a cycle, in minutes from the start of it on the event's
+// clock. Unlike generateBlockedSpans they aren't wrapped, so the last ones can run past the end of the cycle.
+func (event *GeneralEvent) cycleOccurrences(logger log15.Logger) []span {
 	days, err := parseDayStrings(event.Days)
 	if err != nil {
 		logger.Error("Problem parsing day strings", "days", event.Days, "err", err.Error())
 	}
-	return generateBlockedHours(days, event.Rotation, event.StartTime, event.Duration)
+	weeks, _ := event.Rotation.weeks() // a bad rotation doesn't block anything, validation catches it
+	spans := []span{}
+	for _, day := range days {
+		for _, week := range weeks {
+			start := (week*weekHours+int(day)*24)*60 + event.startMinutes()
+			spans = append(spans, span{start, start + event.lengthMinutes()})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
+
+// homeBlockedSpans is generateBlockedSpans moved onto the home clock, for events in another time zone
+func (event *GeneralEvent) homeBlockedSpans(now time.Time, logger log15.Logger) []span {
+	spans := event.generateBlockedSpans(logger)
+	if event.Zone == "" {
+		return spans
+	}
+	shift, err := zoneShift(now, event.Zone)
+	if err != nil {
+		logger.Error("Problem shifting event to the home time zone", "err", err.Error())
+		return spans
+	}
+	for index, busy := range spans {
+		spans[index] = span{busy.start + shift, busy.end + shift}
+	}
+	return wrapSpans(spans)
 }
 
 func getNextBlockedHours(now time.Time, genEvents []*GeneralEvent, topLogger log15.Logger) ([]int, error) {
-	hourblocks := []int{}
+	spans, err := getNextBlockedSpans(now, genEvents, topLogger)
+	return hoursOfSpans(spans), err
+}
+
+// getNextBlockedSpans is getNextBlockedHours to the minute. Busy time in or before the upcoming hour block counts
+// towards the next rotation. Inactive events don't block anything, and events that are only active for some dates or
+// that skip some dates block calendar time instead (see getBoundedBlockedSpans).
+func getNextBlockedSpans(now time.Time, genEvents []*GeneralEvent, topLogger log15.Logger) ([]span, error) {
+	spans := []span{}
 	upcomingHour := nextHourBlock(now, topLogger)
+	nextRotation := (upcomingHour + 1) * 60
 	for _, event := range genEvents {
-		logger := topLogger.New("event", event, "function", "getNextBlockedHours", "upcomingHour", upcomingHour)
+		logger := topLogger.New("event", event, "function", "getNextBlockedSpans", "upcomingHour", upcomingHour)
+		if event.isDated() {
+			continue
+		}
 		err := event.validate()
 		if err != nil {
-			return hourblocks, err
+			return spans, err
 		}
-		hours := event.generateBlockedHours(logger)
-		for _, hour := range hours {
-			if hour <= upcomingHour {
-				hour += fullTwoWeeks
+		if event.Inactive || event.followsCalendar() {
+			continue
+		}
+		for _, busy := range event.homeBlockedSpans(now, logger) {
+			if busy.start < nextRotation {
+				early := span{busy.start + cycleMinutes(), busy.end + cycleMinutes()}
+				if busy.end > nextRotation {
+					early.end = nextRotation + cycleMinutes()
+					spans = append(spans, span{nextRotation, busy.end})
+				}
+				busy = early
 			}
+			spans = append(spans, busy)
+		}
+	}
+	// overlapping events only block the time they share once
+	return mergeSpans(spans), nil
+}
+
+// getDatedBlockedHours lists the hours that dated events and events with active dates block between from and until,
+// counted in absolute hour blocks (see absoluteHourBlock) on from's clock so that they only ever apply once. Any busy
+// part of an hour blocks it.
+func getDatedBlockedHours(from, until time.Time, genEvents []*GeneralEvent, logger log15.Logger) []int {
+	fromBlock := absoluteHourBlock(from)
+	untilBlock := absoluteHourBlock(until)
+	hourblocks := []int{}
+	spans := append(getDatedBlockedSpans(from.Location(), genEvents), getBoundedBlockedSpans(from, until, genEvents, logger)...)
+	for _, hour := range hoursOfSpans(spans) {
+		if hour >= fromBlock && hour < untilBlock {
 			hourblocks = append(hourblocks, hour)
 		}
 	}
-	sort.Ints([]int(hourblocks))
-	return hourblocks, nil
+	return hourblocks
+}
+
+// getDatedBlockedSpans lists the time dated events block, in minutes from the prime Sunday on loc's clock. Inactive
+// and invalid events don't block anything.
+func getDatedBlockedSpans(loc *time.Location, genEvents []*GeneralEvent) []span {
+	primeMinutes := primeWallHours() * 60
+	spans := []span{}
+	for _, event := range genEvents {
+		if event.Inactive {
+			continue
+		}
+		periods, err := event.periods()
+		if err != nil {
+			continue
+		}
+		for _, period := range periods {
+			start := period.Start.In(loc)
+			end := period.End.In(loc)
+			busy := span{wallMinutes(start) - primeMinutes, wallMinutes(end) - primeMinutes}
+			if busy.end <= busy.start && end.After(start) { // ends in the hour the clocks went back to
+				busy.end = busy.start + int(end.Sub(start)/time.Minute)
+			}
+			spans = append(spans, busy)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
+
+// eventOverlap is a stretch of the rotation that two events both block
+type eventOverlap struct {
+	First  string
+	Second string
+	// minutes from the start of the rotation
+	When span
+}
+
+func (o eventOverlap) String() string {
+	week := o.When.start / (weekHours * 60)
+	day := time.Weekday(o.When.start / (24 * 60) % 7)
+	clock := func(minute int) string {
+		minute = ((minute % (24 * 60)) + 24*60) % (24 * 60)
+		return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+	}
+	return fmt.Sprintf("'%s' and '%s' overlap on %s %s %s-%s", o.First, o.Second, weekRotation(week), day, clock(o.When.start), clock(o.When.end))
+}
+
+// findOverlaps lists where active events of the rotation block the same time, so the user can tell whether they
+// meant it. The busy time is only counted once either way (see getNextBlockedSpans).
+func findOverlaps(now time.Time, genEvents []*GeneralEvent, topLogger log15.Logger) []eventOverlap {
+	active := []*GeneralEvent{}
+	for _, event := range genEvents {
+		if !event.isDated() && event.isActive(now) && event.validate() == nil {
+			active = append(active, event)
+		}
+	}
+	overlaps := []eventOverlap{}
+	for i, first := range active {
+		logger := topLogger.New("event", first.Name, "function", "findOverlaps")
+		firstSpans := mergeSpans(first.homeBlockedSpans(now, logger))
+		for _, second := range active[i+1:] {
+			for _, busy := range mergeSpans(second.homeBlockedSpans(now, logger)) {
+				for _, other := range firstSpans {
+					shared := clipSpan(busy, other)
+					if shared.end > shared.start {
+						overlaps = append(overlaps, eventOverlap{first.Name, second.Name, shared})
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(overlaps, func(i, j int) bool { return overlaps[i].When.start < overlaps[j].When.start })
+	return overlaps
+}
+
+// outputBackground writes the Background Perspective Stuff section, things worth knowing about the list that aren't
+// tasks or events. It's rebuilt on every write and left out when there's nothing to say.
+func outputBackground(now time.Time, eventList []*GeneralEvent, diags diagnostics, logger log15.Logger) string {
+	overlaps := findOverlaps(now, eventList, logger)
+	if len(overlaps) == 0 && len(diags) == 0 {
+		return ""
+	}
+	outStr := fmt.Sprintf(headerLineFmt, backgroundStuff)
+	outStr += outputDiagnostics(diags)
+	if len(overlaps) != 0 {
+		outStr += "\t- Overlapping Events\n"
+	}
+	for _, overlap := range overlaps {
+		outStr += "\t\t- " + overlap.String() + "\n"
+	}
+	return outStr
 }
 
 func outputEvents(eventList []*GeneralEvent) string {
 	outStr := ""
 	active := []*GeneralEvent{}
 	inactive := []*GeneralEvent{}
+	past := []*GeneralEvent{}
 	for _, event := range eventList {
-		if event.Inactive {
+		switch event.section() {
+		case invalidItems:
+			// written out with the tasks that couldn't be ranked, see outputInvalid
+		case inactiveEvents:
 			inactive = append(inactive, event)
-		} else {
+		case pastEvents:
+			past = append(past, event)
+		default:
 			active = append(active, event)
-
 		}
 	}
 	if len(active) != 0 {
@@ -111,6 +405,12 @@ func outputEvents(eventList []*GeneralEvent) string {
 			outStr += task.PrintRaw()
 		}
 	}
+	if len(past) != 0 {
+		outStr += fmt.Sprintf(headerLineFmt, pastEvents)
+		for _, event := range past {
+			outStr += event.PrintRaw()
+		}
+	}
 	outStr = strings.Replace(outStr, "\n\n", "\n", -1)
 	return outStr
 }
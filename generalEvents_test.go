@@ -2,7 +2,9 @@ package main
 
 import (
 	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/inconshreveable/log15"
 )
@@ -69,3 +71,217 @@ func compareIntArr(arr1, arr2 []int) bool {
 	}
 	return true
 }
+
+// check that overlapping events only block the time they share once, and that the overlap gets reported
+func TestOverlappingEvents(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	work := &GeneralEvent{Name: "Work", Rotation: "both", Days: "Mon-Fri", StartTime: 9, Duration: 8}
+	standup := &GeneralEvent{Name: "Team Standup", Rotation: "second", Days: "Monday", StartTime: 9, StartMinute: 30, DurationMinutes: 45}
+	sleep := &GeneralEvent{Name: "Sleeping", Rotation: "second", Days: "Saturday", StartTime: 23, Duration: 8}
+	run := &GeneralEvent{Name: "Run", Rotation: "first", Days: "Sunday", StartTime: 6, Duration: 1}
+
+	alone, _ := getNextBlockedHours(mid, []*GeneralEvent{work}, tLogger)
+	together, err := getNextBlockedHours(mid, []*GeneralEvent{work, standup}, tLogger)
+	if err != nil {
+		t.Errorf("Unexpected error getting blocked hours: %s", err.Error())
+		t.FailNow()
+	}
+	if !compareIntArr(alone, together) {
+		t.Errorf("Standup inside of work should block the same hours;\nExpected: %v\nActual: %v", alone, together)
+		t.FailNow()
+	}
+
+	tests := []struct {
+		name     string
+		events   []*GeneralEvent
+		overlaps []string
+	}{
+		{
+			name:   "standup during work",
+			events: []*GeneralEvent{work, standup},
+			overlaps: []string{
+				"'Work' and 'Team Standup' overlap on second Monday 09:30-10:15",
+			},
+		},
+		{
+			name:   "sleep past the end of the rotation",
+			events: []*GeneralEvent{sleep, run},
+			overlaps: []string{
+				"'Sleeping' and 'Run' overlap on first Sunday 06:00-07:00",
+			},
+		},
+		{
+			name:     "inactive events don't collide",
+			events:   []*GeneralEvent{work, {Name: "Old Standup", Rotation: "both", Days: "Monday", StartTime: 9, Duration: 1, Inactive: true}},
+			overlaps: []string{},
+		},
+	}
+	for _, test := range tests {
+		overlaps := findOverlaps(mid, test.events, tLogger)
+		actual := []string{}
+		for _, overlap := range overlaps {
+			actual = append(actual, overlap.String())
+		}
+		if len(actual) != len(test.overlaps) {
+			t.Errorf("Overlaps for %s didn't match;\nExpected: %v\nActual: %v", test.name, test.overlaps, actual)
+			t.FailNow()
+		}
+		for index := range actual {
+			if actual[index] != test.overlaps[index] {
+				t.Errorf("Overlaps for %s didn't match;\nExpected: %v\nActual: %v", test.name, test.overlaps, actual)
+				t.FailNow()
+			}
+		}
+	}
+
+	background := outputBackground(mid, []*GeneralEvent{work, standup}, nil, tLogger)
+	expected := "\n- " + backgroundStuff + "\n\t- Overlapping Events\n\t\t- 'Work' and 'Team Standup' overlap on second Monday 09:30-10:15\n"
+	if background != expected {
+		t.Errorf("Background section didn't match;\nExpected: %q\nActual: %q", expected, background)
+	}
+}
+
+// check that a task's free time only loses shared busy time once, whether it's two events or an event and a meeting
+func TestOverlappingFreeTime(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	work := &GeneralEvent{Name: "Work", Rotation: "both", Days: "Mon-Fri", StartTime: 9, Duration: 8}
+	standup := &GeneralEvent{Name: "Team Standup", Rotation: "second", Days: "Monday", StartTime: 9, StartMinute: 30, DurationMinutes: 45}
+	meetingStart := time.Date(2022, 11, 28, 8, 0, 0, 0, mid.Location())
+	meeting := &GeneralEvent{Name: "Meeting", Periods: []busyPeriod{{Start: meetingStart, End: meetingStart.Add(2 * time.Hour)}}}
+	tests := []struct {
+		name        string
+		events      []*GeneralEvent
+		busyMinutes int
+	}{
+		{name: "work", events: []*GeneralEvent{work}, busyMinutes: 8 * 60},
+		{name: "work and standup", events: []*GeneralEvent{work, standup}, busyMinutes: 8 * 60},
+		// the meeting runs from 08:00 to 10:00 and only the hour before work is new
+		{name: "work and a meeting", events: []*GeneralEvent{work, meeting}, busyMinutes: 9 * 60},
+	}
+	for _, test := range tests {
+		report := &Task{Name: "Report", Deadline: "16:00 11/28/2022 EST", EstimatedHours: 1}
+		err := report.calculateUrgency(mid, test.events, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error calculating urgency for %s: %s", test.name, err.Error())
+			t.FailNow()
+		}
+		if report.BusyMinutes != test.busyMinutes || report.FreeMinutes != 42*60-test.busyMinutes {
+			t.Errorf("Busy time for %s didn't match;\nExpected: %d busy\nActual: %d busy, %d free", test.name, test.busyMinutes, report.BusyMinutes, report.FreeMinutes)
+			t.FailNow()
+		}
+	}
+}
+
+// check that events crossing midnight, the end of the week and the end of the rotation block the right hours
+func TestEventBoundaries(t *testing.T) {
+	tLogger := log15.New()
+	wholeWeek := []int{}
+	for hour := 0; hour < weekHours; hour++ {
+		wholeWeek = append(wholeWeek, hour)
+	}
+	tests := []struct {
+		name   string
+		weeks  int
+		event  *GeneralEvent
+		blocks []int
+	}{
+		{
+			name:   "overnight shift",
+			weeks:  2,
+			event:  &GeneralEvent{Name: "Late Shift", Rotation: "first", Days: "Tuesday", StartTime: 22, Duration: 8},
+			blocks: []int{70, 71, 72, 73, 74, 75, 76, 77},
+		},
+		{
+			name:   "into the second week",
+			weeks:  2,
+			event:  &GeneralEvent{Name: "Sleeping", Rotation: "first", Days: "Saturday", StartTime: 23, Duration: 8},
+			blocks: []int{167, 168, 169, 170, 171, 172, 173, 174},
+		},
+		{
+			name:   "past the end of the rotation",
+			weeks:  2,
+			event:  &GeneralEvent{Name: "Sleeping", Rotation: "second", Days: "Saturday", StartTime: 23, Duration: 8},
+			blocks: []int{0, 1, 2, 3, 4, 5, 6, 335},
+		},
+		{
+			name:   "past the end of a longer rotation",
+			weeks:  3,
+			event:  &GeneralEvent{Name: "Sleeping", Rotation: "week 3", Days: "Saturday", StartTime: 23, StartMinute: 30, Duration: 7},
+			blocks: []int{0, 1, 2, 3, 4, 5, 6, 503},
+		},
+		{
+			name:   "longer than the rotation",
+			weeks:  1,
+			event:  &GeneralEvent{Name: "Away", Rotation: "all", Days: "Monday", StartTime: 0, Duration: 200},
+			blocks: wholeWeek,
+		},
+	}
+	for _, test := range tests {
+		useCycle(t, test.weeks, cycle.Anchor)
+		blocks := test.event.generateBlockedHours(tLogger)
+		if !compareIntArr(blocks, test.blocks) {
+			t.Errorf("Blocked hours for %s didn't match;\nExpected: %v\nActual: %v", test.name, test.blocks, blocks)
+			t.FailNow()
+		}
+	}
+}
+
+// check that sleep running past the end of the rotation is busy right now, at the start of the next one
+func TestEventWrapsIntoNow(t *testing.T) {
+	tLogger := log15.New()
+	now, _ := time.Parse(taskDateFmt, "03:00 11/20/2022 EST") // first Sun, before getting up
+	sleep := &GeneralEvent{Name: "Sleeping", Rotation: "second", Days: "Saturday", StartTime: 23, Duration: 8}
+	task := &Task{Name: "Breakfast", Deadline: "10:00 first Sunday", EstimatedHours: 1}
+	err := task.calculateUrgency(now, []*GeneralEvent{sleep}, tLogger)
+	if err != nil {
+		t.Errorf("Unexpected error calculating urgency: %s", err.Error())
+		t.FailNow()
+	}
+	// counting from the 04:00 hour block, which is the next rotation's like always, asleep until 07:00 and free until 10:00
+	if task.BusyMinutes != 2*60 || task.FreeMinutes != 4*60 {
+		t.Errorf("Expected 120 busy and 240 free minutes before breakfast, got %d and %d", task.BusyMinutes, task.FreeMinutes)
+	}
+}
+
+// check that a start time range sets the duration and wraps past midnight
+func TestStartTimeRange(t *testing.T) {
+	tLogger := log15.New()
+	lines := []string{
+		"- " + repeatingEvents,
+		"\t- Sleeping",
+		"\t\t- Rotation; both",
+		"\t\t- Days; Sun-Sat",
+		"\t\t- Start Time; 22:30-06:00",
+		"\t- Lunch",
+		"\t\t- Rotation; both",
+		"\t\t- Days; Mon-Fri",
+		"\t\t- Start Time; 12-13:15",
+	}
+	events, _ := mdToStructs(lines, tLogger)
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events, got %d", len(events))
+		t.FailNow()
+	}
+	if events[0].startMinutes() != 22*60+30 || events[0].lengthMinutes() != 7*60+30 {
+		t.Errorf("Sleeping should start at 22:30 for 7h30m, got %d for %d minutes", events[0].startMinutes(), events[0].lengthMinutes())
+	}
+	if events[1].startMinutes() != 12*60 || events[1].lengthMinutes() != 75 {
+		t.Errorf("Lunch should start at 12:00 for 1h15m, got %d for %d minutes", events[1].startMinutes(), events[1].lengthMinutes())
+	}
+	// a Duration wins over the end of the range whichever comes first, the same as in a CSV import
+	for _, order := range [][]string{
+		{"\t\t- Start Time; 22:00-06:00", "\t\t- Duration; 9"},
+		{"\t\t- Duration; 9", "\t\t- Start Time; 22:00-06:00"},
+	} {
+		events, _ := mdToStructs(append([]string{"- " + repeatingEvents, "\t- Sleeping", "\t\t- Rotation; both", "\t\t- Days; Sun-Sat"}, order...), tLogger)
+		if events[0].startMinutes() != 22*60 || events[0].lengthMinutes() != 9*60 {
+			t.Errorf("Expected the Duration to win with %v, got %d for %d minutes", order, events[0].startMinutes(), events[0].lengthMinutes())
+		}
+	}
+	csvEvents, _, err := csvToStructs(strings.NewReader(strings.Join(csvHeader, ",") + "\nevent,,Sleeping,,,,,,both,Sun-Sat,22:00-06:00,9,"))
+	if err != nil || len(csvEvents) != 1 || csvEvents[0].lengthMinutes() != 9*60 {
+		t.Errorf("Expected the Duration to win in a CSV import too, got %v (%v)", csvEvents, err)
+	}
+}
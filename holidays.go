@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Rotation events can skip the occurrences on some dates, like a day out sick, with an "Except" field listing dates
+// like 01/02/2006. Listing "holidays" there skips the holidays too, so that Work can have the day off without
+// Sleeping getting it as well. The holidays come from PERSPECTIVE_HOLIDAYS, either an .ics calendar, where every day
+// an event covers is a holiday, or a text file with a date at the start of each line:
+//
+//	11/24/2022 Thanksgiving
+//	12/26/2022 Christmas, observed
+//
+// An occurrence is skipped when it starts on one of its event's exception dates, on the event's clock.
+
+const holidaysKeyword = "holidays"
+
+// holidays are the configured holidays, by date (in anchorDateFmt) with their names
+var holidays = map[string]string{}
+
+// configureHolidays loads the holidays listed in the file from the environment, if there is one
+func configureHolidays(logger log15.Logger) {
+	holidays = map[string]string{}
+	path := os.Getenv("PERSPECTIVE_HOLIDAYS")
+	if path == "" {
+		return
+	}
+	logger = logger.New("PERSPECTIVE_HOLIDAYS", path)
+	loaded, err := readHolidays(path, currentTime(), logger)
+	if err != nil {
+		logger.Error("Unable to read holidays", "err", err.Error())
+		return
+	}
+	holidays = loaded
+	logger.Debug("Read holidays", "holidays", len(holidays))
+}
+
+// readHolidays reads a holiday file, see the top of this file. Recurring holidays in a calendar are expanded for the
+// next couple of years from now.
+func readHolidays(path string, now time.Time, logger log15.Logger) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]string{}
+	if strings.HasSuffix(strings.ToLower(path), ".ics") {
+		calendar, err := parseICS(string(data))
+		if err != nil {
+			return nil, err
+		}
+		for _, top := range calendar.children {
+			for _, vevent := range top.children {
+				if vevent.name != "VEVENT" {
+					continue
+				}
+				name := strings.Replace(vevent.value("SUMMARY"), `\,`, ",", -1)
+				periods, err := icsEventPeriods(vevent, nil, now.Add(-icsHorizon), now.Add(2*icsHorizon), homeLocation)
+				if err != nil {
+					logger.Warn("Skipping holiday", "summary", name, "err", err.Error())
+					continue
+				}
+				for _, period := range periods {
+					start := period.Start.In(homeLocation)
+					for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, homeLocation); day.Before(period.End); day = day.AddDate(0, 0, 1) {
+						found[day.Format(anchorDateFmt)] = name
+					}
+				}
+			}
+		}
+		return found, nil
+	}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		date, err := time.Parse(anchorDateFmt, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: unable to parse '%s' as a date like %s", line, fields[0], anchorDateFmt)
+		}
+		found[date.Format(anchorDateFmt)] = strings.Join(fields[1:], " ")
+	}
+	return found, nil
+}
+
+// exceptions lists the dates an event skips, in anchorDateFmt, holidays included if it asks for them
+func (e *GeneralEvent) exceptions() (map[string]bool, error) {
+	dates := map[string]bool{}
+	for _, value := range splitList(e.Except) {
+		if strings.EqualFold(value, holidaysKeyword) {
+			for date := range holidays {
+				dates[date] = true
+			}
+			continue
+		}
+		date, err := time.Parse(anchorDateFmt, value)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse exception '%s' of event '%s' as a date like %s or %s", value, e.Name, anchorDateFmt, holidaysKeyword)
+		}
+		dates[date.Format(anchorDateFmt)] = true
+	}
+	return dates, nil
+}
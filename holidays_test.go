@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// useHolidays switches the holidays for the rest of a test
+func useHolidays(t *testing.T, found map[string]string) {
+	previous := holidays
+	holidays = found
+	t.Cleanup(func() { holidays = previous })
+}
+
+// check that holidays are read from both text files and calendars
+func TestReadHolidays(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		expected map[string]string
+		fails    bool
+	}{
+		{
+			name:     "text",
+			file:     "holidays.txt",
+			contents: "# days off\n11/24/2022 Thanksgiving\n\n12/26/2022 Christmas, observed\n",
+			expected: map[string]string{"11/24/2022": "Thanksgiving", "12/26/2022": "Christmas, observed"},
+		},
+		{
+			name:     "bad line",
+			file:     "bad.txt",
+			contents: "11/24/2022 Thanksgiving\nTurkey day\n",
+			fails:    true,
+		},
+		{
+			name: "calendar",
+			file: "holidays.ics",
+			contents: strings.Join([]string{
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"DTSTART;VALUE=DATE:20221124",
+				"DTEND;VALUE=DATE:20221126",
+				"SUMMARY:Thanksgiving Break",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"DTSTART;VALUE=DATE:20221226",
+				"SUMMARY:Christmas\\, observed",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			}, "\r\n"),
+			expected: map[string]string{
+				"11/24/2022": "Thanksgiving Break",
+				"11/25/2022": "Thanksgiving Break",
+				"12/26/2022": "Christmas, observed",
+			},
+		},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.file)
+		if err := os.WriteFile(path, []byte(test.contents), 0644); err != nil {
+			t.Errorf("Unable to write %s: %s", path, err.Error())
+			t.FailNow()
+		}
+		found, err := readHolidays(path, mid, tLogger)
+		if (err != nil) != test.fails {
+			t.Errorf("Unexpected error state for %s: %v", test.name, err)
+			t.FailNow()
+		}
+		if len(found) != len(test.expected) {
+			t.Errorf("Holidays for %s didn't match;\nExpected: %v\nActual: %v", test.name, test.expected, found)
+			t.FailNow()
+		}
+		for date, name := range test.expected {
+			if found[date] != name {
+				t.Errorf("Holidays for %s didn't match;\nExpected: %v\nActual: %v", test.name, test.expected, found)
+				t.FailNow()
+			}
+		}
+	}
+}
+
+// check that exception dates and holidays only take back the time of the events that skip them
+func TestExceptionFreeTime(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	useHolidays(t, map[string]string{"11/28/2022": "Made up holiday"})
+	work := func(except string) *GeneralEvent {
+		return &GeneralEvent{Name: "Work", Rotation: "both", Days: "Mon-Fri", StartTime: 9, Duration: 8, Except: except}
+	}
+	sleeping := func(except string) *GeneralEvent {
+		return &GeneralEvent{Name: "Sleeping", Rotation: "both", Days: "Sun-Sat", StartTime: 23, Duration: 8, Except: except}
+	}
+	tests := []struct {
+		name        string
+		deadline    string
+		event       *GeneralEvent
+		busyMinutes int
+		fails       bool
+	}{
+		{name: "no exceptions", deadline: "16:00 11/28/2022 EST", event: work(""), busyMinutes: 8 * 60},
+		{name: "day off", deadline: "16:00 11/28/2022 EST", event: work("11/28/2022"), busyMinutes: 0},
+		{name: "other day off", deadline: "16:00 11/28/2022 EST", event: work("11/29/2022"), busyMinutes: 8 * 60},
+		{name: "holiday", deadline: "16:00 11/28/2022 EST", event: work("Holidays"), busyMinutes: 0},
+		// the fortnight after, less the holiday and a day out sick
+		{name: "later on", deadline: "18:00 12/09/2022 EST", event: work("holidays, 12/07/2022"), busyMinutes: 8 * 8 * 60},
+		// the rest of tonight after the hour that's starting, then Sunday night
+		{name: "sleeping", deadline: "16:00 11/28/2022 EST", event: sleeping(""), busyMinutes: 15 * 60},
+		// events that skip dates follow the calendar, which counts all of tonight, holiday or not
+		{name: "sleeping through holidays", deadline: "16:00 11/28/2022 EST", event: sleeping("12/25/2022"), busyMinutes: 16 * 60},
+		{name: "sleeping in", deadline: "16:00 11/28/2022 EST", event: sleeping("11/27/2022"), busyMinutes: 8 * 60},
+		{name: "bad date", deadline: "16:00 11/28/2022 EST", event: work("Thanksgiving"), fails: true},
+	}
+	for _, test := range tests {
+		if err := test.event.validate(); (err != nil) != test.fails {
+			t.Errorf("Unexpected error state for %s: %v", test.name, err)
+			t.FailNow()
+		}
+		if test.fails {
+			continue
+		}
+		report := &Task{Name: "Report", Deadline: test.deadline, EstimatedHours: 1}
+		err := report.calculateUrgency(mid, []*GeneralEvent{test.event}, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error calculating urgency for %s: %s", test.name, err.Error())
+			t.FailNow()
+		}
+		if report.BusyMinutes != test.busyMinutes {
+			t.Errorf("Busy time for %s didn't match;\nExpected: %d\nActual: %d", test.name, test.busyMinutes, report.BusyMinutes)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// The iCalendar (RFC 5545) export puts the rotation and task deadlines on a phone calendar. Each active event
+// becomes a weekly VEVENT repeating once a cycle from the prime Sunday, once for each week of the rotation it
+// happens in; dated deadlines become VTODOs and repeating deadlines become their own recurring VEVENTs.
+const (
+	icsFormat = "ics"
+	icsFile   = "Perspective.ics"
+
+	icsDateTimeFmt = "20060102T150405Z"
+	icsProdID      = "-//hoopahmadness//Perspective//EN"
+	// content lines longer than this many octets get folded
+	icsLineLength = 75
+)
+
+var icsWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// icsBuilder collects content lines and takes care of folding and line endings
+type icsBuilder struct {
+	lines []string
+	// zones are the TZIDs the times were written in, which each need a VTIMEZONE (see addTimezones)
+	zones []string
+}
+
+func (b *icsBuilder) add(name, value string) {
+	b.lines = append(b.lines, name+":"+value)
+}
+
+// addZoned adds t on the wall clock of the IANA zone zoneName, with its TZID
+func (b *icsBuilder) addZoned(name string, t time.Time, zoneName string) {
+	loc, _ := time.LoadLocation(zoneName) // ianaZoneName only gives names that load
+	b.add(name+";TZID="+zoneName, t.In(loc).Format(icsLocalTimeFmt))
+	for _, zone := range b.zones {
+		if zone == zoneName {
+			return
+		}
+	}
+	b.zones = append(b.zones, zoneName)
+}
+
+// addTimezones inserts a VTIMEZONE for each TZID used so far after the first header lines, since some clients
+// won't place a time whose zone hasn't been defined yet. Each one follows the zone's rules for the year of now.
+func (b *icsBuilder) addTimezones(header int, now time.Time) {
+	zones := &icsBuilder{}
+	for _, zoneName := range b.zones {
+		loc, _ := time.LoadLocation(zoneName) // see addZoned
+		zones.add("BEGIN", "VTIMEZONE")
+		zones.add("TZID", zoneName)
+		year := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, loc)
+		transitions := zoneTransitions(year, year.AddDate(1, 0, 0))
+		if len(transitions) == 0 {
+			// no daylight saving time, the zone is always on the same offset
+			name, offset := year.Zone()
+			addTimezoneRule(zones, "STANDARD", name, offset, offset, "19700101T000000", "")
+		}
+		for _, change := range transitions {
+			_, before := change.Add(-time.Second).Zone()
+			name, after := change.Zone()
+			kind := "STANDARD"
+			if change.IsDST() {
+				kind = "DAYLIGHT"
+			}
+			// the change happens on the wall clock it's leaving, on the same day of the month every year
+			wall := change.UTC().Add(time.Duration(before) * time.Second)
+			week := (wall.Day()-1)/7 + 1
+			if wall.AddDate(0, 0, 7).Month() != wall.Month() {
+				week = -1
+			}
+			first := nthWeekday(1970, wall.Month(), wall.Weekday(), week)
+			start := time.Date(1970, wall.Month(), first, wall.Hour(), wall.Minute(), wall.Second(), 0, time.UTC)
+			rule := fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", wall.Month(), week, icsWeekdays[wall.Weekday()])
+			addTimezoneRule(zones, kind, name, before, after, start.Format(icsLocalTimeFmt), rule)
+		}
+		zones.add("END", "VTIMEZONE")
+	}
+	b.lines = append(append(append([]string{}, b.lines[:header]...), zones.lines...), b.lines[header:]...)
+}
+
+func addTimezoneRule(b *icsBuilder, kind, name string, before, after int, start, rule string) {
+	b.add("BEGIN", kind)
+	b.add("DTSTART", start)
+	if rule != "" {
+		b.add("RRULE", rule)
+	}
+	b.add("TZOFFSETFROM", icsOffset(before))
+	b.add("TZOFFSETTO", icsOffset(after))
+	b.add("TZNAME", icsEscape(name))
+	b.add("END", kind)
+}
+
+// icsOffset writes an offset from UTC in seconds like -0500, or +0530
+func icsOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	if offset%60 != 0 {
+		return fmt.Sprintf("%s%02d%02d%02d", sign, offset/3600, offset/60%60, offset%60)
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+}
+
+// zoneTransitions lists the moments from up to until when from's zone changes its offset, to the second
+func zoneTransitions(from, until time.Time) []time.Time {
+	transitions := []time.Time{}
+	for day := from; day.Before(until); {
+		next := day.Add(24 * time.Hour)
+		_, dayOffset := day.Zone()
+		if _, nextOffset := next.Zone(); nextOffset != dayOffset {
+			low, high := day, next
+			for high.Sub(low) > time.Second {
+				middle := low.Add(high.Sub(low) / 2).Truncate(time.Second)
+				if _, offset := middle.Zone(); offset == dayOffset {
+					low = middle
+				} else {
+					high = middle
+				}
+			}
+			transitions = append(transitions, high)
+		}
+		day = next
+	}
+	return transitions
+}
+
+// nthWeekday is the day of the month of the week'th weekday in it, counting back from the end when week is -1
+func nthWeekday(year int, month time.Month, weekday time.Weekday, week int) int {
+	if week < 0 {
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+		return last.Day() - (int(last.Weekday())-int(weekday)+7)%7
+	}
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	return 1 + (int(weekday)-int(first.Weekday())+7)%7 + (week-1)*7
+}
+
+func (b *icsBuilder) String() string {
+	out := ""
+	for _, line := range b.lines {
+		for len(line) > icsLineLength {
+			cut := icsLineLength
+			// don't split a multi-byte character
+			for cut > 0 && line[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			out += line[:cut] + "\r\n"
+			line = " " + line[cut:]
+		}
+		out += line + "\r\n"
+	}
+	return out
+}
+
+func icsEscape(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	return replacer.Replace(text)
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format(icsDateTimeFmt)
+}
+
+// icsUID gives each calendar component a UID that stays the same from one refresh to the next
+func icsUID(parts ...string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(parts, "\x00"))))[:16] + "@perspective"
+}
+
+// taskUID is the UID a task is published under, in the .ics export and feed as well as on CalDAV servers. Tasks
+// that came from Taskwarrior keep their UUID.
+func taskUID(task *Task) string {
+	if task.UUID != "" {
+		return task.UUID
+	}
+	return icsUID("VTODO", task.Name)
+}
+
+// addRotationComponents adds one recurring component per rotation week, starting on the first of the listed days
+// in that week of the prime rotation and repeating once every cycle. startMinute, counted from midnight, is on the
+// clock of loc; when loc has an IANA name the times are written with its TZID (see addZoned) so the recurrence keeps
+// to the wall clock across daylight saving time, otherwise they're written in UTC. When active has a start the
+// recurrence starts with the first of these that's on or after it, and when it has an end the recurrence stops there.
+// Occurrences on the except dates (in anchorDateFmt) are left out with EXDATEs.
+func addRotationComponents(b *icsBuilder, component, summary string, days []time.Weekday, weekRotation rotation, startMinute int, duration time.Duration, active busyPeriod, except map[string]bool, now time.Time, loc *time.Location) {
+	if len(days) == 0 {
+		return
+	}
+	zoneName := ianaZoneName(loc)
+	addTime := func(name string, wall int) {
+		if zoneName != "" {
+			b.addZoned(name, fromWallMinutes(wall, loc), zoneName)
+			return
+		}
+		b.add(name, icsTime(fromWallMinutes(wall, loc)))
+	}
+	sorted := append([]time.Weekday{}, days...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	byDay := []string{}
+	for index, day := range sorted {
+		if index > 0 && day == sorted[index-1] {
+			continue
+		}
+		byDay = append(byDay, icsWeekdays[day])
+	}
+	onDay := map[time.Weekday]bool{}
+	for _, day := range days {
+		onDay[day] = true
+	}
+	skipped := []int{}
+	for value := range except {
+		date, err := time.Parse(anchorDateFmt, value)
+		if err != nil || !onDay[date.Weekday()] {
+			continue
+		}
+		skipped = append(skipped, wallMinutes(date)+startMinute)
+	}
+	sort.Ints(skipped)
+	weeks, _ := weekRotation.weeks()
+	for _, week := range weeks {
+		start := (primeWallHours()+week*weekHours+int(sorted[0])*24)*60 + startMinute
+		if !active.Start.IsZero() {
+			// skip whole cycles that start before the event is active
+			cycles := -floorDiv(start-wallMinutes(active.Start.In(loc)), cycleMinutes())
+			if cycles > 0 {
+				start += cycles * cycleMinutes()
+			}
+		}
+		b.add("BEGIN", component)
+		b.add("UID", icsUID(component, summary, fmt.Sprint(week)))
+		b.add("DTSTAMP", icsTime(now))
+		addTime("DTSTART", start)
+		if duration > 0 {
+			addTime("DTEND", start+int(duration/time.Minute))
+		}
+		rule := fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;WKST=SU;BYDAY=%s", cycle.Weeks, strings.Join(byDay, ","))
+		if !active.End.IsZero() {
+			rule += ";UNTIL=" + icsTime(active.End)
+		}
+		b.add("RRULE", rule)
+		for _, wall := range skipped {
+			inWeek := floorDiv(wall-primeWallHours()*60, weekHours*60) % cycle.Weeks
+			if inWeek < 0 {
+				inWeek += cycle.Weeks
+			}
+			if inWeek == week && wall >= start {
+				addTime("EXDATE", wall)
+			}
+		}
+		b.add("SUMMARY", icsEscape(summary))
+		b.add("END", component)
+	}
+}
+
+// outputICS builds the calendar for the active events and the deadlines of sorted tasks
+func outputICS(now time.Time, events []*GeneralEvent, tasks []*Task, topLogger log15.Logger) string {
+	return outputICSWithWork(now, events, tasks, nil, topLogger)
+}
+
+// outputICSWithWork is outputICS plus the suggested work blocks (see suggestWorkBlocks)
+func outputICSWithWork(now time.Time, events []*GeneralEvent, tasks []*Task, work []workBlock, topLogger log15.Logger) string {
+	b := &icsBuilder{}
+	b.add("BEGIN", "VCALENDAR")
+	b.add("VERSION", "2.0")
+	b.add("PRODID", icsProdID)
+	b.add("CALSCALE", "GREGORIAN")
+	b.add("X-WR-CALNAME", "Perspective")
+	header := len(b.lines)
+	for _, event := range events {
+		logger := topLogger.New("event", event.Name, "function", "outputICS")
+		if event.Inactive {
+			continue
+		}
+		if err := event.validate(); err != nil {
+			logger.Warn("Leaving invalid event off the calendar", "err", err.Error())
+			continue
+		}
+		if event.isDated() {
+			periods, _ := event.periods() // validated above
+			for _, period := range periods {
+				b.add("BEGIN", "VEVENT")
+				b.add("UID", icsUID("VEVENT", event.Name, icsTime(period.Start)))
+				b.add("DTSTAMP", icsTime(now))
+				b.add("DTSTART", icsTime(period.Start))
+				b.add("DTEND", icsTime(period.End))
+				b.add("SUMMARY", icsEscape(event.Name))
+				b.add("END", "VEVENT")
+			}
+			continue
+		}
+		days, err := parseDayStrings(event.Days)
+		if err != nil {
+			logger.Warn("Leaving event with bad days off the calendar", "err", err.Error())
+			continue
+		}
+		loc := now.Location()
+		if event.Zone != "" {
+			loc, _ = time.LoadLocation(event.Zone) // validated above
+		}
+		active, _ := event.activeWindow() // validated above
+		except, _ := event.exceptions()
+		addRotationComponents(b, "VEVENT", event.Name, days, event.Rotation, event.startMinutes(), time.Duration(event.lengthMinutes())*time.Minute, active, except, now, loc)
+	}
+	for _, task := range tasks {
+		logger := topLogger.New("task", task.Name, "function", "outputICS")
+		if isRuleDeadline(task.Deadline) {
+			rule, err := parseDeadlineRule(task.Deadline, now.Location())
+			if err != nil || task.DeadlineTime.IsZero() {
+				logger.Warn("Leaving task with bad deadline off the calendar", "deadline", task.Deadline)
+				continue
+			}
+			// start from the next deadline, on its own clock so it keeps to it across daylight saving time
+			b.add("BEGIN", "VEVENT")
+			b.add("UID", icsUID("VEVENT", "Due: "+task.Name))
+			b.add("DTSTAMP", icsTime(now))
+			if zoneName := ianaZoneName(now.Location()); zoneName != "" {
+				b.addZoned("DTSTART", task.DeadlineTime, zoneName)
+			} else {
+				b.add("DTSTART", icsTime(task.DeadlineTime))
+			}
+			b.add("RRULE", rule.rrule())
+			b.add("SUMMARY", icsEscape("Due: "+task.Name))
+			b.add("END", "VEVENT")
+			continue
+		}
+		if !isDatedDeadline(task.Deadline) {
+			hour, weekRotation, days, err := task.parseRepeatingDays(logger)
+			if err != nil {
+				logger.Warn("Leaving task with bad deadline off the calendar", "err", err.Error())
+				continue
+			}
+			_, minute, _ := parseClock(strings.Fields(task.Deadline)[0])
+			addRotationComponents(b, "VEVENT", "Due: "+task.Name, days, weekRotation, hour*60+minute, 0, busyPeriod{}, nil, now, now.Location())
+			continue
+		}
+		if task.DeadlineTime.IsZero() {
+			continue
+		}
+		b.add("BEGIN", "VTODO")
+		b.add("UID", taskUID(task))
+		b.add("DTSTAMP", icsTime(now))
+		b.add("DUE", icsTime(task.DeadlineTime))
+		b.add("SUMMARY", icsEscape(task.Name))
+		b.add("DESCRIPTION", icsEscape(fmt.Sprintf("Urgency %.2f%%, %s free hours left", task.Urgency*100, formatHours(task.FreeMinutes))))
+		if task.isComplete() {
+			b.add("STATUS", "COMPLETED")
+		} else {
+			b.add("STATUS", "NEEDS-ACTION")
+		}
+		b.add("END", "VTODO")
+	}
+	for _, block := range work {
+		b.add("BEGIN", "VEVENT")
+		b.add("UID", icsUID("work", block.Task, icsTime(block.Start)))
+		b.add("DTSTAMP", icsTime(now))
+		b.add("DTSTART", icsTime(block.Start))
+		b.add("DTEND", icsTime(block.End))
+		b.add("SUMMARY", icsEscape("Work on: "+block.Task))
+		b.add("TRANSP", "TRANSPARENT")
+		b.add("END", "VEVENT")
+	}
+	b.addTimezones(header, now)
+	b.add("END", "VCALENDAR")
+	return b.String()
+}
+
+// writeICSFile regenerates the calendar next to the To Do List
+func writeICSFile(now time.Time, events []*GeneralEvent, tasks []*Task, logger log15.Logger) {
+	err := os.WriteFile(notesDir(logger)+"/"+icsFile, []byte(outputICS(now, events, tasks, logger)), 0644)
+	if err != nil {
+		logger.Error("Error writing calendar file", "err", err.Error())
+		return
+	}
+	logger.Debug("Updated calendar file")
+}
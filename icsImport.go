@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Busy time can also come from calendars exported as .ics files. PERSPECTIVE_ICS lists files, or directories of
+// .ics files, separated like PATH. Every busy VEVENT in them is expanded into dated busy periods that take hours away
+// alongside the rotation events.
+const (
+	icsDateFmt      = "20060102"
+	icsLocalTimeFmt = "20060102T150405"
+
+	// how far ahead recurring calendar events are expanded
+	icsHorizon = 366 * 24 * time.Hour
+)
+
+// icsComponent is a BEGIN/END block of a calendar, such as a VEVENT, with its properties and nested components
+type icsComponent struct {
+	name       string
+	properties []icsProperty
+	children   []*icsComponent
+}
+
+type icsProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICS reads a calendar file into its components, unfolding long lines on the way
+func parseICS(data string) (*icsComponent, error) {
+	data = strings.Replace(data, "\r\n", "\n", -1)
+	data = strings.Replace(data, "\n ", "", -1)
+	data = strings.Replace(data, "\n\t", "", -1)
+	root := &icsComponent{}
+	stack := []*icsComponent{root}
+	for index, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseICSLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", index+1, err.Error())
+		}
+		current := stack[len(stack)-1]
+		switch prop.name {
+		case "BEGIN":
+			child := &icsComponent{name: strings.ToUpper(prop.value)}
+			current.children = append(current.children, child)
+			stack = append(stack, child)
+		case "END":
+			if len(stack) == 1 || current.name != strings.ToUpper(prop.value) {
+				return nil, fmt.Errorf("line %d: END:%s doesn't match BEGIN:%s", index+1, prop.value, current.name)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			current.properties = append(current.properties, prop)
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("calendar ends inside %s", stack[len(stack)-1].name)
+	}
+	return root, nil
+}
+
+// parseICSLine splits NAME;PARAM=VALUE:value, minding quoted parameter values that might contain ':' or ';'
+func parseICSLine(line string) (icsProperty, error) {
+	prop := icsProperty{params: map[string]string{}}
+	inQuotes := false
+	colon := -1
+	for index, char := range line {
+		if char == '"' {
+			inQuotes = !inQuotes
+		}
+		if char == ':' && !inQuotes {
+			colon = index
+			break
+		}
+	}
+	if colon == -1 {
+		return prop, fmt.Errorf("'%s' has no value", line)
+	}
+	prop.value = line[colon+1:]
+	parts := strings.Split(line[:colon], ";")
+	prop.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		keyValue := strings.SplitN(param, "=", 2)
+		if len(keyValue) == 2 {
+			prop.params[strings.ToUpper(keyValue[0])] = strings.Trim(keyValue[1], `"`)
+		}
+	}
+	return prop, nil
+}
+
+func (c *icsComponent) get(name string) *icsProperty {
+	for index := range c.properties {
+		if c.properties[index].name == name {
+			return &c.properties[index]
+		}
+	}
+	return nil
+}
+
+func (c *icsComponent) all(name string) []icsProperty {
+	props := []icsProperty{}
+	for _, prop := range c.properties {
+		if prop.name == name {
+			props = append(props, prop)
+		}
+	}
+	return props
+}
+
+func (c *icsComponent) value(name string) string {
+	prop := c.get(name)
+	if prop == nil {
+		return ""
+	}
+	return prop.value
+}
+
+// parseICSTime understands UTC times, times with a TZID, floating times (which are in home) and plain dates
+func parseICSTime(value string, params map[string]string, home *time.Location) (time.Time, error) {
+	loc := home
+	if tzid := params["TZID"]; tzid != "" {
+		tzLoc, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID '%s'", tzid)
+		}
+		loc = tzLoc
+	}
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse(icsDateTimeFmt, value)
+	case len(value) == len(icsDateFmt):
+		return time.ParseInLocation(icsDateFmt, value, loc)
+	default:
+		return time.ParseInLocation(icsLocalTimeFmt, value, loc)
+	}
+}
+
+// parseISODuration reads an RFC 5545 / ISO 8601 duration such as PT1H30M or P1D
+func parseISODuration(value string) (time.Duration, error) {
+	negative := strings.HasPrefix(value, "-")
+	matches := isoDurationMatcher.FindStringSubmatch(strings.TrimLeft(value, "+-"))
+	if matches == nil || strings.TrimLeft(value, "+-") == "P" {
+		return 0, fmt.Errorf("Unable to parse '%s' as a duration", value)
+	}
+	total := time.Duration(0)
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	for index, unit := range units {
+		if matches[index+1] == "" {
+			continue
+		}
+		num, _ := strconv.Atoi(matches[index+1])
+		total += time.Duration(num) * unit
+	}
+	if negative {
+		total = -total
+	}
+	return total, nil
+}
+
+// icsBusyEvents turns the busy VEVENTs of a calendar into dated GeneralEvents, with recurrences expanded from
+// before now until the horizon. Free, cancelled and transparent events are left out.
+func icsBusyEvents(calendar *icsComponent, now time.Time, home *time.Location, topLogger log15.Logger) []*GeneralEvent {
+	vevents := []*icsComponent{}
+	for _, top := range calendar.children {
+		for _, child := range top.children {
+			if child.name == "VEVENT" {
+				vevents = append(vevents, child)
+			}
+		}
+	}
+	// instances moved or cancelled individually show up as their own VEVENT with a RECURRENCE-ID
+	overridden := map[string]map[int64]bool{}
+	for _, vevent := range vevents {
+		recurrenceID := vevent.get("RECURRENCE-ID")
+		if recurrenceID == nil {
+			continue
+		}
+		instance, err := parseICSTime(recurrenceID.value, recurrenceID.params, home)
+		if err != nil {
+			continue
+		}
+		uid := vevent.value("UID")
+		if overridden[uid] == nil {
+			overridden[uid] = map[int64]bool{}
+		}
+		overridden[uid][instance.Unix()] = true
+	}
+	from := now.Add(-24 * time.Hour)
+	until := now.Add(icsHorizon)
+	events := []*GeneralEvent{}
+	for _, vevent := range vevents {
+		logger := topLogger.New("summary", vevent.value("SUMMARY"), "uid", vevent.value("UID"))
+		if !icsIsBusy(vevent) {
+			logger.Debug("Skipping calendar event that isn't busy")
+			continue
+		}
+		periods, err := icsEventPeriods(vevent, overridden[vevent.value("UID")], from, until, home)
+		if err != nil {
+			logger.Warn("Skipping calendar event", "err", err.Error())
+			continue
+		}
+		if len(periods) == 0 {
+			continue
+		}
+		name := vevent.value("SUMMARY")
+		if name == "" {
+			name = "Busy"
+		}
+		events = append(events, &GeneralEvent{
+			Name:    strings.Replace(name, `\,`, ",", -1),
+			Periods: periods,
+		})
+	}
+	return events
+}
+
+func icsIsBusy(vevent *icsComponent) bool {
+	if strings.ToUpper(vevent.value("STATUS")) == "CANCELLED" {
+		return false
+	}
+	if strings.ToUpper(vevent.value("TRANSP")) == "TRANSPARENT" {
+		return false
+	}
+	if strings.ToUpper(vevent.value("X-MICROSOFT-CDO-BUSYSTATUS")) == "FREE" {
+		return false
+	}
+	return true
+}
+
+// icsEventPeriods expands one VEVENT into the busy periods that overlap from..until
+func icsEventPeriods(vevent *icsComponent, overridden map[int64]bool, from, until time.Time, home *time.Location) ([]busyPeriod, error) {
+	dtstart := vevent.get("DTSTART")
+	if dtstart == nil {
+		return nil, fmt.Errorf("event has no DTSTART")
+	}
+	start, err := parseICSTime(dtstart.value, dtstart.params, home)
+	if err != nil {
+		return nil, fmt.Errorf("DTSTART: %s", err.Error())
+	}
+	allDay := dtstart.params["VALUE"] == "DATE" || len(dtstart.value) == len(icsDateFmt)
+	length := time.Duration(0)
+	if dtend := vevent.get("DTEND"); dtend != nil {
+		end, err := parseICSTime(dtend.value, dtend.params, home)
+		if err != nil {
+			return nil, fmt.Errorf("DTEND: %s", err.Error())
+		}
+		length = end.Sub(start)
+	} else if duration := vevent.value("DURATION"); duration != "" {
+		length, err = parseISODuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("DURATION: %s", err.Error())
+		}
+	} else if allDay {
+		length = 24 * time.Hour
+	}
+	starts := []time.Time{start}
+	if rrule := vevent.value("RRULE"); rrule != "" && vevent.get("RECURRENCE-ID") == nil {
+		rule, err := parseRRule(rrule)
+		if err != nil {
+			return nil, err
+		}
+		// anything starting a whole length before from is over by then
+		starts = rule.occurrences(start, from.Add(-length), until)
+	}
+	for _, rdate := range vevent.all("RDATE") {
+		for _, value := range strings.Split(rdate.value, ",") {
+			extra, err := parseICSTime(value, rdate.params, start.Location())
+			if err != nil {
+				continue
+			}
+			if rdate.params["VALUE"] == "DATE" || len(value) == len(icsDateFmt) {
+				// a plain date adds an instance at the usual time on that day
+				extra = time.Date(extra.Year(), extra.Month(), extra.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+			}
+			starts = append(starts, extra)
+		}
+	}
+	excluded := map[int64]bool{}
+	for instance := range overridden {
+		excluded[instance] = true
+	}
+	for _, exdate := range vevent.all("EXDATE") {
+		for _, value := range strings.Split(exdate.value, ",") {
+			exclude, err := parseICSTime(value, exdate.params, start.Location())
+			if err != nil {
+				return nil, fmt.Errorf("EXDATE: %s", err.Error())
+			}
+			if len(value) == len(icsDateFmt) {
+				// a plain date excludes the instance on that day
+				exclude = time.Date(exclude.Year(), exclude.Month(), exclude.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+			}
+			excluded[exclude.Unix()] = true
+		}
+	}
+	periods := []busyPeriod{}
+	for _, instance := range starts {
+		if excluded[instance.Unix()] && vevent.get("RECURRENCE-ID") == nil {
+			continue
+		}
+		end := instance.Add(length)
+		if allDay {
+			// all day events cover whole days of wall clock time, however long those days are
+			end = time.Date(instance.Year(), instance.Month(), instance.Day()+int((length+time.Hour)/(24*time.Hour)), 0, 0, 0, 0, instance.Location())
+		}
+		if !end.After(from) || instance.After(until) {
+			continue
+		}
+		periods = append(periods, busyPeriod{Start: instance, End: end})
+	}
+	return periods, nil
+}
+
+// readBusyCalendars loads every calendar listed in PERSPECTIVE_ICS
+func readBusyCalendars(now time.Time, topLogger log15.Logger) []*GeneralEvent {
+	events := []*GeneralEvent{}
+	for _, path := range filepath.SplitList(os.Getenv("PERSPECTIVE_ICS")) {
+		files := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			files, _ = filepath.Glob(filepath.Join(path, "*.ics"))
+		}
+		for _, file := range files {
+			logger := topLogger.New("calendar", file)
+			data, err := os.ReadFile(file)
+			if err != nil {
+				logger.Error("Unable to read calendar", "err", err.Error())
+				continue
+			}
+			calendar, err := parseICS(string(data))
+			if err != nil {
+				logger.Error("Unable to parse calendar", "err", err.Error())
+				continue
+			}
+			busy := icsBusyEvents(calendar, now, homeLocation, logger)
+			logger.Debug("Read busy time from calendar", "events", len(busy))
+			events = append(events, busy...)
+		}
+	}
+	return events
+}
+
+// withBusyCalendars adds calendar busy time to the events used for ranking. The calendar events are kept out of
+// the original list so they never get written into the To Do List.
+func withBusyCalendars(events []*GeneralEvent, now time.Time, logger log15.Logger) []*GeneralEvent {
+	combined := append([]*GeneralEvent{}, events...)
+	return append(combined, readBusyCalendars(now, logger)...)
+}
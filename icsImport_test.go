@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that recurring, excluded, zoned, all day and free calendar events turn into the right busy periods
+func TestICSBusyEvents(t *testing.T) {
+	tLogger := log15.New()
+	now := time.Date(2022, 11, 1, 12, 0, 0, 0, time.UTC)
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"SUMMARY:Team Standup",
+		"DTSTART;TZID=America/New_York:20221031T093000",
+		"DTEND;TZID=America/New_York:20221031T094500",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=5",
+		"EXDATE;TZID=America/New_York:20221102T093000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:standup",
+		"SUMMARY:Team Standup (moved)",
+		"RECURRENCE-ID;TZID=America/New_York:20221107T093000",
+		"DTSTART;TZID=America/New_York:20221107T140000",
+		"DTEND;TZID=America/New_York:20221107T141500",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:offsite",
+		"SUMMARY:Offsite",
+		"DTSTART;VALUE=DATE:20221110",
+		"DTEND;VALUE=DATE:20221112",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:lunch",
+		"SUMMARY:Lunch",
+		"DTSTART:20221103T170000Z",
+		"DURATION:PT1H",
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	root, err := parseICS(calendar)
+	if err != nil {
+		t.Errorf("Unexpected error parsing calendar: %s", err.Error())
+		t.FailNow()
+	}
+	events := icsBusyEvents(root, now, time.UTC, tLogger)
+	if len(events) != 3 {
+		t.Errorf("Expected standup, the moved standup and the offsite, got %d events", len(events))
+		t.FailNow()
+	}
+	newYork, _ := time.LoadLocation("America/New_York")
+	expectedStandups := []time.Time{
+		time.Date(2022, 10, 31, 9, 30, 0, 0, newYork),
+		// 11/02 is excluded and 11/07 was moved, so it's 11/09 and 11/14 (after clocks change) next
+		time.Date(2022, 11, 9, 9, 30, 0, 0, newYork),
+		time.Date(2022, 11, 14, 9, 30, 0, 0, newYork),
+	}
+	standups := events[0].Periods
+	if len(standups) != 3 || !standups[0].Start.Equal(expectedStandups[0]) || !standups[1].Start.Equal(expectedStandups[1]) || !standups[2].Start.Equal(expectedStandups[2]) {
+		t.Errorf("Standups didn't match;\nExpected: %v\nActual: %v", expectedStandups, standups)
+		t.FailNow()
+	}
+	if standups[1].Start.UTC().Hour() != 14 || standups[1].End.Sub(standups[1].Start) != 15*time.Minute {
+		t.Errorf("Standup after the clocks changed should be 14:30 UTC for 15 minutes, got %v", standups[1])
+	}
+	moved := events[1].Periods
+	if len(moved) != 1 || moved[0].Start.Hour() != 14 {
+		t.Errorf("Moved standup didn't match: %v", moved)
+	}
+	offsite := events[2].Periods
+	if len(offsite) != 1 || offsite[0].End.Sub(offsite[0].Start) != 48*time.Hour {
+		t.Errorf("Offsite should block two whole days, got %v", offsite)
+	}
+}
+
+// check that extra dates keep their own time of day, and plain ones borrow the event's
+func TestICSRDates(t *testing.T) {
+	tLogger := log15.New()
+	now := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:review",
+		"SUMMARY:Review",
+		"DTSTART:20221101T090000Z",
+		"DTEND:20221101T100000Z",
+		"RDATE:20221103T150000Z,20221104T113000Z",
+		"RDATE;VALUE=DATE:20221105",
+		"RDATE;TZID=America/New_York:20221107T080000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	root, err := parseICS(calendar)
+	if err != nil {
+		t.Errorf("Unexpected error parsing calendar: %s", err.Error())
+		t.FailNow()
+	}
+	events := icsBusyEvents(root, now, time.UTC, tLogger)
+	if len(events) != 1 {
+		t.Errorf("Expected one event, got %d", len(events))
+		t.FailNow()
+	}
+	expected := []time.Time{
+		time.Date(2022, 11, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2022, 11, 3, 15, 0, 0, 0, time.UTC),
+		time.Date(2022, 11, 4, 11, 30, 0, 0, time.UTC),
+		time.Date(2022, 11, 5, 9, 0, 0, 0, time.UTC),
+		time.Date(2022, 11, 7, 13, 0, 0, 0, time.UTC),
+	}
+	periods := events[0].Periods
+	if len(periods) != len(expected) {
+		t.Errorf("Reviews didn't match;\nExpected: %v\nActual: %v", expected, periods)
+		t.FailNow()
+	}
+	for index, period := range periods {
+		if !period.Start.Equal(expected[index]) || period.End.Sub(period.Start) != time.Hour {
+			t.Errorf("Review didn't match;\nExpected: %v for an hour\nActual: %v", expected[index], period)
+		}
+	}
+}
+
+// check that calendar busy time comes out of a task's free hours, on top of the rotation
+func TestICSBusyHoursUrgency(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	meetingStart := mid.Add(12 * time.Hour).UTC()
+	calendar := fmt.Sprintf("BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:a\nSUMMARY:Meeting\nDTSTART:%s\nDTEND:%s\nEND:VEVENT\nEND:VCALENDAR\n",
+		meetingStart.Format(icsDateTimeFmt), meetingStart.Add(90*time.Minute).Format(icsDateTimeFmt))
+	root, err := parseICS(calendar)
+	if err != nil {
+		t.Errorf("Unexpected error parsing calendar: %s", err.Error())
+		t.FailNow()
+	}
+	busy := icsBusyEvents(root, mid, time.UTC, tLogger)
+	report1, _, _ := createThreeTasks()
+	err = report1.calculateUrgency(mid, busy, tLogger)
+	if err != nil {
+		t.Errorf("Unexpected error calculating urgency: %s", err.Error())
+		t.FailNow()
+	}
+	// 42 hours until the deadline with nothing else going on; the meeting takes an hour and a half of them
+	if report1.FreeMinutes != 2430 || report1.BusyMinutes != 90 {
+		t.Errorf("Expected 2430 free and 90 busy minutes, got %d and %d", report1.FreeMinutes, report1.BusyMinutes)
+	}
+	if report1.RemainingHours != 40 || report1.BusyHours != 1 {
+		t.Errorf("Expected 40 free and 1 busy hours, got %d and %d", report1.RemainingHours, report1.BusyHours)
+	}
+}
+
+// check monthly and yearly recurrences with ordinal weekdays and month days
+func TestRecurrenceOccurrences(t *testing.T) {
+	start := time.Date(2022, 11, 25, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule     string
+		expected []string
+	}{
+		{rule: "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", expected: []string{"11/25", "12/30", "01/27"}},
+		{rule: "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=4", expected: []string{"11/25", "11/30", "12/01", "12/31"}},
+		{rule: "FREQ=DAILY;INTERVAL=3;UNTIL=20221204T000000Z", expected: []string{"11/25", "11/28", "12/01"}},
+		{rule: "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=29;COUNT=2", expected: []string{"11/25", "02/29"}},
+	}
+	for _, test := range tests {
+		rule, err := parseRRule(test.rule)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %s", test.rule, err.Error())
+			continue
+		}
+		actual := []string{}
+		for _, occurrence := range rule.occurrences(start, start, start.AddDate(5, 0, 0)) {
+			actual = append(actual, occurrence.Format("01/02"))
+		}
+		if strings.Join(actual, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("Occurrences of '%s' didn't match;\nExpected: %v\nActual: %v", test.rule, test.expected, actual)
+		}
+	}
+	// open ended rules from long ago still come up in a window today
+	from := time.Date(2022, 11, 26, 0, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		rule     string
+		dtstart  time.Time
+		expected []string
+	}{
+		{rule: "FREQ=DAILY", dtstart: time.Date(1990, 1, 1, 9, 0, 0, 0, time.UTC), expected: []string{"11/26", "11/27", "11/28"}},
+		{rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SA", dtstart: time.Date(1970, 1, 3, 9, 0, 0, 0, time.UTC), expected: []string{"11/26"}},
+		{rule: "FREQ=DAILY;COUNT=3", dtstart: time.Date(2022, 11, 25, 9, 0, 0, 0, time.UTC), expected: []string{"11/26", "11/27"}},
+	} {
+		rule, _ := parseRRule(test.rule)
+		actual := []string{}
+		for _, occurrence := range rule.occurrences(test.dtstart, from, from.AddDate(0, 0, 3)) {
+			actual = append(actual, occurrence.Format("01/02"))
+		}
+		if strings.Join(actual, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("Occurrences of '%s' from %s didn't match;\nExpected: %v\nActual: %v", test.rule, test.dtstart, test.expected, actual)
+		}
+	}
+	_, err := parseRRule("FREQ=WEEKLY;BYDAY=XX")
+	if err == nil || !strings.Contains(err.Error(), "'XX'") {
+		t.Errorf("Expected an error naming 'XX', got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that rotation events and deadlines become fortnightly recurrences anchored on the prime Sunday
+func TestOutputICS(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	events := []*GeneralEvent{
+		{Name: "Conjugate, study group", Rotation: secondWeek, Days: "Thur, Tue", StartTime: 16, Duration: 2},
+		{Name: "sleeping", Rotation: bothWeeks, Days: "Sun-Sat", StartTime: 23, Duration: 8, Inactive: true},
+		{Name: "Fall class", Rotation: firstWeek, Days: "Mon", StartTime: 10, Duration: 1, ActiveFrom: "11/14/2022", ActiveUntil: "12/16/2022"},
+		{Name: "Team lunch", Rotation: bothWeeks, Days: "Mon", StartTime: 12, Duration: 1, Except: "11/28/2022, 11/21/2022, 11/22/2022"},
+	}
+	bookClub := &Task{Name: "Read For Book Club", Deadline: "18:00 first Tuesday", EstimatedHours: 1}
+	rent := &Task{Name: "Pay rent", Deadline: "09:00 the 1st", EstimatedHours: 1}
+	report1, _, _ := createThreeTasks()
+	report1.UUID = "c5f7e6a2-3b8d-4e1f-9a0b-2d4c6e8f0a1b" // from Taskwarrior, so it's published under the same UID as on CalDAV
+	tasks := []*Task{bookClub, rent, report1}
+	sortTasks(tasks, mid, events, tLogger)
+	calendar := outputICS(mid, events, tasks, tLogger)
+	unfolded := strings.Replace(calendar, "\r\n ", "", -1)
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		// the second week of the prime rotation starts on 09/18/2022
+		"DTSTART:20220920T160000Z\r\nDTEND:20220920T180000Z\r\nRRULE:FREQ=WEEKLY;INTERVAL=2;WKST=SU;BYDAY=TU,TH\r\nSUMMARY:Conjugate\\, study group\r\n",
+		"DTSTART:20220913T180000Z\r\nRRULE:FREQ=WEEKLY;INTERVAL=2;WKST=SU;BYDAY=TU\r\nSUMMARY:Due: Read For Book Club\r\n",
+		// 11/14 is in the second week, so the class starts on the Monday after and stops with the semester
+		"DTSTART:20221121T100000Z\r\nDTEND:20221121T110000Z\r\nRRULE:FREQ=WEEKLY;INTERVAL=2;WKST=SU;BYDAY=MO;UNTIL=20221217T000000Z\r\nSUMMARY:Fall class\r\n",
+		// each week's recurrence skips the Monday in that week, and there's no lunch on Tuesdays to skip
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;WKST=SU;BYDAY=MO\r\nEXDATE:20221121T120000Z\r\nSUMMARY:Team lunch\r\n",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;WKST=SU;BYDAY=MO\r\nEXDATE:20221128T120000Z\r\nSUMMARY:Team lunch\r\n",
+		// calendar deadlines start from the next one
+		"DTSTART:20221201T090000Z\r\nRRULE:FREQ=MONTHLY;BYMONTHDAY=1\r\nSUMMARY:Due: Pay rent\r\n",
+		"BEGIN:VTODO\r\nUID:c5f7e6a2-3b8d-4e1f-9a0b-2d4c6e8f0a1b\r\n",
+		"DUE:20221128T160000Z\r\nSUMMARY:Finish first book report for class\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(unfolded, expected) {
+			t.Errorf("Expected calendar to contain %q;\nActual:\n%s", expected, unfolded)
+		}
+	}
+	if strings.Contains(unfolded, "sleeping") {
+		t.Errorf("Inactive event made it onto the calendar")
+	}
+	for _, line := range strings.Split(calendar, "\r\n") {
+		if len(line) > icsLineLength {
+			t.Errorf("Line wasn't folded: %q", line)
+		}
+	}
+}
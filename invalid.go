@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// A typo in one task or event shouldn't stop everything else from being ranked. Tasks whose urgency can't be worked
+// out and events that don't make sense are set aside in an "Invalid Items" section at the top of the To Do List, each
+// with what's wrong with it underneath. They're read back like any other item, so once the mistake is fixed they go
+// back to where they belong on the next refresh. What's wrong is written as generated text that says whether the item
+// is a task or an event, since a task set aside for a mistake in its deadline can look just like an event.
+
+const (
+	invalidTaskLabel  = "Invalid task"
+	invalidEventLabel = "Invalid event"
+)
+
+// taskFieldKeys are the fields that tell a task from an event in the Invalid Items section when it doesn't say, like
+// when it's been moved there by hand
+var taskFieldKeys = map[string]bool{"Deadline": true, "Estimated Hours": true, "Repeat After": true}
+
+// rankableEvents marks the events that don't make sense as invalid and leaves them out
+func rankableEvents(genEvents []*GeneralEvent, logger log15.Logger) []*GeneralEvent {
+	valid := []*GeneralEvent{}
+	for _, event := range genEvents {
+		event.invalid = event.validate()
+		if event.invalid != nil {
+			logger.Warn("Unable to make sense of event, moving it to "+invalidItems, "event", event.Name, "err", event.invalid.Error())
+			continue
+		}
+		valid = append(valid, event)
+	}
+	return valid
+}
+
+// mdToInvalidItems reads the Invalid Items section back, telling the tasks from the events by what they're labelled
+func mdToInvalidItems(rawLines []string, lines []string, offsets []int, firstLine int, diags *diagnostics, logger log15.Logger) ([]*GeneralEvent, []*Task) {
+	events := []*GeneralEvent{}
+	tasks := []*Task{}
+	for start := 0; start < len(lines); {
+		end := start + 1
+		label, hasTaskFields := "", false
+		for end < len(lines) && offsets[end] > offsets[start] {
+			if genText := genTextMatcher.FindStringSubmatch(rawLines[end]); genText != nil {
+				label = strings.Split(genText[1], "; ")[0]
+			}
+			key, _, _ := splitField(lines[end])
+			hasTaskFields = hasTaskFields || taskFieldKeys[taskField(key)]
+			end++
+		}
+		isTask := label == invalidTaskLabel || (label != invalidEventLabel && hasTaskFields)
+		if isTask {
+			tasks = append(tasks, mdToTasks(rawLines[start:end], lines[start:end], offsets[start:end], firstLine+start, diags, logger)...)
+		} else {
+			events = append(events, mdToEvents(rawLines[start:end], lines[start:end], offsets[start:end], firstLine+start, diags, logger)...)
+		}
+		start = end
+	}
+	return events, tasks
+}
+
+// outputInvalid writes the Invalid Items section, or nothing if everything made sense
+func outputInvalid(events []*GeneralEvent, tasks []*Task) string {
+	outStr := ""
+	for _, task := range tasks {
+		if task.invalid == nil {
+			continue
+		}
+		if task.Raw == "" {
+			task.buildRaw()
+		}
+		outStr += task.Raw + fmt.Sprintf(genTextFmt, invalidTaskLabel+"; "+task.invalidMessage())
+	}
+	for _, event := range events {
+		if event.invalid == nil {
+			continue
+		}
+		if event.Raw == "" {
+			event.buildRaw()
+		}
+		outStr += "\n" + strings.TrimSuffix(event.Raw, "\n") + fmt.Sprintf(genTextFmt, invalidEventLabel+"; "+event.invalid.Error())
+	}
+	if outStr == "" {
+		return ""
+	}
+	outStr = fmt.Sprintf(headerLineFmt, invalidItems) + outStr
+	return strings.Replace(outStr, "\n\n", "\n", -1)
+}
+
+// invalidMessage is what's wrong with an invalid task without the line it was on, which is only right until the To Do
+// List is rewritten
+func (t *Task) invalidMessage() string {
+	return strings.TrimPrefix(t.invalid.Error(), fmt.Sprintf("Line %d: ", t.deadlineLine))
+}
+
+// errorText is the message of err, or empty if there wasn't one
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that a typo in one task or event sets it aside without stopping everything else from being ranked, and that
+// it goes back where it belongs once it's fixed
+func TestInvalidItems(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	events, tasks := mdToStructs([]string{
+		"- " + upcomingTasks,
+		"\t- Report",
+		"\t\t- Deadline; 16:00 11/28/2022",
+		"\t\t- Estimated Hours; 2",
+		"\t- Typo",
+		"\t\t- Deadline; 16:00 11/31/2022",
+		"\t\t- Estimated Hours; 1",
+		"- " + repeatingEvents,
+		"\t- Work",
+		"\t\t- Rotation; both",
+		"\t\t- Days; Mon-Fri",
+		"\t\t- Start Time; 9",
+		"\t\t- Duration; 8",
+		"\t- Gym",
+		"\t\t- Rotation; frist",
+		"\t\t- Days; Tue, Thur",
+		"\t\t- Start Time; 17",
+		"\t\t- Duration; 2",
+	}, tLogger)
+	sortTasks(tasks, mid, events, tLogger)
+	if tasks[0].Name != "Report" || tasks[0].Urgency <= 0 || tasks[0].BusyMinutes == 0 {
+		t.Errorf("Expected the report to be ranked first around work, got %s at %f", tasks[0].Name, tasks[0].Urgency)
+	}
+	if tasks[1].section() != invalidItems || events[1].section() != invalidItems || events[0].section() != repeatingEvents {
+		t.Errorf("Expected the typo and the gym to be invalid, got %s and %s", tasks[1].section(), events[1].section())
+	}
+	out := outputMarkdown(events, tasks, nil, tLogger)
+	for _, expected := range []string{
+		"- " + invalidItems,
+		"\t\t- *Invalid task; Unable to parse '11/31/2022'",
+		"\t\t- *Invalid event; Rotation 'frist'",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected the To Do List to contain %q:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "Formatting error") {
+		t.Errorf("Expected no formatting error:\n%s", out)
+	}
+
+	// read it back, fix the typos, and everything is ranked again
+	events, tasks = mdToStructs(strings.Split(out, "\n"), tLogger)
+	if len(events) != 2 || len(tasks) != 2 {
+		t.Errorf("Expected 2 events and 2 tasks back from the To Do List, got %d and %d:\n%s", len(events), len(tasks), out)
+		t.FailNow()
+	}
+	for _, task := range tasks {
+		if strings.Contains(task.Raw, "*Invalid") {
+			t.Errorf("Expected the error to be left out of the task:\n%s", task.Raw)
+		}
+		if task.Name == "Typo" {
+			task.Deadline = "16:00 11/30/2022"
+			task.setField("Deadline", task.Deadline)
+		}
+	}
+	for _, event := range events {
+		if strings.Contains(event.Raw, "*Invalid") {
+			t.Errorf("Expected the error to be left out of the event:\n%s", event.Raw)
+		}
+		if event.Name == "Gym" {
+			event.Rotation = "first"
+		}
+	}
+	sortTasks(tasks, mid, events, tLogger)
+	for _, task := range tasks {
+		if task.section() != upcomingTasks {
+			t.Errorf("Expected %s to be upcoming once fixed, got %s", task.Name, task.section())
+		}
+	}
+	for _, event := range events {
+		if event.section() != repeatingEvents {
+			t.Errorf("Expected %s to be a regular event once fixed, got %s", event.Name, event.section())
+		}
+	}
+	if out := outputMarkdown(events, tasks, nil, tLogger); strings.Contains(out, invalidItems) {
+		t.Errorf("Expected no invalid items once fixed:\n%s", out)
+	}
+}
+
+// check that a task set aside without any of a task's fields still comes back as a task
+func TestInvalidTaskLabel(t *testing.T) {
+	tLogger := log15.New()
+	events, tasks := mdToStructs([]string{
+		"- " + upcomingTasks,
+		"\t- Taxes",
+		"\t\t- Deadlin; 16:00 04/18/2023",
+	}, tLogger)
+	sortTasks(tasks, generateTestingTimes()["mid"], events, tLogger)
+	out := outputMarkdown(events, tasks, nil, tLogger)
+	if !strings.Contains(out, "\t\t- *"+invalidTaskLabel+"; ") {
+		t.Errorf("Expected the taxes to be labelled as an invalid task:\n%s", out)
+	}
+	events, tasks = mdToStructs(strings.Split(out, "\n"), tLogger)
+	if len(events) != 0 || len(tasks) != 1 || tasks[0].Name != "Taxes" {
+		t.Errorf("Expected the taxes back as a task, got %d events and %d tasks:\n%s", len(events), len(tasks), out)
+	}
+	// items moved there by hand are told apart by their fields
+	events, tasks = mdToStructs([]string{
+		"- " + invalidItems,
+		"\t- Report",
+		"\t\t- Deadline; 16:00 11/31/2022",
+		"\t- Gym",
+		"\t\t- Rotation; frist",
+	}, tLogger)
+	if len(events) != 1 || len(tasks) != 1 || tasks[0].Name != "Report" || events[0].Name != "Gym" {
+		t.Errorf("Expected the report back as a task and the gym as an event, got %d events and %d tasks", len(events), len(tasks))
+	}
+}
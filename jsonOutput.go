@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// The JSON output is for scripts (status bars, bots) that would otherwise scrape the generated To Do List lines.
+// Bump jsonSchemaVersion whenever a field is renamed or removed; adding fields doesn't need a bump.
+const (
+	jsonFormat = "json"
+
+	jsonSchemaVersion = 2
+	jsonSidecarFile   = "To Do List.json"
+)
+
+type jsonState struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	GeneratedAt   time.Time          `json:"generatedAt"`
+	Rotation      jsonRotation       `json:"rotation"`
+	Tasks         []jsonTask         `json:"tasks"`
+	Events        []jsonGeneralEvent `json:"events"`
+}
+
+// jsonRotation is where in the rotation the state was generated. The rotation is two weeks unless
+// PERSPECTIVE_CYCLE_WEEKS says otherwise, so CycleHours is how long it is and HourBlock counts up to it.
+type jsonRotation struct {
+	Week       string    `json:"week"`
+	Day        string    `json:"day"`
+	HourBlock  int       `json:"hourBlock"`
+	CycleHours int       `json:"cycleHours"`
+	ZeroSunday time.Time `json:"zeroSunday"`
+}
+
+type jsonTask struct {
+	Name           string `json:"name"`
+	Deadline       string `json:"deadline"`
+	EstimatedHours int    `json:"estimatedHours"`
+	// EstimatedMinutes, RemainingMinutes and BusyMinutes are the same as the hours, to the minute. EstimatedMinutes
+	// is the whole estimate, as written in Estimated Hours; it isn't the time remaining, which is RemainingMinutes,
+	// the free time left before the deadline.
+	EstimatedMinutes int        `json:"estimatedMinutes"`
+	Priority         string     `json:"priority,omitempty"`
+	Projects         []string   `json:"projects,omitempty"`
+	Contexts         []string   `json:"contexts,omitempty"`
+	UUID             string     `json:"uuid,omitempty"`
+	Section          string     `json:"section"`
+	Urgency          float32    `json:"urgency"`
+	RemainingHours   int        `json:"remainingHours"`
+	BusyHours        int        `json:"busyHours"`
+	RemainingMinutes int        `json:"remainingMinutes"`
+	BusyMinutes      int        `json:"busyMinutes"`
+	DeadlineTime     *time.Time `json:"deadlineTime"`
+	// History and Streak are how the occurrences of a repeating task went, see occurrences.go
+	History []string `json:"history,omitempty"`
+	Streak  int      `json:"streak,omitempty"`
+	// RepeatAfter is set for tasks that come up again a while after they're done
+	RepeatAfter string     `json:"repeatAfter,omitempty"`
+	Completed   *time.Time `json:"completed,omitempty"`
+	// Invalid is why the task couldn't be ranked, for tasks in the Invalid Items section
+	Invalid string `json:"invalid,omitempty"`
+}
+
+type jsonGeneralEvent struct {
+	Name      string `json:"name"`
+	Rotation  string `json:"rotation"`
+	Days      string `json:"days"`
+	StartTime int    `json:"startTime"`
+	Duration  int    `json:"duration"`
+	// StartMinute and DurationMinutes are the minutes on top of StartTime and Duration
+	StartMinute     int    `json:"startMinute"`
+	DurationMinutes int    `json:"durationMinutes"`
+	Inactive        bool   `json:"inactive"`
+	Zone            string `json:"zone,omitempty"`
+	Date            string `json:"date,omitempty"`
+	ActiveFrom      string `json:"activeFrom,omitempty"`
+	ActiveUntil     string `json:"activeUntil,omitempty"`
+	Schedule        string `json:"schedule,omitempty"`
+	Except          string `json:"except,omitempty"`
+	Section         string `json:"section"`
+	HourBlocks      []int  `json:"hourBlocks"`
+	// Invalid is why the event can't block any time, for events in the Invalid Items section
+	Invalid string `json:"invalid,omitempty"`
+}
+
+// buildJSONState gathers the computed state after a sort. Tasks stay in their ranked order.
+func buildJSONState(now time.Time, events []*GeneralEvent, tasks []*Task, logger log15.Logger) jsonState {
+	position := strings.Fields(whatDayIsIt(now, logger))
+	state := jsonState{
+		SchemaVersion: jsonSchemaVersion,
+		GeneratedAt:   now,
+		Rotation: jsonRotation{
+			Week:       position[0],
+			Day:        position[1],
+			HourBlock:  nextHourBlock(now, logger),
+			CycleHours: cycleHours(),
+			ZeroSunday: getZeroSunday(now),
+		},
+		Tasks:  []jsonTask{},
+		Events: []jsonGeneralEvent{},
+	}
+	for _, task := range tasks {
+		jTask := jsonTask{
+			Name:             task.Name,
+			Deadline:         task.Deadline,
+			EstimatedHours:   task.EstimatedHours,
+			EstimatedMinutes: task.estimateMinutes(),
+			Priority:         task.Priority,
+			Projects:         task.Projects,
+			Contexts:         task.Contexts,
+			UUID:             task.UUID,
+			Section:          task.section(),
+			Urgency:          task.Urgency,
+			RemainingHours:   task.RemainingHours,
+			BusyHours:        task.BusyHours,
+			RemainingMinutes: task.FreeMinutes,
+			BusyMinutes:      task.BusyMinutes,
+			History:          task.History,
+			Streak:           task.Streak,
+			RepeatAfter:      task.RepeatAfter,
+			Invalid:          errorText(task.invalid),
+		}
+		if !task.DeadlineTime.IsZero() {
+			deadline := task.DeadlineTime
+			jTask.DeadlineTime = &deadline
+		}
+		if !task.Completed.IsZero() {
+			completed := task.Completed
+			jTask.Completed = &completed
+		}
+		state.Tasks = append(state.Tasks, jTask)
+	}
+	for _, event := range events {
+		state.Events = append(state.Events, jsonGeneralEvent{
+			Name:            event.Name,
+			Rotation:        string(event.Rotation),
+			Days:            event.Days,
+			StartTime:       event.StartTime,
+			Duration:        event.Duration,
+			StartMinute:     event.StartMinute,
+			DurationMinutes: event.DurationMinutes,
+			Inactive:        event.Inactive,
+			Zone:            event.Zone,
+			Date:            event.Date,
+			ActiveFrom:      event.ActiveFrom,
+			ActiveUntil:     event.ActiveUntil,
+			Schedule:        event.Schedule,
+			Except:          event.Except,
+			Section:         event.section(),
+			HourBlocks:      event.generateBlockedHours(logger),
+			Invalid:         errorText(event.invalid),
+		})
+	}
+	return state
+}
+
+func outputJSON(now time.Time, events []*GeneralEvent, tasks []*Task, logger log15.Logger) (string, error) {
+	data, err := json.MarshalIndent(buildJSONState(now, events, tasks, logger), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// writeJSONSidecar keeps a JSON copy of the state next to the To Do List when PERSPECTIVE_JSON_SIDECAR is set
+func writeJSONSidecar(now time.Time, events []*GeneralEvent, tasks []*Task, logger log15.Logger) {
+	if os.Getenv("PERSPECTIVE_JSON_SIDECAR") == "" {
+		return
+	}
+	outStr, err := outputJSON(now, events, tasks, logger)
+	if err == nil {
+		err = os.WriteFile(notesDir(logger)+"/"+jsonSidecarFile, []byte(outStr), 0644)
+	}
+	if err != nil {
+		logger.Error("Error writing JSON sidecar", "err", err.Error())
+		return
+	}
+	logger.Debug("Updated JSON sidecar")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that the JSON state carries the versioned schema, the resolved deadlines and the rotation position
+func TestOutputJSON(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	bookClub := &Task{
+		Name:           "Read For Book Club",
+		Deadline:       "18:00 both Tuesday, Thursday",
+		EstimatedHours: 1,
+	}
+	sleepEvent := &GeneralEvent{
+		Name:      "sleeping",
+		Rotation:  bothWeeks,
+		Days:      "Sun-Sat",
+		StartTime: 23,
+		Duration:  8,
+	}
+	tasks := []*Task{bookClub}
+	events := []*GeneralEvent{sleepEvent}
+	sortTasks(tasks, mid, events, tLogger)
+	outStr, err := outputJSON(mid, events, tasks, tLogger)
+	if err != nil {
+		t.Errorf("Unexpected error writing JSON: %s", err.Error())
+		t.FailNow()
+	}
+	state := jsonState{}
+	err = json.Unmarshal([]byte(outStr), &state)
+	if err != nil {
+		t.Errorf("Output wasn't valid JSON: %s", err.Error())
+		t.FailNow()
+	}
+	if state.SchemaVersion != jsonSchemaVersion || state.Rotation.Week != "first" || state.Rotation.Day != "Saturday" || state.Rotation.HourBlock != 167 {
+		t.Errorf("Schema version or rotation didn't match: %+v", state.Rotation)
+	}
+	if len(state.Tasks) != 1 || state.Tasks[0].Section != upcomingTasks || state.Tasks[0].RemainingHours != 44 {
+		t.Errorf("Task didn't match: %+v", state.Tasks)
+		t.FailNow()
+	}
+	// mid is first Saturday night, so the next book club is second Tuesday
+	expectedDeadline, _ := time.Parse(taskDateFmt, "18:00 11/29/2022 EST")
+	if state.Tasks[0].DeadlineTime == nil || !state.Tasks[0].DeadlineTime.Equal(expectedDeadline) {
+		t.Errorf("Expected deadline of %v, got %v", expectedDeadline, state.Tasks[0].DeadlineTime)
+	}
+	if len(state.Events) != 1 || len(state.Events[0].HourBlocks) != 14*8 {
+		t.Errorf("Expected 112 hour blocks for sleeping, got %+v", state.Events)
+	}
+}
@@ -24,19 +24,34 @@ const (
 	repeatingEvents = "Regular Events"
 	inactiveEvents  = "Inactive Events"
 	backgroundStuff = "Background Perspective Stuff"
+	invalidItems    = "Invalid Items"
 
 	headerLineFmt = "\n- %s\n"
 	genTextFmt    = "\n\t\t- *%s*"
 )
 
-var genTextMatcher *regexp.Regexp
+var genTextMatcher = regexp.MustCompile(`\t{2}- \*(.+)\*`)
 
 func main() {
 
 	logger := log15.New()
 	logger.SetHandler(log15.LvlFilterHandler(log15.LvlInfo, log15.StdoutHandler))
+	configureCycle(logger)
+	configureZone(logger)
+	configureSchedules(logger)
+	configureHolidays(logger)
+
+	// one-shot commands like import and export run and exit instead of watching the notes directory
+	if len(os.Args) > 1 {
+		err := runCommand(os.Args[1:], logger)
+		if err != nil {
+			logger.Error("Command failed", "command", os.Args[1], "err", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 
-	genTextMatcher, _ = regexp.Compile(`\t{2}- \*(.+)\*`)
+	store := getStorage(logger)
 
 	quitChan := make(chan bool)
 
@@ -53,22 +68,43 @@ func main() {
 	defer watcher.Close()
 
 	previousTasks := []*Task{}
+	caldav := newCalDAVSync(logger)
+	feed := newCalendarFeed(logger)
 
 	refreshList := func() {
 		logger.Info("Updating task list")
-		ourEvents, ourTasks, err := readFromFile(logger)
+		ourEvents, ourTasks, err := store.read(logger)
 		if err != nil {
 			logger.Error(err.Error())
 			return
 		}
-		err = sortTasks(ourTasks, time.Now(), ourEvents, logger)
-		if err != nil {
-			logger.Warn("Unable to sort tasks, dumping text with err warning")
-			writeToFile(ourEvents, ourTasks, &turnBlindEye, err, logger)
-			return
+		now := currentTime()
+		for _, overlap := range findOverlaps(now, ourEvents, logger) {
+			logger.Warn("Events overlap, counting the shared time once", "overlap", overlap)
+		}
+		rankingEvents := withBusyCalendars(ourEvents, now, logger)
+		if caldav != nil {
+			rankingEvents = append(rankingEvents, caldav.pullBusy(now, logger)...)
+		}
+		// deadlines in words get written out while they still mean what they did, see naturalDeadlines.go
+		forceWrite := normalizeDeadlines(ourTasks, now, logger)
+		// repeating tasks whose deadline passed start over before they're ranked
+		forceWrite = trackOccurrences(ourTasks, now, logger) || forceWrite
+		sortTasks(ourTasks, now, rankingEvents, logger)
+		if caldav != nil && caldav.syncTasks(ourTasks, now, logger) {
+			// tasks changed on the server, rank them again and make sure the changes get written
+			sortTasks(ourTasks, now, rankingEvents, logger)
+			forceWrite = true
+		}
+		writeJSONSidecar(now, ourEvents, ourTasks, logger)
+		writeICSFile(now, ourEvents, ourTasks, logger)
+		if feed != nil {
+			feed.update(now, ourEvents, rankingEvents, ourTasks, logger)
 		}
-		if compareLists(previousTasks, ourTasks, logger) {
-			writeToFile(ourEvents, ourTasks, &turnBlindEye, nil, logger)
+		if forceWrite || compareLists(previousTasks, ourTasks, logger) {
+			turnBlindEye = true
+			store.write(ourEvents, ourTasks, logger)
+			turnBlindEye = false
 			time.Sleep(1 * time.Second)
 			writeTimer.Stop()
 		} else {
@@ -91,6 +127,10 @@ func main() {
 	// refresh list on startup
 	refreshList()
 
+	if feed != nil {
+		go feed.serve(logger)
+	}
+
 	// refresh every hour on the hour
 	go func() {
 		for {
@@ -108,7 +148,7 @@ func main() {
 					logger.Error("event not OK")
 					return
 				}
-				if strings.Contains(event.Name, tasksFile) {
+				if watchedFile(store, event.Name) {
 
 					if turnBlindEye {
 						logger.Debug("Turning a blind eye to file update")
@@ -131,7 +171,7 @@ func main() {
 	}()
 
 	// Add a path.
-	dir := os.Getenv("NOTESDIR")
+	dir := notesDir(logger)
 	err = watcher.Add(dir + "/")
 	if err != nil {
 		logger.Error("Problem watching path", "err", err.Error())
@@ -142,18 +182,50 @@ func main() {
 	logger.Info("Perspective is shutting down.")
 }
 
-// read/write events to md file
-func readFromFile(logger log15.Logger) ([]*GeneralEvent, []*Task, error) {
+// watchedFile is true when a change to path should refresh the list kept in store
+func watchedFile(store storage, path string) bool {
+	for _, name := range store.fileNames() {
+		if strings.Contains(path, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// notesDir is the directory holding the To Do List and anything else Perspective reads or writes
+func notesDir(logger log15.Logger) string {
 	dir := os.Getenv("NOTESDIR")
 	if dir == "" {
 		fmt.Println("Don't forget to set NOTESDIR")
 		dir = "~/Documents/Logseq/personal/pages"
 		logger.Warn("Empty notes directory, adding default", "default", dir)
 	}
-	// pull in tasks file
-	readFile, err := os.Open(dir + "/" + tasksFile)
+	return dir
+}
+
+// read/write events to md file
+func readFromFile(logger log15.Logger) ([]*GeneralEvent, []*Task, diagnostics, error) {
+	return readMarkdownFile(notesDir(logger)+"/"+tasksFile, logger)
+}
+
+func readMarkdownFile(path string, logger log15.Logger) ([]*GeneralEvent, []*Task, diagnostics, error) {
+	lines := readLines(path, logger)
+	if len(lines) < 3 {
+		return []*GeneralEvent{}, []*Task{}, diagnostics{}, errors.New("tried the default notes directory but no dice")
+	}
+	ev, ta, diags := parseMarkdown(lines, logger)
+	for _, diag := range diags {
+		logger.Info("Problem in the To Do List", "diagnostic", diag.String())
+	}
+	return ev, ta, diags, nil
+}
+
+// readLines pulls in every line of a file; problems opening it are logged and leave the list empty
+func readLines(path string, logger log15.Logger) []string {
+	readFile, err := os.Open(path)
 	if err != nil {
 		logger.Error("Error reading Task file", "err", err.Error())
+		return []string{}
 	}
 	defer func() {
 		err := readFile.Close()
@@ -168,25 +240,11 @@ func readFromFile(logger log15.Logger) ([]*GeneralEvent, []*Task, error) {
 		line := fileScanner.Text()
 		lines = append(lines, line)
 	}
-	if len(lines) < 3 {
-		return []*GeneralEvent{}, []*Task{}, errors.New("tried the default notes directory but no dice")
-	}
-	ev, ta := mdToStructs(lines, logger)
-	return ev, ta, nil
+	return lines
 }
 
-func writeToFile(events []*GeneralEvent, tasks []*Task, turnBlindEye *bool, writeError error, logger log15.Logger) {
-	dir := os.Getenv("NOTESDIR")
-	*turnBlindEye = true
-	defer func() {
-		*turnBlindEye = false
-	}()
-	if dir == "" {
-		fmt.Println("Don't forget to set NOTESDIR")
-		dir = "~/Documents/Logseq/personal/pages"
-		logger.Warn("Empty notes directory, adding default", "default", dir)
-	}
-	w, err := os.Create(dir + "/" + tasksFile)
+func writeToFile(path string, events []*GeneralEvent, tasks []*Task, diags diagnostics, logger log15.Logger) {
+	w, err := os.Create(path)
 	defer func() {
 		err := w.Close()
 		if err != nil {
@@ -196,22 +254,44 @@ func writeToFile(events []*GeneralEvent, tasks []*Task, turnBlindEye *bool, writ
 	if err != nil {
 		logger.Error("Error writing to Task file", "err", err.Error())
 	}
-	w.WriteString(fmt.Sprintf("Updated at %s: %s\n", time.Now().Format(updateLineFmt), whatDayIsIt(time.Now(), logger)))
-	if writeError != nil {
-		w.WriteString("Formatting error\n")
-		w.WriteString(writeError.Error())
-	}
-	w.WriteString(outputTasks(tasks))
-	w.WriteString(outputEvents(events))
+	w.WriteString(outputMarkdown(events, tasks, diags, logger))
 	logger.Info("Updated To Do List file")
 }
 
+func outputMarkdown(events []*GeneralEvent, tasks []*Task, diags diagnostics, logger log15.Logger) string {
+	outStr := fmt.Sprintf("Updated at %s: %s\n", currentTime().Format(updateLineFmt), whatDayIsIt(currentTime(), logger))
+	outStr += outputInvalid(events, tasks)
+	outStr += outputTasks(tasks)
+	outStr += outputEvents(events)
+	outStr += outputBackground(currentTime(), events, diags, logger)
+	return outStr
+}
+
 func organizeLines(rawLine string) (string, int) {
 	tokens := strings.Split(rawLine, "	")
 	return strings.Trim(rawLine, "- 	"), len(tokens)
 }
 
+// splitList breaks up a comma separated field value, dropping empty entries
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func mdToStructs(rawLines []string, logger log15.Logger) ([]*GeneralEvent, []*Task) {
+	events, tasks, _ := parseMarkdown(rawLines, logger)
+	return events, tasks
+}
+
+// parseMarkdown is mdToStructs along with the diagnostics for anything in the To Do List that couldn't be understood
+func parseMarkdown(rawLines []string, logger log15.Logger) ([]*GeneralEvent, []*Task, diagnostics) {
+	diags := diagnostics{}
 	events := []*GeneralEvent{}
 	tasks := []*Task{}
 	offsets := []int{}
@@ -232,7 +312,7 @@ func mdToStructs(rawLines []string, logger log15.Logger) ([]*GeneralEvent, []*Ta
 		line := lines[ind]
 		offset := offsets[ind]
 
-		if line == upcomingTasks || line == overdueTasks || line == completedTasks || line == repeatingEvents || line == inactiveEvents {
+		if line == upcomingTasks || line == overdueTasks || line == completedTasks || line == repeatingEvents || line == inactiveEvents || line == pastEvents || line == invalidItems {
 			newInd := ind
 			// loop over all lines within the header, judged by waiting until the offset matches the header's offset (new potential header)
 			for newInd < len(lines)-1 {
@@ -245,19 +325,25 @@ func mdToStructs(rawLines []string, logger log15.Logger) ([]*GeneralEvent, []*Ta
 			}
 			switch line {
 			case upcomingTasks, overdueTasks, completedTasks:
-				tasks = append(tasks, mdToTasks(rawLines[ind+1:newInd], lines[ind+1:newInd], offsets[ind+1:newInd], logger)...)
-			case repeatingEvents, inactiveEvents:
-				events = append(events, mdToEvents(rawLines[ind+1:newInd], lines[ind+1:newInd], offsets[ind+1:newInd], logger)...)
+				tasks = append(tasks, mdToTasks(rawLines[ind+1:newInd], lines[ind+1:newInd], offsets[ind+1:newInd], ind+2, &diags, logger)...)
+			case repeatingEvents, inactiveEvents, pastEvents:
+				events = append(events, mdToEvents(rawLines[ind+1:newInd], lines[ind+1:newInd], offsets[ind+1:newInd], ind+2, &diags, logger)...)
+			case invalidItems:
+				invalidEvents, invalidTasks := mdToInvalidItems(rawLines[ind+1:newInd], lines[ind+1:newInd], offsets[ind+1:newInd], ind+2, &diags, logger)
+				events = append(events, invalidEvents...)
+				tasks = append(tasks, invalidTasks...)
 			}
 			ind = newInd
 			continue
 		}
 		ind++
 	}
-	return events, tasks
+	return events, tasks, diags
 }
 
-func mdToTasks(rawLines []string, lines []string, offsets []int, topLogger log15.Logger) []*Task {
+// mdToTasks reads the tasks under a header; firstLine is the line of the To Do List the first of them is on, and
+// anything that can't be understood is added to diags
+func mdToTasks(rawLines []string, lines []string, offsets []int, firstLine int, diags *diagnostics, topLogger log15.Logger) []*Task {
 	topLogger = topLogger.New("function", "mdToTasks")
 	// offset goes up; that's the name, beginning of new Task
 	// offset stays equal or goes down; that's a field
@@ -277,39 +363,103 @@ func mdToTasks(rawLines []string, lines []string, offsets []int, topLogger log15
 			loopLogger.Debug("Adding Name")
 			newTask = &Task{
 				Name: line,
+				line: firstLine + index,
 			}
 			tasks = append(tasks, newTask)
 		case offset > namesOffset:
-			tokens := strings.Split(line, "; ")
-			switch tokens[0] {
+			key, value, isField := splitField(line)
+			field := taskField(key)
+			switch field {
 			case "Deadline":
-				loopLogger.Debug("Adding Deadline", "deadline", tokens[1])
-				newTask.Deadline = tokens[1]
+				loopLogger.Debug("Adding Deadline", "deadline", value)
+				newTask.Deadline = value
+				newTask.deadlineLine = firstLine + index
 			case "Estimated Hours":
-				loopLogger.Debug("Adding Estimated Hours", "hours", tokens[1])
-				num, err := strconv.Atoi(tokens[1])
+				loopLogger.Debug("Adding Estimated Hours", "hours", value)
+				minutes, err := parseDuration(value)
+				if err != nil {
+					loopLogger.Error("Error transforming hours into number", "err", err.Error(), "hours", value)
+					diags.add(severityError, firstLine+index, rawLines[index], value, newTask.Name, field, err.Error())
+				}
+				newTask.setEstimate(minutes)
+			case "Priority":
+				loopLogger.Debug("Adding Priority", "priority", value)
+				newTask.Priority = value
+			case "Projects":
+				loopLogger.Debug("Adding Projects", "projects", value)
+				newTask.Projects = splitList(value)
+			case "Contexts":
+				loopLogger.Debug("Adding Contexts", "contexts", value)
+				newTask.Contexts = splitList(value)
+			case "UUID":
+				loopLogger.Debug("Adding UUID", "uuid", value)
+				newTask.UUID = value
+			case "Base Estimate":
+				loopLogger.Debug("Adding Base Estimate", "hours", value)
+				minutes, err := parseDuration(value)
+				if err != nil {
+					loopLogger.Error("Error transforming hours into number", "err", err.Error(), "hours", value)
+					diags.add(severityError, firstLine+index, rawLines[index], value, newTask.Name, field, err.Error())
+				}
+				newTask.BaseEstimate = minutes
+			case "Occurrence", "Overdue", "Completed":
+				loopLogger.Debug("Adding "+field, "occurrence", value)
+				occurrence, err := parseOccurrence(value)
+				switch {
+				case err != nil:
+					loopLogger.Error("Error reading occurrence", "err", err.Error())
+					diags.add(severityError, firstLine+index, rawLines[index], value, newTask.Name, field, err.Error())
+				case field == "Occurrence":
+					newTask.Occurrence = occurrence
+				case field == "Overdue":
+					newTask.Overdue = occurrence
+				default:
+					newTask.Completed = occurrence
+				}
+			case "Repeat After":
+				loopLogger.Debug("Adding Repeat After", "interval", value)
+				newTask.RepeatAfter = value
+			case "History":
+				loopLogger.Debug("Adding History", "history", value)
+				newTask.History = splitList(value)
+			case "Streak":
+				loopLogger.Debug("Adding Streak", "streak", value)
+				streak, err := strconv.Atoi(value)
 				if err != nil {
-					loopLogger.Error("Error transforming hours into number", "err", err.Error(), "hours", tokens[1])
+					loopLogger.Error("Error transforming streak into number", "err", err.Error(), "streak", value)
+					diags.add(severityError, firstLine+index, rawLines[index], value, newTask.Name, field,
+						fmt.Sprintf("Unable to parse '%s' as a whole number", value))
 				}
-				newTask.EstimatedHours = num
+				newTask.Streak = streak
 			default:
-				loopLogger.Debug("Line didn't correspond to Name, Deadline, or Hours; skipping")
+				// generated text like the urgency has a semicolon but isn't a field
+				if !isField || genTextMatcher.MatchString(rawLines[index]) {
+					loopLogger.Debug("Line didn't correspond to Name, Deadline, Hours, Priority, Projects, Contexts, UUID or occurrences; skipping")
+					break
+				}
+				loopLogger.Warn("Unknown field, skipping", "field", key)
+				diags.add(severityWarning, firstLine+index, rawLines[index], key, newTask.Name, "", unknownField(key, taskFields, taskFieldAliases))
 			}
 		case offset < namesOffset:
 			loopLogger.Warn("We're parsing a line that has fewer offsets than the first line did...")
+			diags.add(severityWarning, firstLine+index, rawLines[index], "", newTask.Name, "",
+				"Line is indented less than the tasks under its header, so it's been kept as part of the task above")
 		}
 		newTask.AddRaw(rawLines[index])
 	}
 	return tasks
 }
 
-func mdToEvents(rawLines []string, lines []string, offsets []int, topLogger log15.Logger) []*GeneralEvent {
+// mdToEvents reads the events under a header, like mdToTasks
+func mdToEvents(rawLines []string, lines []string, offsets []int, firstLine int, diags *diagnostics, topLogger log15.Logger) []*GeneralEvent {
 	topLogger = topLogger.New("function", "mdToEvents")
 	// offset goes up; that's the name, beginning of new Task
 	// offset stays equal or goes down; that's a field
 	newEvent := &GeneralEvent{}
 	namesOffset := -1
 	events := []*GeneralEvent{}
+	// a Duration wins over the end of a Start Time range wherever it comes, like in CSV imports
+	durationGiven := false
 	for index, line := range lines {
 		line = strings.Trim(line, " ")
 		offset := offsets[index]
@@ -323,44 +473,84 @@ func mdToEvents(rawLines []string, lines []string, offsets []int, topLogger log1
 			loopLogger.Debug("Adding Name")
 			newEvent = &GeneralEvent{
 				Name: line,
+				line: firstLine + index,
 			}
 			events = append(events, newEvent)
+			durationGiven = false
 		case offset > namesOffset:
-			tokens := strings.Split(line, "; ")
-			switch tokens[0] {
+			key, value, isField := splitField(line)
+			field := eventField(key)
+			switch field {
 			case "Rotation":
-				loopLogger.Debug("Adding Rotation", "rotation", tokens[1])
-				newEvent.Rotation = rotation(tokens[1])
+				loopLogger.Debug("Adding Rotation", "rotation", value)
+				newEvent.Rotation = rotation(value)
 			case "Days":
-				loopLogger.Debug("Adding Days", "days", tokens[1])
-				newEvent.Days = tokens[1]
+				loopLogger.Debug("Adding Days", "days", value)
+				newEvent.Days = value
 			case "Start Time":
-				loopLogger.Debug("Adding Start Time", "start", tokens[1])
-				num, err := strconv.Atoi(tokens[1])
+				loopLogger.Debug("Adding Start Time", "start", value)
+				start, length, ranged, err := parseClockRange(value)
 				if err != nil {
-					loopLogger.Error("Error transforming start time into number", "err", err.Error(), "start", tokens[1])
+					loopLogger.Error("Error transforming start time into number", "err", err.Error(), "start", value)
+					diags.add(severityError, firstLine+index, rawLines[index], value, newEvent.Name, field, err.Error())
+				}
+				newEvent.StartTime = start / 60
+				newEvent.StartMinute = start % 60
+				newEvent.hasStart = true
+				if ranged && !durationGiven {
+					newEvent.Duration = length / 60
+					newEvent.DurationMinutes = length % 60
 				}
-				newEvent.StartTime = num
 			case "Duration":
-				loopLogger.Debug("Adding Duration", "duration", tokens[1])
-				num, err := strconv.Atoi(tokens[1])
+				loopLogger.Debug("Adding Duration", "duration", value)
+				minutes, err := parseDuration(value)
 				if err != nil {
-					loopLogger.Error("Error transforming duration into number", "err", err.Error(), "duration", tokens[1])
+					loopLogger.Error("Error transforming duration into number", "err", err.Error(), "duration", value)
+					diags.add(severityError, firstLine+index, rawLines[index], value, newEvent.Name, field, err.Error())
 				}
-				newEvent.Duration = num
+				newEvent.Duration = minutes / 60
+				newEvent.DurationMinutes = minutes % 60
+				durationGiven = true
 			case "Inactive":
-				loopLogger.Debug("Adding Inactivity", "inactive", tokens[1])
-				ans, err := strconv.ParseBool(tokens[1])
+				loopLogger.Debug("Adding Inactivity", "inactive", value)
+				ans, err := strconv.ParseBool(value)
 				if err != nil {
-					loopLogger.Error("Error transforming inactivity into boolean", "err", err.Error(), "inactive", tokens[1])
+					loopLogger.Error("Error transforming inactivity into boolean", "err", err.Error(), "inactive", value)
+					diags.add(severityError, firstLine+index, rawLines[index], value, newEvent.Name, field,
+						fmt.Sprintf("Unable to parse '%s' as true or false", value))
 				}
 				newEvent.Inactive = ans
+			case "Active From":
+				loopLogger.Debug("Adding Active From", "from", value)
+				newEvent.ActiveFrom = value
+			case "Active Until":
+				loopLogger.Debug("Adding Active Until", "until", value)
+				newEvent.ActiveUntil = value
+			case "Schedule":
+				loopLogger.Debug("Adding Schedule", "schedule", value)
+				newEvent.Schedule = value
+			case "Except":
+				loopLogger.Debug("Adding Except", "except", value)
+				newEvent.Except = value
+			case "Date":
+				loopLogger.Debug("Adding Date", "date", value)
+				newEvent.Date = value
+			case "Time Zone":
+				loopLogger.Debug("Adding Time Zone", "zone", value)
+				newEvent.Zone = value
 			default:
-				loopLogger.Debug("Line didn't correspond to Name, Rotation, Days, Start, Duration, or Inactivity; skipping")
+				// generated text like the urgency has a semicolon but isn't a field
+				if !isField || genTextMatcher.MatchString(rawLines[index]) {
+					loopLogger.Debug("Line didn't correspond to Name, Rotation, Days, Start, Duration, Inactivity, Time Zone, Date, Active From, Active Until, Schedule or Except; skipping")
+					break
+				}
+				loopLogger.Warn("Unknown field, skipping", "field", key)
+				diags.add(severityWarning, firstLine+index, rawLines[index], key, newEvent.Name, "", unknownField(key, eventFields, eventFieldAliases))
 			}
 		case offset < namesOffset:
 			loopLogger.Warn("We're parsing a line that has fewer offsets than the first line did...")
-
+			diags.add(severityWarning, firstLine+index, rawLines[index], "", newEvent.Name, "",
+				"Line is indented less than the events under its header, so it's been kept as part of the event above")
 		}
 		newEvent.AddRaw(rawLines[index])
 	}
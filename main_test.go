@@ -1,12 +1,21 @@
 package main
 
 import (
+	"os"
 	"testing"
 	"time"
 
 	"github.com/inconshreveable/log15"
 )
 
+// TestMain puts the home zone and the system's on UTC so the tests don't depend on the machine's zone. Blocks are
+// counted on the home clock and generateTestingTimes reads "EST" on the system's, so otherwise the results move with
+// the machine's clocks. Tests about zones switch with useHomeZone.
+func TestMain(m *testing.M) {
+	homeLocation, time.Local = time.UTC, time.UTC
+	os.Exit(m.Run())
+}
+
 func TestMDToStructs(t *testing.T) {
 	tLogger := log15.New()
 	tests := []struct {
@@ -54,3 +63,23 @@ func TestMDToStructs(t *testing.T) {
 		}
 	}
 }
+
+// check that todo.txt storage refreshes when the events in the To Do List change too
+func TestWatchedFile(t *testing.T) {
+	tests := []struct {
+		store   storage
+		path    string
+		watched bool
+	}{
+		{store: &markdownStorage{path: "/notes/" + tasksFile}, path: "/notes/" + tasksFile, watched: true},
+		{store: &markdownStorage{path: "/notes/" + tasksFile}, path: "/notes/" + todoTxtFile, watched: false},
+		{store: &todoTxtStorage{path: "/notes/" + todoTxtFile}, path: "/notes/" + todoTxtFile, watched: true},
+		{store: &todoTxtStorage{path: "/notes/" + todoTxtFile}, path: "/notes/" + tasksFile, watched: true},
+		{store: &todoTxtStorage{path: "/notes/" + todoTxtFile}, path: "/notes/" + jsonSidecarFile, watched: false},
+	}
+	for _, test := range tests {
+		if watched := watchedFile(test.store, test.path); watched != test.watched {
+			t.Errorf("Expected a change to %s to refresh %T to be %t", test.path, test.store, test.watched)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Start times, durations and estimates can be given to the minute: "18:30" for a start time, and "45m", "1h30m" or
+// "1.5" for durations and estimates. Plain whole numbers are still hours, so whole-hour lists read the way they
+// always have. Internally busy time is counted in minutes, as spans rather than lists of hour blocks.
+
+// span is a stretch of minutes, from start up to but not including end
+type span struct {
+	start int
+	end   int
+}
+
+var durationMatcher = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?$`)
+
+// parseClock reads a start time, either an hour like "18" or a time like "18:30"
+func parseClock(value string) (hour, minute int, err error) {
+	value = strings.TrimSpace(value)
+	parts := strings.Split(value, ":")
+	if len(parts) > 2 {
+		return 0, 0, fmt.Errorf("Unable to parse '%s' as a time of day", value)
+	}
+	hour, err = strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("Unable to parse '%s' as a time of day", value)
+	}
+	if len(parts) == 2 {
+		minute, err = strconv.Atoi(parts[1])
+		if err != nil || len(parts[1]) != 2 || minute > 59 {
+			return 0, 0, fmt.Errorf("Unable to parse '%s' as a time of day", value)
+		}
+	}
+	return hour, minute, nil
+}
+
+// parseClockRange reads a start time that may also give when the event ends, like "22:00-06:00". An end time that
+// isn't after the start is on the next day. ranged says whether there was an end time, and length is only set if so.
+func parseClockRange(value string) (start, length int, ranged bool, err error) {
+	parts := strings.Split(value, "-")
+	if len(parts) > 2 {
+		return 0, 0, false, fmt.Errorf("Unable to parse '%s' as a time of day or a range like 22:00-06:00", strings.TrimSpace(value))
+	}
+	hour, minute, err := parseClock(parts[0])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	start = hour*60 + minute
+	if len(parts) == 1 {
+		return start, 0, false, nil
+	}
+	hour, minute, err = parseClock(parts[1])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	length = ((hour*60+minute-start)%(24*60) + 24*60) % (24 * 60)
+	if length == 0 {
+		return 0, 0, false, fmt.Errorf("Time range '%s' starts and ends at the same time", strings.TrimSpace(value))
+	}
+	return start, length, true, nil
+}
+
+// formatClock is the reverse of parseClock, leaving off the minutes on the hour
+func formatClock(hour, minute int) string {
+	if minute == 0 {
+		return strconv.Itoa(hour)
+	}
+	return fmt.Sprintf("%02d:%02d", hour, minute)
+}
+
+// parseDuration reads a duration or estimate in minutes: whole hours ("2"), decimal hours ("1.5"), or hours and
+// minutes ("1h30m", "45m")
+func parseDuration(value string) (int, error) {
+	value = strings.ToLower(strings.Join(strings.Fields(value), ""))
+	if hours, err := strconv.Atoi(value); err == nil {
+		return hours * 60, nil
+	}
+	if hours, err := strconv.ParseFloat(value, 64); err == nil && hours >= 0 && !math.IsInf(hours, 0) {
+		return int(math.Round(hours * 60)), nil
+	}
+	matches := durationMatcher.FindStringSubmatch(value)
+	if matches == nil || value == "" {
+		return 0, fmt.Errorf("Unable to parse '%s' as hours or a duration like 1h30m", value)
+	}
+	minutes := 0
+	if matches[1] != "" {
+		hours, _ := strconv.Atoi(matches[1])
+		minutes += hours * 60
+	}
+	if matches[2] != "" {
+		extra, _ := strconv.Atoi(matches[2])
+		minutes += extra
+	}
+	return minutes, nil
+}
+
+// formatDuration writes minutes back out the way parseDuration reads them, as plain hours when it's whole hours
+func formatDuration(minutes int) string {
+	switch {
+	case minutes%60 == 0:
+		return strconv.Itoa(minutes / 60)
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	default:
+		return fmt.Sprintf("%dh%dm", minutes/60, minutes%60)
+	}
+}
+
+// formatHours writes minutes as a number of hours, with up to two decimals when it isn't whole
+func formatHours(minutes int) string {
+	if minutes%60 == 0 {
+		return strconv.Itoa(minutes / 60)
+	}
+	hours := strconv.FormatFloat(float64(minutes)/60, 'f', 2, 64)
+	return strings.TrimRight(hours, "0")
+}
+
+// hoursOfSpans lists the hour blocks that spans touch, any busy part of an hour blocks it. Each hour is listed once
+// however many spans touch it.
+func hoursOfSpans(spans []span) []int {
+	hours := []int{}
+	for _, busy := range mergeSpans(spans) {
+		for hour := floorDiv(busy.start, 60); hour*60 < busy.end; hour++ {
+			if len(hours) != 0 && hours[len(hours)-1] == hour {
+				continue // the last span ended partway through this hour
+			}
+			hours = append(hours, hour)
+		}
+	}
+	return hours
+}
+
+// spansOfHours is the reverse of hoursOfSpans, one span per hour block
+func spansOfHours(hours []int) []span {
+	spans := []span{}
+	for _, hour := range hours {
+		spans = append(spans, span{hour * 60, hour*60 + 60})
+	}
+	return spans
+}
+
+// overlap is how many minutes of busy fall inside window
+func overlap(busy, window span) int {
+	clipped := clipSpan(busy, window)
+	if clipped.end < clipped.start {
+		return 0
+	}
+	return clipped.end - clipped.start
+}
+
+// clipSpan is the part of busy inside window, which ends before it starts when there isn't any
+func clipSpan(busy, window span) span {
+	if window.start > busy.start {
+		busy.start = window.start
+	}
+	if window.end < busy.end {
+		busy.end = window.end
+	}
+	return busy
+}
+
+// wrapSpans folds spans into the cycle, so busy time running past the end of the rotation (like sleeping from late
+// on the last Saturday) blocks the start of it instead. Busy time longer than a whole cycle blocks all of it.
+func wrapSpans(spans []span) []span {
+	wrapped := []span{}
+	for _, busy := range spans {
+		length := busy.end - busy.start
+		if length >= cycleMinutes() {
+			wrapped = append(wrapped, span{0, cycleMinutes()})
+			continue
+		}
+		start := modCycleMinutes(busy.start)
+		if start+length <= cycleMinutes() {
+			wrapped = append(wrapped, span{start, start + length})
+			continue
+		}
+		wrapped = append(wrapped, span{start, cycleMinutes()}, span{0, start + length - cycleMinutes()})
+	}
+	sort.Slice(wrapped, func(i, j int) bool { return wrapped[i].start < wrapped[j].start })
+	return wrapped
+}
+
+// mergeSpans sorts spans and joins the ones that overlap or touch, so that no minute is counted twice. Empty spans
+// are dropped.
+func mergeSpans(spans []span) []span {
+	sorted := append([]span{}, spans...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	merged := []span{}
+	for _, busy := range sorted {
+		if busy.end <= busy.start {
+			continue
+		}
+		last := len(merged) - 1
+		if last >= 0 && busy.start <= merged[last].end {
+			if busy.end > merged[last].end {
+				merged[last].end = busy.end
+			}
+			continue
+		}
+		merged = append(merged, busy)
+	}
+	return merged
+}
+
+// totalMinutes adds up the minutes in spans, which shouldn't overlap (see mergeSpans)
+func totalMinutes(spans []span) int {
+	total := 0
+	for _, busy := range spans {
+		total += busy.end - busy.start
+	}
+	return total
+}
+
+// repeatSpans repeats the busy time of the rotation once every cycle, going forward, and keeps the parts that fall
+// inside window, merged
+func repeatSpans(spans []span, window span) []span {
+	repeated := []span{}
+	for _, busy := range spans {
+		for wraps := 0; busy.start+wraps*cycleMinutes() < window.end; wraps++ {
+			repeated = append(repeated, clipSpan(span{busy.start + wraps*cycleMinutes(), busy.end + wraps*cycleMinutes()}, window))
+		}
+	}
+	return mergeSpans(repeated)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that start times read as hours or hours and minutes
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		hour    int
+		minute  int
+		written string
+		fails   bool
+	}{
+		{value: "18", hour: 18, written: "18"},
+		{value: "18:30", hour: 18, minute: 30, written: "18:30"},
+		{value: " 9:05 ", hour: 9, minute: 5, written: "09:05"},
+		{value: "0", hour: 0, written: "0"},
+		{value: "24", fails: true},
+		{value: "18:60", fails: true},
+		{value: "18:5", fails: true},
+		{value: "six", fails: true},
+	}
+	for _, test := range tests {
+		hour, minute, err := parseClock(test.value)
+		if (err != nil) != test.fails {
+			t.Errorf("Unexpected error state for '%s': %v", test.value, err)
+			t.FailNow()
+		}
+		if hour != test.hour || minute != test.minute {
+			t.Errorf("Clock '%s' didn't match;\nExpected: %d:%d\nActual: %d:%d", test.value, test.hour, test.minute, hour, minute)
+			t.FailNow()
+		}
+		if !test.fails && formatClock(hour, minute) != test.written {
+			t.Errorf("Clock '%s' didn't format back, got '%s'", test.value, formatClock(hour, minute))
+		}
+	}
+}
+
+// check that durations read as whole hours, decimal hours, or hours and minutes, and write back out the same way
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		minutes int
+		written string
+		hours   string
+		fails   bool
+	}{
+		{value: "2", minutes: 120, written: "2", hours: "2"},
+		{value: "1.5", minutes: 90, written: "1h30m", hours: "1.5"},
+		{value: "1h30m", minutes: 90, written: "1h30m", hours: "1.5"},
+		{value: "45m", minutes: 45, written: "45m", hours: "0.75"},
+		{value: "2H", minutes: 120, written: "2", hours: "2"},
+		{value: "1h 20m", minutes: 80, written: "1h20m", hours: "1.33"},
+		{value: "", fails: true},
+		{value: "an hour", fails: true},
+	}
+	for _, test := range tests {
+		minutes, err := parseDuration(test.value)
+		if (err != nil) != test.fails {
+			t.Errorf("Unexpected error state for '%s': %v", test.value, err)
+			t.FailNow()
+		}
+		if test.fails {
+			continue
+		}
+		if minutes != test.minutes || formatDuration(minutes) != test.written || formatHours(minutes) != test.hours {
+			t.Errorf("Duration '%s' didn't match;\nExpected: %d %s %s\nActual: %d %s %s", test.value,
+				test.minutes, test.written, test.hours, minutes, formatDuration(minutes), formatHours(minutes))
+			t.FailNow()
+		}
+	}
+}
+
+// check that events, deadlines and estimates given to the minute count to the minute, and whole hours don't change
+func TestMinuteUrgency(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	standup := &GeneralEvent{
+		Name:            "Standup",
+		Rotation:        "second", // tomorrow
+		Days:            "Sunday",
+		StartTime:       9,
+		StartMinute:     30,
+		DurationMinutes: 45,
+	}
+	tests := []struct {
+		name        string
+		task        *Task
+		events      []*GeneralEvent
+		freeMinutes int
+		busyMinutes int
+		hoursLeft   int
+		urgency     float32
+	}{
+		{
+			name:        "whole hours",
+			task:        &Task{Name: "Report", Deadline: "16:00 11/28/2022 EST", EstimatedHours: 1},
+			events:      []*GeneralEvent{},
+			freeMinutes: 42 * 60,
+			hoursLeft:   42,
+			urgency:     60.0 / (42 * 60),
+		},
+		{
+			name:        "a 9:30 to 10:15 event",
+			task:        &Task{Name: "Report", Deadline: "16:00 11/28/2022 EST", EstimatedMinutes: 45},
+			events:      []*GeneralEvent{standup},
+			freeMinutes: 42*60 - 45,
+			busyMinutes: 45,
+			hoursLeft:   41,
+			urgency:     45.0 / (42*60 - 45),
+		},
+		{
+			name:        "an 18:30 repeating deadline",
+			task:        &Task{Name: "Book club", Deadline: "18:30 first Sunday", EstimatedHours: 2},
+			events:      []*GeneralEvent{},
+			freeMinutes: 187*60 + 30,
+			hoursLeft:   187,
+			urgency:     120.0 / (187*60 + 30),
+		},
+	}
+	for _, test := range tests {
+		err := test.task.calculateUrgency(mid, test.events, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error calculating urgency for %s: %s", test.name, err.Error())
+			t.FailNow()
+		}
+		if test.task.FreeMinutes != test.freeMinutes || test.task.BusyMinutes != test.busyMinutes || test.task.RemainingHours != test.hoursLeft {
+			t.Errorf("Time left for %s didn't match;\nExpected: %d free, %d busy, %d hours\nActual: %d free, %d busy, %d hours", test.name,
+				test.freeMinutes, test.busyMinutes, test.hoursLeft, test.task.FreeMinutes, test.task.BusyMinutes, test.task.RemainingHours)
+			t.FailNow()
+		}
+		if test.task.Urgency != test.urgency {
+			t.Errorf("Urgency for %s didn't match;\nExpected: %f\nActual: %f", test.name, test.urgency, test.task.Urgency)
+		}
+	}
+}
+
+// check that an event with minutes blocks every hour it touches
+func TestMinuteBlockedHours(t *testing.T) {
+	tLogger := log15.New()
+	event := &GeneralEvent{
+		Name:            "Standup",
+		Rotation:        "first",
+		Days:            "Sunday",
+		StartTime:       9,
+		StartMinute:     30,
+		DurationMinutes: 45,
+	}
+	hours := event.generateBlockedHours(tLogger)
+	if len(hours) != 2 || hours[0] != 9 || hours[1] != 10 {
+		t.Errorf("Expected hour blocks 9 and 10, got %v", hours)
+	}
+	event.buildRaw()
+	expected := "\t- Standup\n\t\t- Rotation; first\n\t\t- Days; Sunday\n\t\t- Start Time; 09:30\n\t\t- Duration; 45m\n"
+	if event.Raw != expected {
+		t.Errorf("Event didn't write back out;\nExpected: %q\nActual: %q", expected, event.Raw)
+	}
+}
+
+// check that start time ranges read the length from the end time, on the next day when it's earlier
+func TestParseClockRange(t *testing.T) {
+	tests := []struct {
+		value  string
+		start  int
+		length int
+		ranged bool
+		fails  bool
+	}{
+		{value: "18", start: 18 * 60},
+		{value: "18:30", start: 18*60 + 30},
+		{value: "09:30-10:15", start: 9*60 + 30, length: 45, ranged: true},
+		{value: "22:00-06:00", start: 22 * 60, length: 8 * 60, ranged: true},
+		{value: "23 - 7", start: 23 * 60, length: 8 * 60, ranged: true},
+		{value: "9-9", fails: true},
+		{value: "9-", fails: true},
+		{value: "9-10-11", fails: true},
+	}
+	for _, test := range tests {
+		start, length, ranged, err := parseClockRange(test.value)
+		if (err != nil) != test.fails {
+			t.Errorf("Unexpected error state for '%s': %v", test.value, err)
+			t.FailNow()
+		}
+		if start != test.start || length != test.length || ranged != test.ranged {
+			t.Errorf("Range '%s' didn't match;\nExpected: %d %d %t\nActual: %d %d %t", test.value, test.start, test.length, test.ranged, start, length, ranged)
+			t.FailNow()
+		}
+	}
+}
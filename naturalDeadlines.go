@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Deadlines don't have to be typed out like "16:00 11/28/2022 EST". These are understood too, with or without a time
+// like "17:00", "5pm", "5:30 pm" or "noon" (optionally after "at"), before or after the day:
+//
+//	tomorrow 5pm          today, tonight and tomorrow
+//	friday, next friday   the first Friday after today; "friday" and "this friday" can be today
+//	in 3 days             or weeks or months; "in 2 hours" and "in 30 minutes" count from now, so take no time
+//	end of month          the last day of the month, "end of week" is Saturday, "end of day" is today
+//	11/28, 11/28/2022     a date without the year is the next one that hasn't gone by
+//	2022-11-28T17:00      ISO 8601, with or without the time or an offset like -05:00
+//
+// Without a time the deadline is at 23:00, the last hour block of the day. Since "tomorrow" means something else
+// tomorrow, these get written back into the To Do List as the dated deadline they stood for when they were read.
+
+// naturalDefaultHour is when a deadline that only gives the day is due
+const naturalDefaultHour = 23
+
+var twelveHourMatcher = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+
+var isoLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"}
+
+var relativeUnits = map[string]string{
+	"minute": "minute", "minutes": "minute", "min": "minute", "mins": "minute",
+	"hour": "hour", "hours": "hour", "hr": "hour", "hrs": "hour",
+	"day": "day", "days": "day", "week": "week", "weeks": "week", "month": "month", "months": "month",
+}
+
+// normalizeDeadlines writes deadlines given in words, see the top of this file, back as dated deadlines. It says
+// whether any task changed and needs writing back.
+func normalizeDeadlines(tasks []*Task, now time.Time, topLogger log15.Logger) bool {
+	changed := false
+	for _, task := range tasks {
+		if task.Deadline == "" || isDatedDeadline(task.Deadline) || isRuleDeadline(task.Deadline) {
+			continue
+		}
+		logger := topLogger.New("task", task.Name, "function", "normalizeDeadlines")
+		deadline, err := parseNaturalDeadline(task.Deadline, now)
+		if err != nil {
+			// most likely a repeating deadline like "18:00 first Monday"
+			logger.Debug("Deadline isn't in words", "deadline", task.Deadline, "err", err.Error())
+			continue
+		}
+		normalized := deadline.Format(taskDateFmt)
+		logger.Info("Writing out deadline", "from", task.Deadline, "deadline", normalized)
+		task.Deadline = normalized
+		task.DeadlineTime = deadline
+		task.setField("Deadline", normalized)
+		changed = true
+	}
+	return changed
+}
+
+// parseNaturalDeadline reads a deadline given in words as of now, see the top of this file
+func parseNaturalDeadline(value string, now time.Time) (time.Time, error) {
+	loc := now.Location()
+	trimmed := strings.TrimSpace(value)
+	if deadline, err := time.Parse(time.RFC3339, trimmed); err == nil {
+		return deadline.In(loc), nil
+	}
+	for _, layout := range isoLayouts {
+		if deadline, err := time.ParseInLocation(layout, trimmed, loc); err == nil {
+			return deadline, nil
+		}
+	}
+	words := strings.Fields(strings.ToLower(strings.Replace(trimmed, ",", " ", -1)))
+	hour, minute, words, err := takeClock(words, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	timed := hour >= 0
+	if !timed {
+		hour, minute = naturalDefaultHour, 0
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	day := today
+	switch {
+	case len(words) == 0:
+		if !timed {
+			return time.Time{}, fmt.Errorf("Deadline '%s' is empty", value)
+		}
+	case len(words) == 1 && (words[0] == "today" || words[0] == "tonight"):
+	case len(words) == 1 && words[0] == "tomorrow":
+		day = today.AddDate(0, 0, 1)
+	case words[0] == "in":
+		if len(words) != 3 {
+			return time.Time{}, fmt.Errorf("Deadline '%s' should be like 'in 3 days'", value)
+		}
+		num, numErr := strconv.Atoi(words[1])
+		if numErr != nil || num < 1 {
+			return time.Time{}, fmt.Errorf("Unable to parse '%s' in deadline '%s' as a number", words[1], value)
+		}
+		switch relativeUnits[words[2]] {
+		case "minute", "hour":
+			if timed {
+				return time.Time{}, fmt.Errorf("Deadline '%s' counts from now, so it can't have a time too", value)
+			}
+			unit := time.Minute
+			if relativeUnits[words[2]] == "hour" {
+				unit = time.Hour
+			}
+			return now.Add(time.Duration(num) * unit).Truncate(time.Minute), nil
+		case "day":
+			day = today.AddDate(0, 0, num)
+		case "week":
+			day = today.AddDate(0, 0, 7*num)
+		case "month":
+			day = today.AddDate(0, num, 0)
+		default:
+			return time.Time{}, fmt.Errorf("Unable to parse '%s' in deadline '%s'; expected days, weeks, months, hours or minutes", words[2], value)
+		}
+	case words[0] == "end":
+		if len(words) < 3 || words[1] != "of" || (len(words) == 4 && words[2] != "the") || len(words) > 4 {
+			return time.Time{}, fmt.Errorf("Deadline '%s' should be like 'end of month'", value)
+		}
+		switch words[len(words)-1] {
+		case "day":
+		case "week":
+			day = today.AddDate(0, 0, int(time.Saturday-today.Weekday()))
+		case "month":
+			day = time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, loc)
+		default:
+			return time.Time{}, fmt.Errorf("Unable to parse '%s' in deadline '%s'; expected day, week or month", words[len(words)-1], value)
+		}
+	default:
+		day, err = parseNaturalDay(words, today, value)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc), nil
+}
+
+// takeClock pulls the time of day out of the words of a deadline, returning the hour as -1 when there isn't one
+func takeClock(words []string, value string) (hour, minute int, rest []string, err error) {
+	hour = -1
+	for index := 0; index < len(words); index++ {
+		word := words[index]
+		if word == "at" {
+			continue
+		}
+		if index+1 < len(words) && (words[index+1] == "am" || words[index+1] == "pm") {
+			word += words[index+1]
+			index++
+		}
+		clockHour, clockMinute, ok := parseTwelveHour(word)
+		if word == "noon" {
+			clockHour, clockMinute, ok = 12, 0, true
+		}
+		if !ok {
+			if matches := twelveHourMatcher.FindStringSubmatch(word); matches != nil && (matches[2] != "" || matches[3] != "") {
+				return 0, 0, nil, fmt.Errorf("Unable to parse '%s' in deadline '%s' as a time like 5pm or 17:00", word, value)
+			}
+			rest = append(rest, words[index])
+			continue
+		}
+		if hour >= 0 {
+			return 0, 0, nil, fmt.Errorf("Deadline '%s' has more than one time of day", value)
+		}
+		hour, minute = clockHour, clockMinute
+	}
+	return hour, minute, rest, nil
+}
+
+// parseTwelveHour reads "5pm", "5:30pm" or "17:00". A bare number isn't a time, it's likely a count like in "in 3 days".
+func parseTwelveHour(word string) (hour, minute int, ok bool) {
+	matches := twelveHourMatcher.FindStringSubmatch(word)
+	if matches == nil || (matches[2] == "" && matches[3] == "") {
+		return 0, 0, false
+	}
+	hour, _ = strconv.Atoi(matches[1])
+	if matches[2] != "" {
+		minute, _ = strconv.Atoi(matches[2])
+	}
+	if minute > 59 {
+		return 0, 0, false
+	}
+	switch matches[3] {
+	case "":
+		if hour > 23 {
+			return 0, 0, false
+		}
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if matches[3] == "pm" {
+			hour += 12
+		}
+	}
+	return hour, minute, true
+}
+
+// parseNaturalDay reads a weekday, optionally after "this", "next" or "on", or a date with or without the year
+func parseNaturalDay(words []string, today time.Time, value string) (time.Time, error) {
+	if len(words) == 2 && (words[0] == "this" || words[0] == "next" || words[0] == "on") {
+		weekday, err := getWeekday(words[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Unable to parse '%s' in deadline '%s' as a weekday", words[1], value)
+		}
+		ahead := (int(weekday) - int(today.Weekday()) + 7) % 7
+		if ahead == 0 && words[0] == "next" {
+			ahead = 7
+		}
+		return today.AddDate(0, 0, ahead), nil
+	}
+	if len(words) != 1 {
+		return time.Time{}, fmt.Errorf("Unable to parse deadline '%s'", value)
+	}
+	if weekday, err := getWeekday(words[0]); err == nil {
+		return today.AddDate(0, 0, (int(weekday)-int(today.Weekday())+7)%7), nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", words[0], today.Location()); err == nil {
+		return date, nil
+	}
+	if date, err := time.ParseInLocation("1/2/2006", words[0], today.Location()); err == nil {
+		return date, nil
+	}
+	if date, err := time.ParseInLocation("1/2", words[0], today.Location()); err == nil {
+		date = time.Date(today.Year(), date.Month(), date.Day(), 0, 0, 0, 0, today.Location())
+		if date.Before(today) {
+			date = date.AddDate(1, 0, 0)
+		}
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("Unable to parse '%s' in deadline '%s' as a day", words[0], value)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that deadlines in words land where they should from a Saturday evening
+func TestParseNaturalDeadline(t *testing.T) {
+	mid := generateTestingTimes()["mid"]
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2022, month, day, hour, minute, 0, 0, mid.Location())
+	}
+	tests := []struct {
+		deadline string
+		expected time.Time
+	}{
+		{deadline: "tomorrow 5pm", expected: at(11, 27, 17, 0)},
+		{deadline: "Tomorrow at 5:30 PM", expected: at(11, 27, 17, 30)},
+		{deadline: "tomorrow", expected: at(11, 27, 23, 0)},
+		{deadline: "tonight", expected: at(11, 26, 23, 0)},
+		{deadline: "noon tomorrow", expected: at(11, 27, 12, 0)},
+		{deadline: "12am tomorrow", expected: at(11, 27, 0, 0)},
+		{deadline: "next Friday", expected: at(12, 2, 23, 0)},
+		{deadline: "Friday 09:00", expected: at(12, 2, 9, 0)},
+		// it's Saturday already
+		{deadline: "saturday", expected: at(11, 26, 23, 0)},
+		{deadline: "next saturday", expected: at(12, 3, 23, 0)},
+		{deadline: "in 3 days", expected: at(11, 29, 23, 0)},
+		{deadline: "in 2 weeks at 10am", expected: at(12, 10, 10, 0)},
+		{deadline: "in 1 month", expected: at(12, 26, 23, 0)},
+		{deadline: "in 90 minutes", expected: at(11, 26, 23, 30)},
+		{deadline: "in 2 hours", expected: at(11, 27, 0, 0)},
+		{deadline: "end of month", expected: at(11, 30, 23, 0)},
+		{deadline: "end of the week 5pm", expected: at(11, 26, 17, 0)},
+		{deadline: "5pm 11/28/2022", expected: at(11, 28, 17, 0)},
+		// 01/05 has gone by this year
+		{deadline: "1/5 9am", expected: time.Date(2023, 1, 5, 9, 0, 0, 0, mid.Location())},
+		{deadline: "2022-11-28", expected: at(11, 28, 23, 0)},
+		{deadline: "2022-11-28T17:00", expected: at(11, 28, 17, 0)},
+		{deadline: "2022-11-28 17:00", expected: at(11, 28, 17, 0)},
+		{deadline: "2022-11-28T17:00:00Z", expected: time.Date(2022, 11, 28, 17, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		deadline, err := parseNaturalDeadline(test.deadline, mid)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %s", test.deadline, err.Error())
+			continue
+		}
+		if !deadline.Equal(test.expected) {
+			t.Errorf("Deadline '%s' didn't match;\nExpected: %s\nActual: %s", test.deadline, test.expected, deadline)
+		}
+	}
+}
+
+// check that repeating deadlines aren't mistaken for ones in words, and that mistakes name what's wrong
+func TestParseNaturalDeadlineErrors(t *testing.T) {
+	mid := generateTestingTimes()["mid"]
+	for _, repeating := range []string{"18:00 first Monday", "09:00 both Mon-Fri", "18:00 week 1,3 Tue"} {
+		if _, err := parseNaturalDeadline(repeating, mid); err == nil {
+			t.Errorf("Expected '%s' not to be read as a deadline in words", repeating)
+		}
+	}
+	tests := []struct {
+		deadline string
+		token    string
+	}{
+		{deadline: "next Fridya", token: "'Fridya'"},
+		{deadline: "in three days", token: "'three'"},
+		{deadline: "in 3 fortnights", token: "'fortnights'"},
+		{deadline: "end of year", token: "'year'"},
+		{deadline: "someday", token: "'someday'"},
+		{deadline: "13pm tomorrow", token: "'13pm'"},
+		{deadline: "in 2 hours 5pm", token: "counts from now"},
+		{deadline: "5pm tomorrow 6pm", token: "more than one time"},
+	}
+	for _, test := range tests {
+		_, err := parseNaturalDeadline(test.deadline, mid)
+		if err == nil || !strings.Contains(strings.ToLower(err.Error()), strings.ToLower(test.token)) {
+			t.Errorf("Expected the error for '%s' to mention %s, got %v", test.deadline, test.token, err)
+		}
+	}
+}
+
+// check that deadlines in words are written back into the To Do List as dated ones and the rest are left alone
+func TestNormalizeDeadlines(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	_, tasks := mdToStructs([]string{
+		"- " + upcomingTasks,
+		"\t- Report",
+		"\t\t- Deadline; tomorrow 5pm",
+		"\t\t- Estimated Hours; 2",
+		"\t- Chores",
+		"\t\t- Deadline; 18:00 both Sunday",
+		"\t\t- Estimated Hours; 1",
+		"\t- Rent",
+		"\t\t- Deadline; 09:00 the 1st",
+		"\t\t- Estimated Hours; 1",
+		"\t- Taxes",
+		"\t\t- Deadline; 16:00 04/18/2023",
+		"\t\t- Estimated Hours; 4",
+	}, tLogger)
+	if !normalizeDeadlines(tasks, mid, tLogger) {
+		t.Errorf("Expected the report's deadline to be written out")
+	}
+	expected := []string{"17:00 11/27/2022 EST", "18:00 both Sunday", "09:00 the 1st", "16:00 04/18/2023"}
+	for index, task := range tasks {
+		if task.Deadline != expected[index] {
+			t.Errorf("Deadline of %s didn't match;\nExpected: %s\nActual: %s", task.Name, expected[index], task.Deadline)
+		}
+	}
+	_, reread := mdToStructs(strings.Split(outputTasks(tasks), "\n"), tLogger)
+	for _, task := range reread {
+		if task.Name == "Report" && task.Deadline != "17:00 11/27/2022 EST" {
+			t.Errorf("Written out deadline didn't survive the To Do List:\n%s", outputTasks(tasks))
+		}
+	}
+	if normalizeDeadlines(reread, mid, tLogger) {
+		t.Errorf("Expected nothing left to write out")
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Repeating tasks are done once per occurrence. The task keeps track of which deadline it's working towards in an
+// "Occurrence" field, and once that passes it starts over at its "Base Estimate" (taken from Estimated Hours the first
+// time the task is seen, or an hour if it's already done by then) for the next one. An occurrence that passes before
+// it's done is Overdue until the one after it passes too, and finishing the task in the meantime counts for the overdue
+// one, late, before starting over again. How each occurrence went is kept in "History", most recent last, along with a
+// "Streak" of occurrences done on time.
+//
+// Chores like watering the plants come up again a while after they were last done instead. Those have a dated
+// Deadline and a "Repeat After" field like "5 days", "2 weeks" or "36h". Finishing one records when in a "Completed"
+// field, moves the Deadline on to that long after, and starts over at the Base Estimate. They keep a History and
+// Streak too, on time when they were finished before the deadline.
+
+const (
+	onTime = "on time"
+	late   = "late"
+	missed = "missed"
+
+	// historyLength is how many occurrences History keeps
+	historyLength = 10
+	// defaultBaseEstimate is the Base Estimate, in minutes, of a repeating task that's already done when it's first seen
+	defaultBaseEstimate = 60
+)
+
+// trackOccurrences moves repeating tasks on to their next occurrence once the one they're working towards has
+// passed, recording how it went. It says whether any task changed and needs writing back.
+func trackOccurrences(tasks []*Task, now time.Time, topLogger log15.Logger) bool {
+	changed := false
+	for _, task := range tasks {
+		logger := topLogger.New("task", task.Name, "function", "trackOccurrences")
+		if task.validate() != nil {
+			continue
+		}
+		var taskChanged bool
+		var err error
+		switch {
+		case task.RepeatAfter != "":
+			taskChanged, err = task.trackFloating(now, logger)
+		case isDatedDeadline(task.Deadline):
+			continue
+		default:
+			taskChanged, err = task.trackOccurrence(now, logger)
+		}
+		if err != nil {
+			logger.Warn("Unable to track occurrences of repeating task", "err", err.Error())
+			continue
+		}
+		changed = changed || taskChanged
+	}
+	return changed
+}
+
+// trackOccurrence brings one repeating task up to date, see the top of this file
+func (t *Task) trackOccurrence(now time.Time, logger log15.Logger) (bool, error) {
+	next, err := t.occurrenceAfter(now, logger)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	if t.BaseEstimate == 0 {
+		t.takeBaseEstimate(logger)
+		changed = true
+	}
+	if t.Occurrence.IsZero() {
+		t.setOccurrence(next)
+		return true, nil
+	}
+	if t.Occurrence.Before(next) {
+		// the occurrence being worked towards has passed, along with any others since, so the overdue one is too late
+		if !t.Overdue.IsZero() {
+			t.recordOccurrence(t.Overdue, missed, logger)
+			t.Overdue = time.Time{}
+		}
+		if t.isComplete() {
+			t.recordOccurrence(t.Occurrence, onTime, logger)
+		} else {
+			t.Overdue = t.Occurrence
+		}
+		for passed, err := t.occurrenceAfter(t.Occurrence, logger); err == nil && passed.Before(next); passed, err = t.occurrenceAfter(passed, logger) {
+			if !t.Overdue.IsZero() {
+				t.recordOccurrence(t.Overdue, missed, logger)
+			}
+			t.Overdue = passed
+		}
+		t.setOccurrence(next)
+		t.startOver(logger)
+		changed = true
+	} else if t.isComplete() && !t.Overdue.IsZero() {
+		// finishing while an occurrence is overdue counts for that one
+		t.recordOccurrence(t.Overdue, late, logger)
+		t.Overdue = time.Time{}
+		t.startOver(logger)
+		changed = true
+	}
+	if t.Overdue.IsZero() {
+		t.removeField("Overdue")
+	} else {
+		t.setField("Overdue", t.Overdue.Format(taskDateFmt))
+	}
+	return changed, nil
+}
+
+// trackFloating moves the deadline of a task that repeats after it's done on from when it was finished
+func (t *Task) trackFloating(now time.Time, logger log15.Logger) (bool, error) {
+	days, minutes, err := parseInterval(t.RepeatAfter)
+	if err != nil {
+		return false, err
+	}
+	deadline, err := parseDeadline(t.Deadline)
+	if err != nil {
+		return false, fmt.Errorf("Task '%s' repeats after it's done, so it needs a dated deadline rather than '%s'", t.Name, t.Deadline)
+	}
+	changed := false
+	if t.BaseEstimate == 0 {
+		t.takeBaseEstimate(logger)
+		changed = true
+	}
+	if !t.isComplete() {
+		return changed, nil
+	}
+	outcome := onTime
+	if now.After(deadline) {
+		outcome = late
+	}
+	t.recordOccurrence(deadline.In(now.Location()), outcome, logger)
+	t.Completed = now
+	t.setField("Completed", now.Format(taskDateFmt))
+	next := now.AddDate(0, 0, days).Add(time.Duration(minutes) * time.Minute)
+	logger.Info("Moving deadline on from when the task was done", "deadline", next)
+	t.Deadline = next.Format(taskDateFmt)
+	t.DeadlineTime = next
+	t.setField("Deadline", t.Deadline)
+	t.startOver(logger)
+	return true, nil
+}
+
+// takeBaseEstimate starts keeping track of a repeating task with its estimate as the Base Estimate. If it's already
+// done there's no estimate to take, so it gets an hour to be adjusted in the To Do List.
+func (t *Task) takeBaseEstimate(logger log15.Logger) {
+	t.BaseEstimate = t.estimateMinutes()
+	if t.isComplete() {
+		logger.Warn("Repeating task was already done when first seen, starting over at a default Base Estimate",
+			"estimate", formatDuration(defaultBaseEstimate))
+		t.BaseEstimate = defaultBaseEstimate
+	}
+	t.setField("Base Estimate", formatDuration(t.BaseEstimate))
+}
+
+// parseInterval reads how long after it's done a task comes up again, as days and minutes so that days keep to the
+// wall clock: "5 days", "1 week", "2 weeks", or a duration like "36h" or "1h30m"
+func parseInterval(value string) (days, minutes int, err error) {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) == 2 {
+		num, numErr := strconv.Atoi(fields[0])
+		if numErr != nil || num < 1 {
+			return 0, 0, fmt.Errorf("Unable to parse '%s' in Repeat After '%s' as a number", fields[0], value)
+		}
+		switch fields[1] {
+		case "day", "days":
+			return num, 0, nil
+		case "week", "weeks":
+			return 7 * num, 0, nil
+		default:
+			return 0, 0, fmt.Errorf("Unable to parse '%s' in Repeat After '%s'; expected days or weeks", fields[1], value)
+		}
+	}
+	minutes, err = parseDuration(value)
+	if err != nil || minutes <= 0 {
+		return 0, 0, fmt.Errorf("Unable to parse Repeat After '%s' as a number of days or weeks, or a duration like 36h", value)
+	}
+	return 0, minutes, nil
+}
+
+// occurrenceAfter is the first deadline of a repeating task after at, the same as the urgency would be counted to
+func (t *Task) occurrenceAfter(at time.Time, logger log15.Logger) (time.Time, error) {
+	resolved := t.DeadlineTime
+	defer func() { t.DeadlineTime = resolved }()
+	if _, err := t.deadlineWindow(at, logger); err != nil {
+		return time.Time{}, err
+	}
+	return t.DeadlineTime, nil
+}
+
+func (t *Task) setOccurrence(occurrence time.Time) {
+	t.Occurrence = occurrence
+	t.setField("Occurrence", occurrence.Format(taskDateFmt))
+}
+
+// recordOccurrence adds how an occurrence went to the history and keeps the streak
+func (t *Task) recordOccurrence(occurrence time.Time, outcome string, logger log15.Logger) {
+	logger.Info("Recording occurrence of repeating task", "occurrence", occurrence, "outcome", outcome)
+	t.History = append(t.History, occurrence.Format(taskDateFmt)+" "+outcome)
+	if len(t.History) > historyLength {
+		t.History = t.History[len(t.History)-historyLength:]
+	}
+	if outcome == onTime {
+		t.Streak++
+	} else {
+		t.Streak = 0
+	}
+	t.setField("History", strings.Join(t.History, ", "))
+	t.setField("Streak", strconv.Itoa(t.Streak))
+}
+
+// startOver puts the estimate back to the base estimate for the next occurrence
+func (t *Task) startOver(logger log15.Logger) {
+	logger.Debug("Starting repeating task over", "estimate", t.BaseEstimate)
+	t.setEstimate(t.BaseEstimate)
+	t.setField("Estimated Hours", formatDuration(t.BaseEstimate))
+}
+
+// parseOccurrence reads an Occurrence or Overdue field
+func parseOccurrence(value string) (time.Time, error) {
+	occurrence, err := parseDeadline(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to parse occurrence '%s' as a time like %s", value, taskDateFmt)
+	}
+	return occurrence, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that a repeating task starts over after each deadline and keeps track of how each occurrence went
+func TestTrackOccurrences(t *testing.T) {
+	tLogger := log15.New()
+	loc := generateTestingTimes()["mid"].Location()
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2022, month, day, hour, minute, 0, 0, loc)
+	}
+	_, tasks := mdToStructs([]string{
+		"- " + upcomingTasks,
+		"\t- Read For Book Club",
+		"\t\t- Deadline; 18:00 both Tuesday, Thursday",
+		"\t\t- Estimated Hours; 1h30m",
+	}, tLogger)
+	bookClub := tasks[0]
+	steps := []struct {
+		name       string
+		now        time.Time
+		finish     bool
+		occurrence time.Time
+		overdue    time.Time
+		last       string
+		streak     int
+		estimate   int
+	}{
+		{name: "first seen", now: at(11, 26, 22, 0), occurrence: at(11, 29, 18, 0), estimate: 90},
+		{name: "done early", now: at(11, 29, 12, 0), finish: true, occurrence: at(11, 29, 18, 0), estimate: 0},
+		{name: "deadline passed", now: at(11, 29, 19, 30), occurrence: at(12, 1, 18, 0), last: "18:00 11/29/2022 EST on time", streak: 1, estimate: 90},
+		{name: "done again", now: at(12, 1, 12, 0), finish: true, occurrence: at(12, 1, 18, 0), last: "18:00 11/29/2022 EST on time", streak: 1, estimate: 0},
+		{name: "streak", now: at(12, 1, 20, 0), occurrence: at(12, 6, 18, 0), last: "18:00 12/01/2022 EST on time", streak: 2, estimate: 90},
+		{name: "not done", now: at(12, 6, 20, 0), occurrence: at(12, 8, 18, 0), overdue: at(12, 6, 18, 0), last: "18:00 12/01/2022 EST on time", streak: 2, estimate: 90},
+		{name: "done late", now: at(12, 7, 9, 0), finish: true, occurrence: at(12, 8, 18, 0), last: "18:00 12/06/2022 EST late", streak: 0, estimate: 90},
+		{name: "not done again", now: at(12, 8, 19, 0), occurrence: at(12, 13, 18, 0), overdue: at(12, 8, 18, 0), last: "18:00 12/06/2022 EST late", estimate: 90},
+		// 12/08 is too late now, and 12/13 went by without a refresh
+		{name: "away for a week", now: at(12, 16, 10, 0), occurrence: at(12, 20, 18, 0), overdue: at(12, 15, 18, 0), last: "18:00 12/13/2022 EST missed", estimate: 90},
+	}
+	for _, step := range steps {
+		if step.finish {
+			bookClub.setEstimate(0)
+		}
+		if _, err := bookClub.trackOccurrence(step.now, tLogger); err != nil {
+			t.Errorf("Unexpected error tracking occurrences for %s: %s", step.name, err.Error())
+			t.FailNow()
+		}
+		last := ""
+		if len(bookClub.History) != 0 {
+			last = bookClub.History[len(bookClub.History)-1]
+		}
+		if !bookClub.Occurrence.Equal(step.occurrence) || !bookClub.Overdue.Equal(step.overdue) || last != step.last ||
+			bookClub.Streak != step.streak || bookClub.estimateMinutes() != step.estimate {
+			t.Errorf("Task after %s didn't match;\nExpected: %s, overdue %s, %q, streak %d, %d minutes\nActual: %s, overdue %s, %q, streak %d, %d minutes",
+				step.name, step.occurrence, step.overdue, step.last, step.streak, step.estimate,
+				bookClub.Occurrence, bookClub.Overdue, last, bookClub.Streak, bookClub.estimateMinutes())
+			t.FailNow()
+		}
+	}
+	if len(bookClub.History) != 5 || !strings.HasSuffix(bookClub.History[3], "missed") {
+		t.Errorf("Expected two on time, one late and two missed, got %v", bookClub.History)
+	}
+	// everything has to make it through the To Do List
+	_, reread := mdToStructs(strings.Split(outputTasks([]*Task{bookClub}), "\n"), tLogger)
+	if len(reread) != 1 || reread[0].BaseEstimate != 90 || !reread[0].Occurrence.Equal(bookClub.Occurrence) ||
+		!reread[0].Overdue.Equal(bookClub.Overdue) || strings.Join(reread[0].History, ", ") != strings.Join(bookClub.History, ", ") ||
+		reread[0].Streak != bookClub.Streak || reread[0].estimateMinutes() != 90 {
+		t.Errorf("Occurrences didn't survive the To Do List:\n%s", outputTasks([]*Task{bookClub}))
+	}
+}
+
+// check that dated tasks are left alone, and that repeating tasks that were already done when first seen still start
+// over for the next occurrence
+func TestTrackOccurrencesSkips(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	report := &Task{Name: "Report", Deadline: "16:00 11/28/2022", EstimatedHours: 2}
+	chores := &Task{Name: "Chores", Deadline: "18:00 both Sunday"}
+	if !trackOccurrences([]*Task{report, chores}, mid, tLogger) {
+		t.Errorf("Expected the chores to start being tracked")
+	}
+	if !report.Occurrence.IsZero() || report.Raw != "" {
+		t.Errorf("Expected the report not to be tracked, got %v", report.Occurrence)
+	}
+	if chores.BaseEstimate != defaultBaseEstimate || chores.Occurrence.IsZero() || !strings.Contains(chores.Raw, "Base Estimate; 1") {
+		t.Errorf("Expected the chores to get a default Base Estimate, got %d:\n%s", chores.BaseEstimate, chores.Raw)
+	}
+	if trackOccurrences([]*Task{report, chores}, chores.Occurrence.Add(time.Hour), tLogger); chores.estimateMinutes() != defaultBaseEstimate ||
+		chores.Streak != 1 {
+		t.Errorf("Expected the chores to start over after the deadline, got %d minutes and a streak of %d", chores.estimateMinutes(), chores.Streak)
+	}
+}
+
+// check that chores that repeat after they're done move their deadline on from when they were finished
+func TestFloatingRecurrence(t *testing.T) {
+	tLogger := log15.New()
+	loc := generateTestingTimes()["mid"].Location()
+	at := func(month time.Month, day, hour int) time.Time {
+		return time.Date(2022, month, day, hour, 0, 0, 0, loc)
+	}
+	_, tasks := mdToStructs([]string{
+		"- " + upcomingTasks,
+		"\t- Water plants",
+		"\t\t- Deadline; 18:00 11/28/2022",
+		"\t\t- Estimated Hours; 15m",
+		"\t\t- Repeat After; 5 days",
+	}, tLogger)
+	plants := tasks[0]
+	steps := []struct {
+		name     string
+		now      time.Time
+		finish   bool
+		changed  bool
+		deadline string
+		last     string
+		streak   int
+	}{
+		{name: "first seen", now: at(11, 26, 22), changed: true, deadline: "18:00 11/28/2022"},
+		{name: "nothing new", now: at(11, 27, 8), deadline: "18:00 11/28/2022"},
+		{name: "watered early", now: at(11, 27, 10), finish: true, changed: true, deadline: "10:00 12/02/2022 EST", last: "18:00 11/28/2022 EST on time", streak: 1},
+		{name: "watered late", now: at(12, 3, 9), finish: true, changed: true, deadline: "09:00 12/08/2022 EST", last: "10:00 12/02/2022 EST late"},
+	}
+	for _, step := range steps {
+		if step.finish {
+			plants.setEstimate(0)
+		}
+		changed, err := plants.trackFloating(step.now, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error tracking %s: %s", step.name, err.Error())
+			t.FailNow()
+		}
+		last := ""
+		if len(plants.History) != 0 {
+			last = plants.History[len(plants.History)-1]
+		}
+		if changed != step.changed || plants.Deadline != step.deadline || last != step.last || plants.Streak != step.streak || plants.estimateMinutes() != 15 {
+			t.Errorf("Task after %s didn't match;\nExpected: %t %q %q streak %d\nActual: %t %q %q streak %d, %d minutes",
+				step.name, step.changed, step.deadline, step.last, step.streak, changed, plants.Deadline, last, plants.Streak, plants.estimateMinutes())
+			t.FailNow()
+		}
+	}
+	_, reread := mdToStructs(strings.Split(outputTasks([]*Task{plants}), "\n"), tLogger)
+	if len(reread) != 1 || reread[0].Deadline != "09:00 12/08/2022 EST" || reread[0].RepeatAfter != "5 days" ||
+		!reread[0].Completed.Equal(at(12, 3, 9)) || reread[0].estimateMinutes() != 15 {
+		t.Errorf("Floating recurrence didn't survive the To Do List:\n%s", outputTasks([]*Task{plants}))
+	}
+	rotation := &Task{Name: "Water plants", Deadline: "18:00 both Sunday", EstimatedMinutes: 15, RepeatAfter: "5 days"}
+	if _, err := rotation.trackFloating(at(11, 26, 22), tLogger); err == nil {
+		t.Errorf("Expected an error for a floating task without a dated deadline")
+	}
+}
+
+// check the intervals floating tasks can repeat after
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		value   string
+		days    int
+		minutes int
+		token   string
+	}{
+		{value: "5 days", days: 5},
+		{value: "1 Week", days: 7},
+		{value: "36h", minutes: 36 * 60},
+		{value: "1h30m", minutes: 90},
+		{value: "five days", token: "'five'"},
+		{value: "5 fortnights", token: "'fortnights'"},
+		{value: "soon", token: "'soon'"},
+	}
+	for _, test := range tests {
+		days, minutes, err := parseInterval(test.value)
+		if test.token != "" {
+			if err == nil || !strings.Contains(err.Error(), test.token) {
+				t.Errorf("Expected the error for '%s' to name %s, got %v", test.value, test.token, err)
+			}
+			continue
+		}
+		if err != nil || days != test.days || minutes != test.minutes {
+			t.Errorf("Interval '%s' didn't match;\nExpected: %d days %d minutes\nActual: %d days %d minutes (%v)", test.value, test.days, test.minutes, days, minutes, err)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrenceRule is a parsed RFC 5545 RRULE. It covers the parts calendars actually use: FREQ, INTERVAL, COUNT,
+// UNTIL, WKST, BYDAY (with ordinals such as -1FR for monthly and yearly rules), BYMONTHDAY and BYMONTH.
+type recurrenceRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	weekStart  time.Weekday
+	byDay      []ruleWeekday
+	byMonthDay []int
+	byMonth    []time.Month
+}
+
+// ruleWeekday is one BYDAY entry; an ordinal of 0 means every such weekday, -1 means the last one and so on
+type ruleWeekday struct {
+	ordinal int
+	day     time.Weekday
+}
+
+var ruleWeekdayMatcher = regexp.MustCompile(`^([+-]?\d{1,2})?(SU|MO|TU|WE|TH|FR|SA)$`)
+
+// a recurrence with no COUNT or UNTIL still has to stop somewhere, so no more than this many instances are listed
+// for one window
+const maxRecurrences = 10000
+
+// parseRRule parses the value of an RRULE property, with or without the leading "RRULE:". Errors name the part of
+// the rule that couldn't be understood.
+func parseRRule(value string) (*recurrenceRule, error) {
+	rule := &recurrenceRule{interval: 1, weekStart: time.Monday}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 || keyValue[1] == "" {
+			return nil, fmt.Errorf("Unable to parse '%s' in recurrence rule '%s'; expected KEY=VALUE", part, value)
+		}
+		key, val := strings.ToUpper(keyValue[0]), strings.ToUpper(keyValue[1])
+		switch key {
+		case "FREQ":
+			switch val {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				rule.freq = val
+			default:
+				return nil, fmt.Errorf("Unable to use FREQ '%s' in recurrence rule '%s'; expected DAILY, WEEKLY, MONTHLY or YEARLY", val, value)
+			}
+		case "INTERVAL":
+			num, err := strconv.Atoi(val)
+			if err != nil || num < 1 {
+				return nil, fmt.Errorf("Unable to parse INTERVAL '%s' in recurrence rule '%s'", val, value)
+			}
+			rule.interval = num
+		case "COUNT":
+			num, err := strconv.Atoi(val)
+			if err != nil || num < 1 {
+				return nil, fmt.Errorf("Unable to parse COUNT '%s' in recurrence rule '%s'", val, value)
+			}
+			rule.count = num
+		case "UNTIL":
+			until, err := parseICSTime(val, nil, time.UTC)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse UNTIL '%s' in recurrence rule '%s'", val, value)
+			}
+			rule.until = until
+		case "WKST":
+			day, ok := icsWeekday(val)
+			if !ok {
+				return nil, fmt.Errorf("Unable to parse WKST '%s' in recurrence rule '%s'", val, value)
+			}
+			rule.weekStart = day
+		case "BYDAY":
+			for _, token := range strings.Split(val, ",") {
+				matches := ruleWeekdayMatcher.FindStringSubmatch(token)
+				if matches == nil {
+					return nil, fmt.Errorf("Unable to parse BYDAY '%s' in recurrence rule '%s'", token, value)
+				}
+				ordinal := 0
+				if matches[1] != "" {
+					ordinal, _ = strconv.Atoi(matches[1])
+				}
+				day, _ := icsWeekday(matches[2])
+				rule.byDay = append(rule.byDay, ruleWeekday{ordinal: ordinal, day: day})
+			}
+		case "BYMONTHDAY":
+			for _, token := range strings.Split(val, ",") {
+				num, err := strconv.Atoi(token)
+				if err != nil || num == 0 || num > 31 || num < -31 {
+					return nil, fmt.Errorf("Unable to parse BYMONTHDAY '%s' in recurrence rule '%s'", token, value)
+				}
+				rule.byMonthDay = append(rule.byMonthDay, num)
+			}
+		case "BYMONTH":
+			for _, token := range strings.Split(val, ",") {
+				num, err := strconv.Atoi(token)
+				if err != nil || num < 1 || num > 12 {
+					return nil, fmt.Errorf("Unable to parse BYMONTH '%s' in recurrence rule '%s'", token, value)
+				}
+				rule.byMonth = append(rule.byMonth, time.Month(num))
+			}
+		default:
+			return nil, fmt.Errorf("Unable to use '%s' in recurrence rule '%s'", key, value)
+		}
+	}
+	if rule.freq == "" {
+		return nil, fmt.Errorf("Recurrence rule '%s' is missing FREQ", value)
+	}
+	return rule, nil
+}
+
+func icsWeekday(code string) (time.Weekday, bool) {
+	for index, weekday := range icsWeekdays {
+		if weekday == code {
+			return time.Weekday(index), true
+		}
+	}
+	return time.Weekday(-1), false
+}
+
+// occurrences lists the starts of the instances of the rule from from up to and including until. dtstart always
+// counts as the first instance. Instances keep dtstart's wall clock time in its location, so they don't move across
+// daylight saving changes. Without a COUNT there's nothing to count from dtstart, so it skips ahead to the period
+// around from rather than expanding years of instances nobody asked for.
+func (rule *recurrenceRule) occurrences(dtstart, from, until time.Time) []time.Time {
+	if !rule.until.IsZero() && rule.until.Before(until) {
+		until = rule.until
+	}
+	found := []time.Time{}
+	if !dtstart.Before(from) && !dtstart.After(until) {
+		found = append(found, dtstart)
+	}
+	counted := 1
+	for period := rule.firstPeriod(dtstart, from); len(found) < maxRecurrences; period++ {
+		candidates := rule.periodCandidates(dtstart, period)
+		if len(candidates) == 0 && rule.periodStart(dtstart, period).After(until) {
+			break
+		}
+		passedUntil := false
+		for _, candidate := range candidates {
+			if !candidate.After(dtstart) {
+				continue
+			}
+			if candidate.After(until) {
+				passedUntil = true
+				break
+			}
+			counted++
+			if rule.count != 0 && counted > rule.count {
+				return found
+			}
+			if !candidate.Before(from) {
+				found = append(found, candidate)
+			}
+		}
+		if passedUntil {
+			break
+		}
+	}
+	return found
+}
+
+// firstPeriod is the period to start expanding from so nothing at or after from is missed, a period early to allow
+// for daylight saving changes and periods that start part way through
+func (rule *recurrenceRule) firstPeriod(dtstart, from time.Time) int {
+	if rule.count != 0 || !from.After(dtstart) {
+		return 0
+	}
+	elapsed := 0
+	switch rule.freq {
+	case "DAILY":
+		elapsed = int(from.Sub(dtstart).Hours() / 24)
+	case "WEEKLY":
+		elapsed = int(from.Sub(dtstart).Hours() / (24 * 7))
+	case "MONTHLY":
+		elapsed = (from.Year()-dtstart.Year())*12 + int(from.Month()) - int(dtstart.Month())
+	default:
+		elapsed = from.Year() - dtstart.Year()
+	}
+	if period := elapsed/rule.interval - 1; period > 0 {
+		return period
+	}
+	return 0
+}
+
+// periodStart is midnight at the start of the given day, week, month or year of the rule
+func (rule *recurrenceRule) periodStart(dtstart time.Time, period int) time.Time {
+	year, month, day := dtstart.Date()
+	loc := dtstart.Location()
+	step := period * rule.interval
+	switch rule.freq {
+	case "DAILY":
+		return time.Date(year, month, day+step, 0, 0, 0, 0, loc)
+	case "WEEKLY":
+		back := (int(dtstart.Weekday()) - int(rule.weekStart) + 7) % 7
+		return time.Date(year, month, day-back+7*step, 0, 0, 0, 0, loc)
+	case "MONTHLY":
+		return time.Date(year, month+time.Month(step), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year+step, time.January, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// periodCandidates lists the instances that fall in one period, in order
+func (rule *recurrenceRule) periodCandidates(dtstart time.Time, period int) []time.Time {
+	start := rule.periodStart(dtstart, period)
+	days := []time.Time{}
+	switch rule.freq {
+	case "DAILY":
+		days = append(days, start)
+	case "WEEKLY":
+		if len(rule.byDay) == 0 {
+			days = append(days, start.AddDate(0, 0, (int(dtstart.Weekday())-int(rule.weekStart)+7)%7))
+		}
+		for _, byDay := range rule.byDay {
+			days = append(days, start.AddDate(0, 0, (int(byDay.day)-int(rule.weekStart)+7)%7))
+		}
+	case "MONTHLY":
+		days = rule.monthDays(start, dtstart)
+	case "YEARLY":
+		months := rule.byMonth
+		if len(months) == 0 {
+			months = []time.Month{dtstart.Month()}
+		}
+		for _, month := range months {
+			days = append(days, rule.monthDays(time.Date(start.Year(), month, 1, 0, 0, 0, 0, start.Location()), dtstart)...)
+		}
+	}
+	candidates := []time.Time{}
+	for _, day := range days {
+		if len(rule.byMonth) != 0 && !containsMonth(rule.byMonth, day.Month()) {
+			continue
+		}
+		if rule.freq == "DAILY" && len(rule.byDay) != 0 && !rule.matchesWeekday(day) {
+			continue
+		}
+		candidates = append(candidates, time.Date(day.Year(), day.Month(), day.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location()))
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	return candidates
+}
+
+// monthDays picks out the days of one month that a MONTHLY or YEARLY rule lands on
+func (rule *recurrenceRule) monthDays(monthStart, dtstart time.Time) []time.Time {
+	days := []time.Time{}
+	lastDay := monthStart.AddDate(0, 1, -1).Day()
+	switch {
+	case len(rule.byMonthDay) != 0:
+		for _, monthDay := range rule.byMonthDay {
+			if monthDay < 0 {
+				monthDay = lastDay + monthDay + 1
+			}
+			if monthDay < 1 || monthDay > lastDay {
+				continue
+			}
+			day := monthStart.AddDate(0, 0, monthDay-1)
+			if len(rule.byDay) == 0 || rule.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+	case len(rule.byDay) != 0:
+		for _, byDay := range rule.byDay {
+			matching := []time.Time{}
+			for monthDay := 1; monthDay <= lastDay; monthDay++ {
+				day := monthStart.AddDate(0, 0, monthDay-1)
+				if day.Weekday() == byDay.day {
+					matching = append(matching, day)
+				}
+			}
+			switch {
+			case byDay.ordinal == 0:
+				days = append(days, matching...)
+			case byDay.ordinal > 0 && byDay.ordinal <= len(matching):
+				days = append(days, matching[byDay.ordinal-1])
+			case byDay.ordinal < 0 && -byDay.ordinal <= len(matching):
+				days = append(days, matching[len(matching)+byDay.ordinal])
+			}
+		}
+	default:
+		if dtstart.Day() <= lastDay {
+			days = append(days, monthStart.AddDate(0, 0, dtstart.Day()-1))
+		}
+	}
+	return days
+}
+
+func (rule *recurrenceRule) matchesWeekday(day time.Time) bool {
+	for _, byDay := range rule.byDay {
+		if byDay.day == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, m := range months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Events on the rotation can be limited to a stretch of dates, for schedules that change every semester or when a
+// project starts or ends. "Active From" and "Active Until" are dates like 01/02/2006, both inclusive, and either can
+// be left off. Events can also belong to a named schedule, like "Fall semester" or "Summer", with a "Schedule" field.
+// Schedules take turns: PERSPECTIVE_SCHEDULES lists when each one starts, e.g.
+//
+//	PERSPECTIVE_SCHEDULES="Fall semester=08/28/2023, Winter break=12/16/2023, Spring semester=01/16/2024"
+//
+// and each one lasts until the next one starts. Events that aren't active right now are listed under Inactive Events
+// until they are again.
+
+// schedule is a named set of events that switches on at a date
+type schedule struct {
+	Name  string
+	Start time.Time
+}
+
+// schedules are the configured schedules, in the order they start
+var schedules = []schedule{}
+
+// configureSchedules reads the schedules from the environment, skipping any that are off
+func configureSchedules(logger log15.Logger) {
+	schedules = []schedule{}
+	value := os.Getenv("PERSPECTIVE_SCHEDULES")
+	for _, entry := range splitList(value) {
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			logger.Error("Schedules look like 'Summer=05/15/2023', skipping", "PERSPECTIVE_SCHEDULES", value, "schedule", entry)
+			continue
+		}
+		start, err := time.ParseInLocation(anchorDateFmt, strings.TrimSpace(parts[1]), homeLocation)
+		if err != nil {
+			logger.Error("Unable to parse schedule start, skipping", "schedule", entry, "err", err.Error())
+			continue
+		}
+		schedules = append(schedules, schedule{Name: strings.TrimSpace(parts[0]), Start: start})
+	}
+	sort.SliceStable(schedules, func(i, j int) bool { return schedules[i].Start.Before(schedules[j].Start) })
+}
+
+// scheduleWindow is when the named schedule is on, from when it starts until the next one does. It comes back
+// without an end for the last schedule.
+func scheduleWindow(name string) (busyPeriod, error) {
+	for index, candidate := range schedules {
+		if !strings.EqualFold(candidate.Name, name) {
+			continue
+		}
+		window := busyPeriod{Start: candidate.Start}
+		if index+1 < len(schedules) {
+			window.End = schedules[index+1].Start
+		}
+		return window, nil
+	}
+	return busyPeriod{}, fmt.Errorf("Schedule '%s' isn't one of the schedules in PERSPECTIVE_SCHEDULES", name)
+}
+
+// isBounded is true for rotation events that are only active for a stretch of dates
+func (e *GeneralEvent) isBounded() bool {
+	return e.ActiveFrom != "" || e.ActiveUntil != "" || e.Schedule != ""
+}
+
+// activeWindow is the stretch of time a rotation event is active for, from its Active From, Active Until and
+// Schedule together. A zero Start or End means it's open on that side. Windows that end before they start are never
+// active.
+func (e *GeneralEvent) activeWindow() (busyPeriod, error) {
+	window := busyPeriod{}
+	if e.ActiveFrom != "" {
+		from, err := time.ParseInLocation(anchorDateFmt, e.ActiveFrom, homeLocation)
+		if err != nil {
+			return window, fmt.Errorf("Unable to parse Active From '%s' of event '%s' as a date like %s", e.ActiveFrom, e.Name, anchorDateFmt)
+		}
+		window.Start = from
+	}
+	if e.ActiveUntil != "" {
+		until, err := time.ParseInLocation(anchorDateFmt, e.ActiveUntil, homeLocation)
+		if err != nil {
+			return window, fmt.Errorf("Unable to parse Active Until '%s' of event '%s' as a date like %s", e.ActiveUntil, e.Name, anchorDateFmt)
+		}
+		window.End = until.AddDate(0, 0, 1) // the whole last day
+	}
+	if e.Schedule != "" {
+		scheduled, err := scheduleWindow(e.Schedule)
+		if err != nil {
+			return window, fmt.Errorf("%s, in event '%s'", err.Error(), e.Name)
+		}
+		if window.Start.IsZero() || scheduled.Start.After(window.Start) {
+			window.Start = scheduled.Start
+		}
+		if window.End.IsZero() || (!scheduled.End.IsZero() && scheduled.End.Before(window.End)) {
+			window.End = scheduled.End
+		}
+	}
+	return window, nil
+}
+
+// followsCalendar is true for rotation events whose busy time depends on the date, because they're only active for
+// some dates or skip some, see getBoundedBlockedSpans
+func (e *GeneralEvent) followsCalendar() bool {
+	return e.isBounded() || e.Except != ""
+}
+
+// isActive is true when an event counts towards busy time at now
+func (e *GeneralEvent) isActive(now time.Time) bool {
+	if e.Inactive {
+		return false
+	}
+	window, err := e.activeWindow()
+	if err != nil {
+		return false
+	}
+	return (window.Start.IsZero() || !now.Before(window.Start)) && (window.End.IsZero() || now.Before(window.End))
+}
+
+// getBoundedBlockedSpans lists the time rotation events that follow the calendar block from the start of from's cycle
+// up to until, in minutes from the prime Sunday on from's clock like getDatedBlockedSpans (see getOccurrenceSpans)
+func getBoundedBlockedSpans(from, until time.Time, genEvents []*GeneralEvent, logger log15.Logger) []span {
+	return getOccurrenceSpans(from, until, genEvents, (*GeneralEvent).followsCalendar, logger)
+}
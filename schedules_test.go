@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// useSchedules switches the schedules for the rest of a test
+func useSchedules(t *testing.T, value string) {
+	previous := schedules
+	t.Setenv("PERSPECTIVE_SCHEDULES", value)
+	configureSchedules(log15.New())
+	t.Cleanup(func() { schedules = previous })
+}
+
+// check that schedules are read in the order they start, skipping the ones that are off
+func TestConfigureSchedules(t *testing.T) {
+	useSchedules(t, "Fall semester=08/28/2023, Summer=05/15/2023, Someday, Winter=12/32/2023")
+	if len(schedules) != 2 || schedules[0].Name != "Summer" || schedules[1].Name != "Fall semester" {
+		t.Errorf("Expected Summer then Fall semester, got %v", schedules)
+		t.FailNow()
+	}
+	summer, err := scheduleWindow("summer")
+	if err != nil || !summer.End.Equal(schedules[1].Start) {
+		t.Errorf("Summer should last until the fall semester starts, got %v (%v)", summer, err)
+	}
+	fall, _ := scheduleWindow("Fall semester")
+	if !fall.End.IsZero() {
+		t.Errorf("The last schedule shouldn't end, got %v", fall)
+	}
+	if _, err := scheduleWindow("Spring semester"); err == nil {
+		t.Errorf("Expected an error for a schedule that isn't configured")
+	}
+}
+
+// check which events are active when, and which section they're listed under
+func TestEventActiveDates(t *testing.T) {
+	useSchedules(t, "Fall semester=08/28/2023, Winter break=12/16/2023")
+	during := time.Date(2023, 10, 2, 12, 0, 0, 0, homeLocation)
+	tests := []struct {
+		name    string
+		event   *GeneralEvent
+		active  bool
+		section string
+		fails   bool
+	}{
+		{
+			name:    "always",
+			event:   &GeneralEvent{Name: "Sleeping"},
+			active:  true,
+			section: repeatingEvents,
+		},
+		{
+			name:    "project that ended",
+			event:   &GeneralEvent{Name: "Project", ActiveFrom: "09/01/2023", ActiveUntil: "09/30/2023"},
+			active:  false,
+			section: inactiveEvents,
+		},
+		{
+			name:    "project that started",
+			event:   &GeneralEvent{Name: "Project", ActiveFrom: "09/01/2023"},
+			active:  true,
+			section: repeatingEvents,
+		},
+		{
+			name:    "class during the semester",
+			event:   &GeneralEvent{Name: "Class", Schedule: "Fall semester"},
+			active:  true,
+			section: inactiveEvents, // the semester is long over by the time the test runs
+		},
+		{
+			name:    "class after it was dropped",
+			event:   &GeneralEvent{Name: "Class", Schedule: "Fall semester", ActiveUntil: "09/15/2023"},
+			active:  false,
+			section: inactiveEvents,
+		},
+		{
+			name:    "break",
+			event:   &GeneralEvent{Name: "Ski Trips", Schedule: "Winter break"},
+			active:  false,
+			section: repeatingEvents, // the last schedule never ends
+		},
+		{
+			name:    "turned off",
+			event:   &GeneralEvent{Name: "Project", ActiveFrom: "09/01/2023", Inactive: true},
+			active:  false,
+			section: inactiveEvents,
+		},
+		{
+			name:  "unknown schedule",
+			event: &GeneralEvent{Name: "Class", Schedule: "Spring semester"},
+			fails: true,
+		},
+		{
+			name:  "bad date",
+			event: &GeneralEvent{Name: "Project", ActiveFrom: "Sept 1"},
+			fails: true,
+		},
+	}
+	for _, test := range tests {
+		test.event.Rotation = "both"
+		test.event.Days = "Mon-Fri"
+		test.event.StartTime = 9
+		test.event.Duration = 2
+		err := test.event.validate()
+		if (err != nil) != test.fails {
+			t.Errorf("Unexpected error state for %s: %v", test.name, err)
+			t.FailNow()
+		}
+		if test.fails {
+			continue
+		}
+		if test.event.isActive(during) != test.active {
+			t.Errorf("Expected %s to be active %t on %s", test.name, test.active, during.Format(anchorDateFmt))
+		}
+		if test.event.section() != test.section {
+			t.Errorf("Expected %s to be under %s, got %s", test.name, test.section, test.event.section())
+		}
+	}
+}
+
+// check that events only take free time while they're active, however far away the deadline is
+func TestActiveDatesFreeTime(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	work := func(from, until string, inactive bool) *GeneralEvent {
+		return &GeneralEvent{Name: "Work", Rotation: "both", Days: "Mon-Fri", StartTime: 9, Duration: 8,
+			ActiveFrom: from, ActiveUntil: until, Inactive: inactive}
+	}
+	tests := []struct {
+		name        string
+		deadline    string
+		event       *GeneralEvent
+		busyMinutes int
+	}{
+		{name: "always", deadline: "16:00 11/28/2022 EST", event: work("", "", false), busyMinutes: 8 * 60},
+		{name: "inactive", deadline: "16:00 11/28/2022 EST", event: work("", "", true), busyMinutes: 0},
+		{name: "ended", deadline: "16:00 11/28/2022 EST", event: work("", "11/27/2022", false), busyMinutes: 0},
+		{name: "starting", deadline: "16:00 11/28/2022 EST", event: work("11/28/2022", "", false), busyMinutes: 8 * 60},
+		{name: "not started", deadline: "16:00 11/28/2022 EST", event: work("11/29/2022", "", false), busyMinutes: 0},
+		// weekdays from 11/28 through 12/09, a couple of cycles before the deadline
+		{name: "two weeks", deadline: "16:00 12/28/2022 EST", event: work("", "12/09/2022", false), busyMinutes: 10 * 8 * 60},
+		// weekdays from 12/19 up to the deadline, in the cycle the deadline falls in
+		{name: "later on", deadline: "16:00 12/28/2022 EST", event: work("12/19/2022", "", false), busyMinutes: 8 * 8 * 60},
+	}
+	for _, test := range tests {
+		report := &Task{Name: "Report", Deadline: test.deadline, EstimatedHours: 1}
+		err := report.calculateUrgency(mid, []*GeneralEvent{test.event}, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error calculating urgency for %s: %s", test.name, err.Error())
+			t.FailNow()
+		}
+		if report.BusyMinutes != test.busyMinutes {
+			t.Errorf("Busy time for %s didn't match;\nExpected: %d\nActual: %d", test.name, test.busyMinutes, report.BusyMinutes)
+			t.FailNow()
+		}
+	}
+}
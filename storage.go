@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// storage is wherever the task list lives between refreshes. The markdown To Do List is the default, but tasks can
+// live in a todo.txt file instead so that other todo.txt tools can share them. Set PERSPECTIVE_STORAGE to pick one.
+type storage interface {
+	// fileNames are the files inside the notes directory whose changes should trigger a refresh
+	fileNames() []string
+	read(logger log15.Logger) ([]*GeneralEvent, []*Task, error)
+	write(events []*GeneralEvent, tasks []*Task, logger log15.Logger)
+}
+
+const (
+	markdownFormat = "markdown"
+	todoTxtFormat  = "todotxt"
+)
+
+func getStorage(logger log15.Logger) storage {
+	dir := notesDir(logger)
+	switch os.Getenv("PERSPECTIVE_STORAGE") {
+	case todoTxtFormat:
+		logger.Info("Keeping tasks in todo.txt", "file", todoTxtFile)
+		return &todoTxtStorage{path: dir + "/" + todoTxtFile}
+	case "", markdownFormat:
+		return &markdownStorage{path: dir + "/" + tasksFile}
+	default:
+		logger.Warn("Unknown storage, falling back to markdown", "storage", os.Getenv("PERSPECTIVE_STORAGE"))
+		return &markdownStorage{path: dir + "/" + tasksFile}
+	}
+}
+
+// storageForPath picks the storage for a file named on the command line, going by its extension
+func storageForPath(path string) storage {
+	switch {
+	case strings.HasSuffix(path, ".txt"):
+		return &todoTxtStorage{path: path}
+	case strings.HasSuffix(path, ".json"):
+		return taskwarriorStorage{path: path}
+	default:
+		return &markdownStorage{path: path}
+	}
+}
+
+type markdownStorage struct {
+	path string
+	// whatever couldn't be understood on the last read, written back into the Background Perspective Stuff section
+	diagnostics diagnostics
+}
+
+func (s *markdownStorage) fileNames() []string {
+	return []string{filepath.Base(s.path)}
+}
+
+func (s *markdownStorage) read(logger log15.Logger) ([]*GeneralEvent, []*Task, error) {
+	events, tasks, diags, err := readMarkdownFile(s.path, logger)
+	s.diagnostics = diags
+	return events, tasks, err
+}
+
+func (s *markdownStorage) write(events []*GeneralEvent, tasks []*Task, logger log15.Logger) {
+	writeToFile(s.path, events, tasks, s.diagnostics, logger)
+}
+
+// todoTxtStorage reads tasks from todo.txt and writes them back ranked by urgency. Events still come from the
+// markdown To Do List, which is left alone.
+type todoTxtStorage struct {
+	path string
+	// lines with no due date can't be ranked, so they're held onto and written back untouched
+	unranked []string
+}
+
+// fileNames includes the To Do List, since that's where the events are
+func (s *todoTxtStorage) fileNames() []string {
+	return []string{filepath.Base(s.path), tasksFile}
+}
+
+func (s *todoTxtStorage) read(logger log15.Logger) ([]*GeneralEvent, []*Task, error) {
+	events, _, _, err := readFromFile(logger)
+	if err != nil {
+		logger.Warn("Unable to read events from the To Do List, carrying on without them", "err", err.Error())
+		events = []*GeneralEvent{}
+	}
+	tasks, unranked := todoTxtToTasks(readLines(s.path, logger), logger)
+	s.unranked = unranked
+	return events, tasks, nil
+}
+
+func (s *todoTxtStorage) write(events []*GeneralEvent, tasks []*Task, logger log15.Logger) {
+	err := os.WriteFile(s.path, []byte(outputTodoTxt(tasks, s.unranked, logger)), 0644)
+	if err != nil {
+		logger.Error("Error writing to todo.txt", "err", err.Error())
+		return
+	}
+	logger.Info("Updated todo.txt file")
+}
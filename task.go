@@ -22,10 +22,44 @@ type Task struct {
 	// This can be changed as progress is made in a task or at any other time your estimate changes
 	// Setting this to zero signals the task is complete
 	EstimatedHours int
+	// EstimatedMinutes is how many minutes the task takes on top of EstimatedHours, for estimates like "1h30m" or "45m"
+	EstimatedMinutes int
+	// Priority, Projects and Contexts are the todo.txt style (A), +project and @context tags. They're carried
+	// along for other tools and don't affect urgency.
+	Priority string
+	Projects []string
+	Contexts []string
+	// UUID identifies the task in other tools, such as Taskwarrior, so changes can be matched up across imports
+	UUID           string
 	Urgency        float32
 	RemainingHours int
 	BusyHours      int
-	Raw            string
+	// FreeMinutes and BusyMinutes are RemainingHours and BusyHours to the minute
+	FreeMinutes int
+	BusyMinutes int
+	// BaseEstimate, Occurrence, Overdue, History and Streak keep track of each occurrence of a repeating task, see
+	// occurrences.go
+	BaseEstimate int
+	Occurrence   time.Time
+	Overdue      time.Time
+	History      []string
+	Streak       int
+	// RepeatAfter is how long after it's done the task comes up again, and Completed is when it was last done
+	RepeatAfter string
+	Completed   time.Time
+	// DeadlineTime is the actual time the Deadline resolves to, i.e. the next instance of a repeating deadline.
+	// It's filled in when the hours left are calculated.
+	DeadlineTime time.Time
+	Raw          string
+	// line and deadlineLine are where the task's name and Deadline are in the To Do List, counting from 1, or 0 if
+	// it didn't come from one
+	line         int
+	deadlineLine int
+	// invalid is why the task couldn't be ranked, if it couldn't, see invalid.go
+	invalid error
+	// taskwarrior is the original object for a task imported from Taskwarrior, kept so that fields we don't
+	// understand make it back out on export
+	taskwarrior map[string]interface{}
 }
 
 func (t *Task) AddRaw(line string) {
@@ -38,6 +72,101 @@ func (t *Task) AddRaw(line string) {
 	t.Raw += "\n" + line
 }
 
+// buildRaw fills in the markdown lines for a Task that didn't come from the To Do List, such as one imported
+// from another format
+func (t *Task) buildRaw() {
+	t.Raw = ""
+	t.AddRaw("\t- " + t.Name)
+	t.AddRaw("\t\t- Deadline; " + t.Deadline)
+	t.AddRaw("\t\t- Estimated Hours; " + formatDuration(t.estimateMinutes()))
+	if t.Priority != "" {
+		t.AddRaw("\t\t- Priority; " + t.Priority)
+	}
+	if len(t.Projects) != 0 {
+		t.AddRaw("\t\t- Projects; " + strings.Join(t.Projects, ", "))
+	}
+	if len(t.Contexts) != 0 {
+		t.AddRaw("\t\t- Contexts; " + strings.Join(t.Contexts, ", "))
+	}
+	if t.UUID != "" {
+		t.AddRaw("\t\t- UUID; " + t.UUID)
+	}
+	if t.RepeatAfter != "" {
+		t.AddRaw("\t\t- Repeat After; " + t.RepeatAfter)
+	}
+	if t.BaseEstimate != 0 {
+		t.AddRaw("\t\t- Base Estimate; " + formatDuration(t.BaseEstimate))
+	}
+	if !t.Occurrence.IsZero() {
+		t.AddRaw("\t\t- Occurrence; " + t.Occurrence.Format(taskDateFmt))
+	}
+	if !t.Overdue.IsZero() {
+		t.AddRaw("\t\t- Overdue; " + t.Overdue.Format(taskDateFmt))
+	}
+	if len(t.History) != 0 {
+		t.AddRaw("\t\t- History; " + strings.Join(t.History, ", "))
+	}
+	if t.Streak != 0 {
+		t.AddRaw("\t\t- Streak; " + strconv.Itoa(t.Streak))
+	}
+}
+
+// setField changes a field in the task's markdown lines, adding the line if the task didn't have one, so that the
+// change is kept the next time the list is written
+func (t *Task) setField(field, value string) {
+	if t.Raw == "" {
+		t.buildRaw()
+	}
+	lines := strings.Split(t.Raw, "\n")
+	nameIndent := ""
+	for index, line := range lines {
+		trimmed := strings.TrimLeft(line, "- \t")
+		if trimmed == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if nameIndent == "" {
+			nameIndent = indent
+			continue
+		}
+		if key, _, isField := splitField(trimmed); isField && taskField(key) == taskField(field) {
+			lines[index] = fmt.Sprintf("%s- %s; %s", indent, field, value)
+			t.Raw = strings.Join(lines, "\n")
+			return
+		}
+	}
+	t.AddRaw(fmt.Sprintf("%s\t- %s; %s", nameIndent, field, value))
+}
+
+// removeField takes a field out of the task's markdown lines, if it's there
+func (t *Task) removeField(field string) {
+	lines := strings.Split(t.Raw, "\n")
+	for index, line := range lines {
+		if key, _, isField := splitField(strings.TrimLeft(line, "- \t")); isField && taskField(key) == taskField(field) {
+			t.Raw = strings.Join(append(lines[:index], lines[index+1:]...), "\n")
+			return
+		}
+	}
+}
+
+// setName renames the task in its markdown lines too
+func (t *Task) setName(name string) {
+	if t.Raw == "" {
+		t.buildRaw()
+	}
+	lines := strings.Split(t.Raw, "\n")
+	for index, line := range lines {
+		if strings.TrimLeft(line, "- \t") == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		lines[index] = fmt.Sprintf("%s- %s", indent, name)
+		break
+	}
+	t.Raw = strings.Join(lines, "\n")
+	t.Name = name
+}
+
 func (t *Task) PrintRaw() string {
 	if t == nil {
 		return ""
@@ -46,12 +175,12 @@ func (t *Task) PrintRaw() string {
 	if out == "" {
 		out += fmt.Sprintf("Name; %s ", t.Name)
 		out += fmt.Sprintf("Deadline; %s ", t.Deadline)
-		out += fmt.Sprintf("Estimated hours; %d ", t.EstimatedHours)
+		out += fmt.Sprintf("Estimated Hours; %s ", formatDuration(t.estimateMinutes()))
 	}
 	// add in generated text: urgency, hours remaining, hours blocked
 	out += fmt.Sprintf(genTextFmt, fmt.Sprintf("Urgency; %.2f%%", t.Urgency*100))
-	out += fmt.Sprintf(genTextFmt, fmt.Sprintf("Free Time Left; %d", t.RemainingHours))
-	out += fmt.Sprintf(genTextFmt, fmt.Sprintf("Blocked Hours; %d", t.BusyHours))
+	out += fmt.Sprintf(genTextFmt, fmt.Sprintf("Free Time Left; %s", formatHours(t.FreeMinutes)))
+	out += fmt.Sprintf(genTextFmt, fmt.Sprintf("Blocked Hours; %s", formatHours(t.BusyMinutes)))
 	return out
 }
 
@@ -60,51 +189,86 @@ func (t *Task) String() string {
 }
 
 func (t *Task) getHoursLeft(now time.Time, blockedHours []int, logger log15.Logger) (int, error) {
-	deadlineHourBlock := 0
+	_, err := t.getTimeLeft(now, spansOfHours(blockedHours), logger)
+	return t.RemainingHours, err
+}
+
+// getTimeLeft is getHoursLeft to the minute, taking the busy time of the rotation as spans of minutes from the start
+// of it (see getNextBlockedSpans). It returns the free minutes left before the deadline.
+func (t *Task) getTimeLeft(now time.Time, blocked []span, logger log15.Logger) (int, error) {
+	window, err := t.deadlineWindow(now, logger)
+	if err != nil {
+		return 0, err
+	}
+	return t.takeRotationTime(window, blocked, logger), nil
+}
+
+// deadlineWindow works out when the deadline is, setting DeadlineTime, and returns the stretch of minutes from the
+// upcoming hour block up to it, counted from the start of this cycle like getNextBlockedSpans.
+func (t *Task) deadlineWindow(now time.Time, logger log15.Logger) (span, error) {
+	deadlinePos := 0
 	interveningFortnites := 0
 	nowHourBlock := nextHourBlock(now, logger)
+	nowPos := nowHourBlock * 60
 	logger = logger.New("NOW", nowHourBlock)
 	logger.Debug("Getting hours left for task")
 	valErr := t.validate()
 	if valErr != nil {
 		logger.Error("Task did not pass validation", "err", valErr.Error())
-		return 0, valErr
+		return span{}, valErr
+	}
+	if _, kindErr := classifyDeadline(t.Deadline); kindErr != nil {
+		kindErr = t.atLine(kindErr)
+		logger.Error("Unable to make sense of deadline", "err", kindErr.Error())
+		return span{}, kindErr
 	}
 	// try to parse Deadline into time
-	deadline, err := time.Parse(taskDateFmt, t.Deadline)
+	deadline, err := parseDeadline(t.Deadline)
 
 	if err == nil { // this is a single dated task
+		t.DeadlineTime = deadline
 		logger = logger.New("task mode", "single")
 		logger.Debug("This is a single dated task", "deadline", deadline)
-		for {
-			earlyDeadline := deadline.Add(-1 * time.Hour * fullTwoWeeks)
-			if getZeroSunday(now).After(earlyDeadline) { // We should be comparing deadline to the beginning of the two week rotation, not the day itself!
-				logger.Debug("We subtracted enough fortnights", "subtracted", interveningFortnites, "newDeadline", deadline)
-				break
-			}
+		// count wall clock minutes on now's clock, whatever zone the deadline was given in, so the clocks changing in
+		// between doesn't move the deadline. Like now, the deadline is counted from the end of its hour block.
+		deadlineAbs := wallMinutes(deadline.In(now.Location())) - primeWallHours()*60 + 60
+		zeroPos := (absoluteHourBlock(now) - nowHourBlock) * 60
+		for deadlineAbs-cycleMinutes() >= zeroPos { // We should be comparing deadline to the beginning of the rotation, not the day itself!
+			deadlineAbs -= cycleMinutes()
 			interveningFortnites++
-			deadline = earlyDeadline
 		}
 		if interveningFortnites == 0 {
-			for {
-				// there is a chance that the deadline is actually really far back in the past so we need to do the opposite operation to pin it down
-				laterDeadline := deadline.Add(time.Hour * fullTwoWeeks)
-				if getZeroSunday(now).Before(laterDeadline) {
-					logger.Debug("We added enough fortnites", "added", interveningFortnites, "newDeadline", deadline)
-					break
-				}
+			// there is a chance that the deadline is actually really far back in the past so we need to do the opposite operation to pin it down
+			for deadlineAbs+cycleMinutes() <= zeroPos {
+				deadlineAbs += cycleMinutes()
 				interveningFortnites--
-				deadline = laterDeadline
 			}
 		}
-		deadlineHourBlock = nextHourBlock(deadline, logger)
+		logger.Debug("Moved the deadline into this rotation", "fortnights", interveningFortnites)
+		deadlinePos = modCycleMinutes(deadlineAbs)
+	} else if isRuleDeadline(t.Deadline) { // this repeats on the calendar, see deadlineRules.go
+		logger = logger.New("task mode", "rule")
+		rule, ruleErr := parseDeadlineRule(t.Deadline, now.Location())
+		if ruleErr != nil {
+			logger.Error("Malformed repeating deadline", "err", ruleErr.Error())
+			return span{}, ruleErr
+		}
+		from := fromWallMinutes(upcomingWallHour(now)*60, now.Location())
+		next, ok := rule.next(from)
+		if !ok {
+			return span{}, fmt.Errorf("Deadline '%s' of task '%s' doesn't come up again", t.Deadline, t.Name)
+		}
+		logger.Debug("Found the next deadline", "deadline", next)
+		t.DeadlineTime = next
+		deadlinePos = nowPos + wallMinutes(next) - upcomingWallHour(now)*60
 	} else { // this is a repeating task, (or actual error) we need to find the next instance of this deadline
 		logger = logger.New("task mode", "repeating")
 		logger.Debug("This is a repeating task", "repeatingDays", t.Deadline)
 		deadlineHour, weekRotation, days, repeatingDaysErr := t.parseRepeatingDays(logger)
 		if repeatingDaysErr != nil {
-			return 0, repeatingDaysErr
+			return span{}, repeatingDaysErr
 		}
+		_, deadlineMinute, _ := parseClock(strings.Fields(t.Deadline)[0])
 		hours := generateBlockedHours(days, weekRotation, deadlineHour, 1)
 		wrap := 0
 		for index := 0; ; index++ {
@@ -113,60 +277,81 @@ func (t *Task) getHoursLeft(now time.Time, blockedHours []int, logger log15.Logg
 				wrap = 1
 				logger.Debug("wrapping")
 			}
-			hour := hours[index] + (wrap * fullTwoWeeks)
-			logger.Debug(fmt.Sprintf("we're comparing hour %d to nowHourBlock %d\n", hour, nowHourBlock))
-			if hour > nowHourBlock {
-				deadlineHourBlock = hour
+			pos := (hours[index]+(wrap*cycleHours()))*60 + deadlineMinute
+			logger.Debug(fmt.Sprintf("we're comparing minute %d to nowPos %d\n", pos, nowPos))
+			if pos > nowPos {
+				deadlinePos = pos
 				break
 			}
 		}
+		t.DeadlineTime = fromWallMinutes(upcomingWallHour(now)*60+deadlinePos-nowPos, now.Location())
 	}
-	// now we have a deadline hour block but it's normalized to this rotation; let's un-normalize it
-	logger.Debug("Deadline hour calculated", "normalizedDeadline", deadlineHourBlock)
-	deadlineHourBlock += interveningFortnites * fullTwoWeeks
+	// now we have a deadline but it's normalized to this rotation; let's un-normalize it
+	logger.Debug("Deadline calculated", "normalizedDeadline", deadlinePos)
+	deadlinePos += interveningFortnites * cycleMinutes()
 
-	remainingFreeHours := deadlineHourBlock - nowHourBlock
+	return span{nowPos, deadlinePos}, nil
+}
 
-	wraps := 0
-	logger.Debug("Ticking off remaining free hours", "freeHours", remainingFreeHours)
-	for index := 0; ; index++ {
-		// loopLogger := logger.New("freeHours", remainingFreeHours)
-		if index == len(blockedHours) {
-			if index == 0 {
-				break
-			}
-			index = 0
-			wraps += 1
-		}
-		eventHourBlock := blockedHours[index] + (wraps * fullTwoWeeks)
-		if eventHourBlock < nowHourBlock {
-			continue
-		}
-		if eventHourBlock >= deadlineHourBlock {
-			break
-		}
-		remainingFreeHours += -1
-		t.BusyHours += 1
-		// loopLogger.Debug(fmt.Sprintf("Hour %d (%d) is blocked, remainingFreeHours is %d \n", blockedHours[index], eventHourBlock, remainingFreeHours))
-	}
-	t.RemainingHours = remainingFreeHours
-	return remainingFreeHours, nil
+// takeRotationTime counts the free minutes in window by repeating the rotation's busy time (blocked, see
+// getNextBlockedSpans) every cycle up to the deadline
+func (t *Task) takeRotationTime(window span, blocked []span, logger log15.Logger) int {
+	remainingFreeMinutes := window.end - window.start
+	logger.Debug("Ticking off remaining free minutes", "freeMinutes", remainingFreeMinutes)
+	// events that overlap only take the time they share once
+	busyMinutes := totalMinutes(repeatSpans(blocked, window))
+	remainingFreeMinutes -= busyMinutes
+	t.BusyMinutes = busyMinutes
+	t.FreeMinutes = remainingFreeMinutes
+	t.syncHours()
+	return remainingFreeMinutes
 }
 
+// syncHours keeps the whole-hour counts in step with the minutes
+func (t *Task) syncHours() {
+	t.RemainingHours = t.FreeMinutes / 60
+	t.BusyHours = t.BusyMinutes / 60
+}
+
+// calculateUrgency works out the free time left before the deadline and how much of it the estimate needs. Repeating
+// the rotation is enough most of the time; when something date-specific happens before the deadline the busy time is
+// laid out on the calendar instead (see projectTimeline).
 func (t *Task) calculateUrgency(now time.Time, genEvents []*GeneralEvent, logger log15.Logger) error {
-	blockedHours, err := getNextBlockedHours(now, genEvents, logger)
+	blocked, err := getNextBlockedSpans(now, genEvents, logger)
 	if err != nil {
 		return err
 	}
-	hoursLeft, err := t.getHoursLeft(now, blockedHours, logger)
+	window, err := t.deadlineWindow(now, logger)
 	if err != nil {
 		return err
 	}
-	t.Urgency = float32(t.EstimatedHours) / float32(hoursLeft)
+	minutesLeft := 0
+	if needsTimeline(now, t.DeadlineTime, genEvents, logger) {
+		minutesLeft = t.projectTimeline(now, window, genEvents, logger)
+	} else {
+		minutesLeft = t.takeRotationTime(window, blocked, logger)
+	}
+	t.Urgency = float32(t.estimateMinutes()) / float32(minutesLeft)
 	logger.Debug("Calculated urgency", "urgency", t.Urgency)
 	return nil
 }
 
+// estimateMinutes is the whole estimate in minutes
+func (t *Task) estimateMinutes() int {
+	return t.EstimatedHours*60 + t.EstimatedMinutes
+}
+
+// setEstimate sets the estimate from a number of minutes
+func (t *Task) setEstimate(minutes int) {
+	t.EstimatedHours = minutes / 60
+	t.EstimatedMinutes = minutes % 60
+}
+
+// isComplete is true once there's no time left in the estimate
+func (t *Task) isComplete() bool {
+	return t.estimateMinutes() == 0
+}
+
 func (t *Task) parseRepeatingDays(logger log15.Logger) (hour int, weekRotation rotation, days []time.Weekday, err error) {
 	logger.Debug("Parsing deadline for repeating task", "deadline", t.Deadline)
 	tokens := strings.Split(strings.ToLower(t.Deadline), " ")
@@ -176,14 +361,26 @@ func (t *Task) parseRepeatingDays(logger log15.Logger) (hour int, weekRotation r
 		logger.Error("Problem converting hour portion of repeating deadline", "err", err.Error())
 		return
 	}
-	weekRotation = rotation(tokens[1])
-	if weekRotation != firstWeek && weekRotation != secondWeek && weekRotation != bothWeeks {
+	if len(tokens) < 3 {
 		err = fmt.Errorf("Malformed Deadline! '%s' is not a repeating date.", t.Deadline)
 		logger.Error("Malformed deadline. This is not a repeating deadline. Perhaps missing time zone or rotation")
 		return
 	}
+	// the rotation is one word, or "week"/"weeks" followed by the week numbers
+	daysFrom := 2
+	if tokens[1] == "week" || tokens[1] == "weeks" {
+		for daysFrom < len(tokens) && weekListMatcher.MatchString(tokens[daysFrom]) {
+			daysFrom++
+		}
+	}
+	weekRotation = rotation(strings.Join(tokens[1:daysFrom], " "))
+	if _, rotationErr := weekRotation.weeks(); rotationErr != nil {
+		err = fmt.Errorf("Malformed Deadline! '%s' is not a repeating date. %s", t.Deadline, rotationErr.Error())
+		logger.Error("Malformed deadline. This is not a repeating deadline. Perhaps missing time zone or rotation")
+		return
+	}
 	//everything else is days
-	daysStr := strings.Join(tokens[2:], " ")
+	daysStr := strings.Join(tokens[daysFrom:], " ")
 	days, err = parseDayStrings(daysStr)
 	if err != nil {
 		logger.Error("Problem converting days portion of repeating deadline", "err", err.Error())
@@ -201,17 +398,19 @@ func (t *Task) validate() error {
 	return nil
 }
 
-func sortTasks(tasks []*Task, now time.Time, genEvents []*GeneralEvent, topLogger log15.Logger) error {
+// sortTasks ranks tasks by urgency. Tasks and events with mistakes in them don't hold up the rest, they're marked
+// invalid and left out of the ranking instead (see invalid.go).
+func sortTasks(tasks []*Task, now time.Time, genEvents []*GeneralEvent, topLogger log15.Logger) {
 	topLogger.Debug("Sorting Tasks")
+	genEvents = rankableEvents(genEvents, topLogger)
 	for _, task := range tasks {
 		logger := topLogger.New("task", task)
-		err := task.calculateUrgency(now, genEvents, logger)
-		if err != nil {
-			return err
+		task.invalid = task.calculateUrgency(now, genEvents, logger)
+		if task.invalid != nil {
+			logger.Warn("Unable to rank task, moving it to "+invalidItems, "err", task.invalid.Error())
 		}
 	}
 	sort.Sort(byUrgency(tasks))
-	return nil
 }
 
 type byUrgency []*Task
@@ -223,22 +422,38 @@ func (t byUrgency) Swap(i, j int) {
 	t[i], t[j] = t[j], t[i]
 }
 func (t byUrgency) Less(i, j int) bool {
+	if (t[i].invalid == nil) != (t[j].invalid == nil) {
+		return t[i].invalid == nil
+	}
 	return t[i].Urgency > t[j].Urgency
 }
 
+// section is the To Do List header a ranked task belongs under
+func (t *Task) section() string {
+	switch {
+	case t.invalid != nil:
+		return invalidItems
+	case t.Urgency > 0:
+		return upcomingTasks
+	case t.Urgency < 0:
+		return overdueTasks
+	default:
+		return completedTasks
+	}
+}
+
 func outputTasks(taskList []*Task) string {
 	outStr := ""
 	upcoming := []*Task{}
 	finished := []*Task{}
 	deadlinePassed := []*Task{}
 	for _, task := range taskList {
-		if task.Urgency > 0 {
+		switch task.section() {
+		case upcomingTasks:
 			upcoming = append(upcoming, task)
-		}
-		if task.Urgency == 0 {
+		case completedTasks:
 			finished = append(finished, task)
-		}
-		if task.Urgency < 0 {
+		case overdueTasks:
 			deadlinePassed = append(deadlinePassed, task)
 		}
 	}
@@ -194,11 +194,7 @@ func TestTaskUrgency(t *testing.T) {
 	report1, report2, syllabus := createThreeTasks()
 	taskList := []*Task{bookClub, report1, report2, syllabus}
 	mid := generateTestingTimes()["mid"]
-	err := sortTasks(taskList, mid, []*GeneralEvent{}, tLogger)
-	if err != nil {
-		t.Errorf("right now none of these tests expect an error so this is a fail, but in the future we should add some error testing too")
-		t.FailNow()
-	}
+	sortTasks(taskList, mid, []*GeneralEvent{}, tLogger)
 	if bookClub.Urgency != 2.4 {
 		t.Errorf("Expected urgency of %f, got %f\n", 2.4, bookClub.Urgency)
 	}
@@ -212,11 +208,7 @@ func TestTaskUrgency(t *testing.T) {
 	}
 
 	late := generateTestingTimes()["late"]
-	err = sortTasks(taskList, late, []*GeneralEvent{}, tLogger)
-	if err != nil {
-		t.Errorf("right now none of these tests expect an error so this is a fail, but in the future we should add some error testing too")
-		t.FailNow()
-	}
+	sortTasks(taskList, late, []*GeneralEvent{}, tLogger)
 	if bookClub.Urgency >= 0 {
 		t.Errorf("Expected urgency of less than zero, got %f\n", bookClub.Urgency)
 	}
@@ -231,6 +223,31 @@ func TestTaskUrgency(t *testing.T) {
 	}
 }
 
+// check that ranking the same tasks again, like after a CalDAV sync, doesn't count the busy time twice
+func TestSortTasksTwice(t *testing.T) {
+	tLogger := log15.New()
+	report1, report2, syllabus := createThreeTasks()
+	taskList := []*Task{report1, report2, syllabus}
+	events := []*GeneralEvent{
+		{Name: "sleeping", Rotation: bothWeeks, Days: "Sun-Sat", StartTime: 23, Duration: 8},
+		// a dated event before the second report's deadline lays that one out on the timeline instead
+		{Name: "Dentist", Date: "12/05/2022", StartTime: 9, Duration: 1},
+	}
+	mid := generateTestingTimes()["mid"]
+	sortTasks(taskList, mid, events, tLogger)
+	busy, free := map[string]int{}, map[string]int{}
+	for _, task := range taskList {
+		busy[task.Name], free[task.Name] = task.BusyMinutes, task.FreeMinutes
+	}
+	sortTasks(taskList, mid, events, tLogger)
+	for _, task := range taskList {
+		if task.BusyMinutes != busy[task.Name] || task.FreeMinutes != free[task.Name] {
+			t.Errorf("Ranking '%s' again changed its time;\nExpected: %d busy, %d free\nActual: %d busy, %d free",
+				task.Name, busy[task.Name], free[task.Name], task.BusyMinutes, task.FreeMinutes)
+		}
+	}
+}
+
 func createThreeTasks() (*Task, *Task, *Task) {
 	earlySyllabus := &Task{
 		Name:           "Read the syllabus and get it signed",
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Taskwarrior (https://taskwarrior.org) reads and writes a JSON array of task objects with `task export` and
+// `task import`. We map the fields we care about onto Task and keep the rest of each object as-is, so a round trip
+// through Perspective doesn't lose anything. Estimates come from an `estimate` UDA and our urgency goes back out in
+// a `perspectiveurgency` UDA, next to Taskwarrior's own urgency. Repeating tasks keep track of their occurrences (see
+// occurrences.go) in more UDAs:
+//
+//	uda.estimate.type=duration
+//	uda.perspectiveurgency.type=numeric
+//	uda.perspectivebase.type=duration
+//	uda.perspectiveoccurrence.type=date
+//	uda.perspectiveoverdue.type=date
+//	uda.perspectivehistory.type=string
+//	uda.perspectivestreak.type=numeric
+//	uda.perspectiverepeat.type=string
+//	uda.perspectivecompleted.type=date
+const (
+	taskwarriorFormat = "taskwarrior"
+
+	taskwarriorDateFmt    = "20060102T150405Z"
+	taskwarriorUrgencyUDA = "perspectiveurgency"
+
+	taskwarriorBaseUDA       = "perspectivebase"
+	taskwarriorOccurrenceUDA = "perspectiveoccurrence"
+	taskwarriorOverdueUDA    = "perspectiveoverdue"
+	taskwarriorHistoryUDA    = "perspectivehistory"
+	taskwarriorStreakUDA     = "perspectivestreak"
+	taskwarriorRepeatUDA     = "perspectiverepeat"
+	taskwarriorCompletedUDA  = "perspectivecompleted"
+)
+
+var isoDurationMatcher = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// taskwarriorToTask turns one exported Taskwarrior object into a Task. Deleted tasks come back nil.
+func taskwarriorToTask(object map[string]interface{}, logger log15.Logger) (*Task, error) {
+	status := taskwarriorString(object, "status")
+	if status == "deleted" {
+		return nil, nil
+	}
+	task := &Task{
+		Name:           taskwarriorString(object, "description"),
+		UUID:           taskwarriorString(object, "uuid"),
+		EstimatedHours: defaultTodoTxtEstimate,
+		Projects:       []string{},
+		Contexts:       []string{},
+		taskwarrior:    object,
+	}
+	if task.Name == "" {
+		return nil, fmt.Errorf("Taskwarrior task '%s' has no description", task.UUID)
+	}
+	due := taskwarriorString(object, "due")
+	if due == "" {
+		return nil, fmt.Errorf("Taskwarrior task '%s' has no due date", task.Name)
+	}
+	dueTime, err := time.Parse(taskwarriorDateFmt, due)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse due date '%s' of Taskwarrior task '%s'", due, task.Name)
+	}
+	dueTime = dueTime.In(homeLocation)
+	task.Deadline = dueTime.Format(taskDateFmt)
+	if recur := taskwarriorString(object, "recur"); recur != "" {
+		deadline, err := taskwarriorRecurToDeadline(recur, dueTime, logger)
+		if err != nil {
+			logger.Warn("Can't repeat Taskwarrior recurrence here, using the next due date", "task", task.Name, "err", err.Error())
+		} else {
+			task.Deadline = deadline
+		}
+	}
+	if estimate, ok := object["estimate"]; ok {
+		minutes, err := parseTaskwarriorEstimate(estimate)
+		if err != nil {
+			return nil, fmt.Errorf("Taskwarrior task '%s': %s", task.Name, err.Error())
+		}
+		task.setEstimate(minutes)
+	}
+	if status == "completed" {
+		task.setEstimate(0)
+	}
+	if err := readTaskwarriorTracking(task, object); err != nil {
+		return nil, fmt.Errorf("Taskwarrior task '%s': %s", task.Name, err.Error())
+	}
+	if project := taskwarriorString(object, "project"); project != "" {
+		task.Projects = append(task.Projects, project)
+	}
+	if tags, ok := object["tags"].([]interface{}); ok {
+		for _, tag := range tags {
+			if tagStr, ok := tag.(string); ok {
+				task.Contexts = append(task.Contexts, tagStr)
+			}
+		}
+	}
+	switch taskwarriorString(object, "priority") {
+	case "H":
+		task.Priority = "A"
+	case "M":
+		task.Priority = "B"
+	case "L":
+		task.Priority = "C"
+	}
+	return task, nil
+}
+
+// readTaskwarriorTracking reads the UDAs a repeating task keeps its occurrences in
+func readTaskwarriorTracking(task *Task, object map[string]interface{}) error {
+	if base, ok := object[taskwarriorBaseUDA]; ok {
+		minutes, err := parseTaskwarriorEstimate(base)
+		if err != nil {
+			return err
+		}
+		task.BaseEstimate = minutes
+	}
+	occurrences := map[string]*time.Time{
+		taskwarriorOccurrenceUDA: &task.Occurrence,
+		taskwarriorOverdueUDA:    &task.Overdue,
+		taskwarriorCompletedUDA:  &task.Completed,
+	}
+	for key, occurrence := range occurrences {
+		value := taskwarriorString(object, key)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(taskwarriorDateFmt, value)
+		if err != nil {
+			return fmt.Errorf("Unable to parse %s '%s'", key, value)
+		}
+		*occurrence = parsed.In(homeLocation)
+	}
+	task.RepeatAfter = taskwarriorString(object, taskwarriorRepeatUDA)
+	if history := taskwarriorString(object, taskwarriorHistoryUDA); history != "" {
+		task.History = splitList(history)
+	}
+	if streak, ok := object[taskwarriorStreakUDA].(float64); ok {
+		task.Streak = int(streak)
+	}
+	return nil
+}
+
+// setTaskwarriorTracking writes the occurrences of a repeating task into its UDAs, taking out the ones it doesn't
+// have any more
+func setTaskwarriorTracking(task *Task, object map[string]interface{}) {
+	setUDA := func(key string, value interface{}, set bool) {
+		if set {
+			object[key] = value
+		} else {
+			delete(object, key)
+		}
+	}
+	setUDA(taskwarriorBaseUDA, isoEstimate(task.BaseEstimate), task.BaseEstimate != 0)
+	setUDA(taskwarriorOccurrenceUDA, task.Occurrence.UTC().Format(taskwarriorDateFmt), !task.Occurrence.IsZero())
+	setUDA(taskwarriorOverdueUDA, task.Overdue.UTC().Format(taskwarriorDateFmt), !task.Overdue.IsZero())
+	setUDA(taskwarriorCompletedUDA, task.Completed.UTC().Format(taskwarriorDateFmt), !task.Completed.IsZero())
+	setUDA(taskwarriorRepeatUDA, task.RepeatAfter, task.RepeatAfter != "")
+	setUDA(taskwarriorHistoryUDA, strings.Join(task.History, ", "), len(task.History) != 0)
+	setUDA(taskwarriorStreakUDA, task.Streak, task.Streak != 0)
+}
+
+func taskwarriorString(object map[string]interface{}, key string) string {
+	value, _ := object[key].(string)
+	return value
+}
+
+// taskwarriorRecurToDeadline turns the recurrences that fit our rotation into a repeating deadline, taking the hour
+// and weekday from the due date
+func taskwarriorRecurToDeadline(recur string, due time.Time, logger log15.Logger) (string, error) {
+	hour := due.Format("15:04")
+	switch recur {
+	case "daily", "day", "1d":
+		return fmt.Sprintf("%s %s Sun-Sat", hour, everyWeek()), nil
+	case "weekdays":
+		return fmt.Sprintf("%s %s Mon-Fri", hour, everyWeek()), nil
+	case "weekly", "week", "1w", "7d":
+		return fmt.Sprintf("%s %s %s", hour, everyWeek(), due.Weekday()), nil
+	case "biweekly", "fortnight", "2w", "2weeks", "14d":
+		if cycle.Weeks%2 != 0 {
+			return "", fmt.Errorf("Recurrence '%s' doesn't fit a %d week rotation", recur, cycle.Weeks)
+		}
+		dueWeek := nextHourBlock(due, logger) / weekHours
+		if cycle.Weeks == 2 {
+			return fmt.Sprintf("%s %s %s", hour, weekRotation(dueWeek), due.Weekday()), nil
+		}
+		weeks := []string{}
+		for week := dueWeek % 2; week < cycle.Weeks; week += 2 {
+			weeks = append(weeks, strconv.Itoa(week+1))
+		}
+		return fmt.Sprintf("%s weeks %s %s", hour, strings.Join(weeks, ","), due.Weekday()), nil
+	default:
+		return "", fmt.Errorf("Recurrence '%s' doesn't fit a %d week rotation", recur, cycle.Weeks)
+	}
+}
+
+// parseTaskwarriorEstimate accepts a number of hours or a duration such as PT3H or 90min, rounded up to whole minutes
+func parseTaskwarriorEstimate(estimate interface{}) (int, error) {
+	switch value := estimate.(type) {
+	case float64:
+		return int(math.Ceil(value * 60)), nil
+	case string:
+		if hours, err := strconv.ParseFloat(value, 64); err == nil {
+			return int(math.Ceil(hours * 60)), nil
+		}
+		if duration, err := parseISODuration(value); err == nil {
+			return int(math.Ceil(duration.Minutes())), nil
+		}
+		if duration, err := time.ParseDuration(strings.TrimSuffix(value, "in")); err == nil {
+			return int(math.Ceil(duration.Minutes())), nil
+		}
+	}
+	return 0, fmt.Errorf("Unable to parse estimate '%v' as hours or a duration", estimate)
+}
+
+// isoEstimate writes an estimate as an ISO 8601 duration like PT3H or PT1H30M
+func isoEstimate(minutes int) string {
+	switch {
+	case minutes%60 == 0:
+		return fmt.Sprintf("PT%dH", minutes/60)
+	case minutes < 60:
+		return fmt.Sprintf("PT%dM", minutes)
+	default:
+		return fmt.Sprintf("PT%dH%dM", minutes/60, minutes%60)
+	}
+}
+
+// taskwarriorToTasks reads the output of `task export`
+func taskwarriorToTasks(data []byte, topLogger log15.Logger) ([]*Task, error) {
+	topLogger = topLogger.New("function", "taskwarriorToTasks")
+	objects := []map[string]interface{}{}
+	err := json.Unmarshal(data, &objects)
+	if err != nil {
+		return []*Task{}, fmt.Errorf("Unable to read Taskwarrior export: %s", err.Error())
+	}
+	// Recurring tasks show up as a parent plus a pending child for each instance. A parent whose recurrence fits our
+	// rotation becomes a repeating deadline and stands in for its children; otherwise only the next child is kept.
+	repeatingParents := map[string]bool{}
+	nextChildren := map[string]string{}
+	for _, object := range objects {
+		if taskwarriorString(object, "status") == "recurring" {
+			due, err := time.Parse(taskwarriorDateFmt, taskwarriorString(object, "due"))
+			if err != nil {
+				continue
+			}
+			_, err = taskwarriorRecurToDeadline(taskwarriorString(object, "recur"), due.In(homeLocation), topLogger)
+			repeatingParents[taskwarriorString(object, "uuid")] = err == nil
+		}
+		parent := taskwarriorString(object, "parent")
+		if parent != "" && taskwarriorString(object, "status") == "pending" {
+			due := taskwarriorString(object, "due")
+			if next, ok := nextChildren[parent]; !ok || due < next {
+				nextChildren[parent] = due
+			}
+		}
+	}
+	tasks := []*Task{}
+	for index, object := range objects {
+		loopLogger := topLogger.New("index", index)
+		if taskwarriorString(object, "status") == "recurring" && !repeatingParents[taskwarriorString(object, "uuid")] {
+			continue
+		}
+		if parent := taskwarriorString(object, "parent"); parent != "" {
+			if repeatingParents[parent] || nextChildren[parent] != taskwarriorString(object, "due") {
+				continue
+			}
+			// the instance carries the recurrence too, but it only stands for itself
+			delete(object, "recur")
+		}
+		task, err := taskwarriorToTask(object, loopLogger)
+		if err != nil {
+			loopLogger.Warn("Skipping Taskwarrior task", "err", err.Error())
+			continue
+		}
+		if task == nil {
+			continue
+		}
+		task.buildRaw()
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// taskToTaskwarrior builds the object `task import` expects, starting from the original one if there was one.
+// Repeating deadlines go out as their next due date.
+func taskToTaskwarrior(task *Task) map[string]interface{} {
+	object := map[string]interface{}{}
+	for key, value := range task.taskwarrior {
+		object[key] = value
+	}
+	object["description"] = task.Name
+	if task.UUID != "" {
+		object["uuid"] = task.UUID
+	}
+	recurring := taskwarriorString(object, "status") == "recurring"
+	switch {
+	case recurring:
+		// completing a parent would end the whole recurrence, so only the occurrence is done, which the estimate and
+		// the occurrence UDAs keep track of
+		object["estimate"] = isoEstimate(task.estimateMinutes())
+	case task.isComplete():
+		object["status"] = "completed"
+		if _, ok := object["end"]; !ok {
+			object["end"] = time.Now().UTC().Format(taskwarriorDateFmt)
+		}
+	default:
+		object["status"] = "pending"
+		object["estimate"] = isoEstimate(task.estimateMinutes())
+	}
+	// a recurring parent's due date anchors all of its instances, so leave it be
+	if !task.DeadlineTime.IsZero() && !recurring {
+		object["due"] = task.DeadlineTime.UTC().Format(taskwarriorDateFmt)
+	}
+	if len(task.Projects) != 0 {
+		object["project"] = task.Projects[0]
+	}
+	if len(task.Contexts) != 0 {
+		object["tags"] = task.Contexts
+	}
+	switch task.Priority {
+	case "A":
+		object["priority"] = "H"
+	case "B":
+		object["priority"] = "M"
+	case "C":
+		object["priority"] = "L"
+	}
+	setTaskwarriorTracking(task, object)
+	object[taskwarriorUrgencyUDA] = math.Round(float64(task.Urgency)*10000) / 100
+	return object
+}
+
+// outputTaskwarrior writes ranked tasks in the order they were sorted, ready for `task import`
+func outputTaskwarrior(tasks []*Task) (string, error) {
+	objects := []map[string]interface{}{}
+	for _, task := range tasks {
+		objects = append(objects, taskToTaskwarrior(task))
+	}
+	data, err := json.MarshalIndent(objects, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// taskwarriorStorage reads a `task export` file; like todo.txt, events still come from the markdown To Do List
+type taskwarriorStorage struct {
+	path string
+}
+
+func (s taskwarriorStorage) fileNames() []string {
+	return []string{filepath.Base(s.path), tasksFile}
+}
+
+func (s taskwarriorStorage) read(logger log15.Logger) ([]*GeneralEvent, []*Task, error) {
+	events, _, _, err := readFromFile(logger)
+	if err != nil {
+		logger.Warn("Unable to read events from the To Do List, carrying on without them", "err", err.Error())
+		events = []*GeneralEvent{}
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return events, []*Task{}, err
+	}
+	tasks, err := taskwarriorToTasks(data, logger)
+	return events, tasks, err
+}
+
+func (s taskwarriorStorage) write(events []*GeneralEvent, tasks []*Task, logger log15.Logger) {
+	outStr, err := outputTaskwarrior(tasks)
+	if err == nil {
+		err = os.WriteFile(s.path, []byte(outStr), 0644)
+	}
+	if err != nil {
+		logger.Error("Error writing Taskwarrior export", "err", err.Error())
+		return
+	}
+	logger.Info("Updated Taskwarrior export", "file", s.path)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+const testTaskwarriorExport = `[
+{"id":1,"description":"Finish first book report","due":"20221128T160000Z","estimate":"PT3H","status":"pending","uuid":"a1","urgency":8.2,"project":"school","annotations":[{"entry":"20221101T000000Z","description":"chapter 3"}]},
+{"id":0,"description":"Read the syllabus","due":"20220928T160000Z","estimate":1,"status":"completed","uuid":"b2"},
+{"id":0,"description":"Old idea","due":"20220928T160000Z","status":"deleted","uuid":"c3"},
+{"id":0,"description":"Read For Book Club","due":"20221122T180000Z","recur":"weekly","estimate":"90min","status":"recurring","uuid":"d4"},
+{"id":2,"description":"Read For Book Club","due":"20221129T180000Z","recur":"weekly","status":"pending","parent":"d4","uuid":"d5"},
+{"id":0,"description":"Pay rent","due":"20221101T120000Z","recur":"monthly","status":"recurring","uuid":"e6"},
+{"id":3,"description":"Pay rent","due":"20221201T120000Z","recur":"monthly","status":"pending","parent":"e6","uuid":"e7"},
+{"id":4,"description":"Pay rent","due":"20230101T120000Z","recur":"monthly","status":"pending","parent":"e6","uuid":"e8"}
+]`
+
+// check that Taskwarrior's due, estimate, status and recur end up in Deadline and the estimate
+func TestTaskwarriorToTasks(t *testing.T) {
+	tLogger := log15.New()
+	tasks, err := taskwarriorToTasks([]byte(testTaskwarriorExport), tLogger)
+	if err != nil {
+		t.Errorf("Unexpected error reading export: %s", err.Error())
+		t.FailNow()
+	}
+	expected := []struct {
+		uuid             string
+		due              time.Time
+		deadline         string // for repeating deadlines, which aren't a time
+		estimatedMinutes int
+	}{
+		{uuid: "a1", due: time.Date(2022, 11, 28, 16, 0, 0, 0, time.UTC), estimatedMinutes: 180},
+		{uuid: "b2", due: time.Date(2022, 9, 28, 16, 0, 0, 0, time.UTC), estimatedMinutes: 0},
+		{uuid: "d4", deadline: "18:00 both Tuesday", estimatedMinutes: 90},
+		{uuid: "e7", due: time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC), estimatedMinutes: defaultTodoTxtEstimate * 60},
+	}
+	if len(tasks) != len(expected) {
+		t.Errorf("Expected %d tasks, got %d", len(expected), len(tasks))
+		t.FailNow()
+	}
+	for index, test := range expected {
+		task := tasks[index]
+		deadlineMatches := task.Deadline == test.deadline
+		if test.deadline == "" {
+			due, err := parseDeadline(task.Deadline)
+			deadlineMatches = err == nil && due.Equal(test.due)
+		}
+		if task.UUID != test.uuid || !deadlineMatches || task.estimateMinutes() != test.estimatedMinutes {
+			t.Errorf("Task %d didn't match;\nActual: %s %s %d\nExpected: %s %s%s %d", index, task.UUID, task.Deadline, task.estimateMinutes(), test.uuid, test.due, test.deadline, test.estimatedMinutes)
+		}
+	}
+}
+
+// check that exported tasks carry our urgency and keep the fields we don't use
+func TestTaskwarriorRoundTrip(t *testing.T) {
+	tLogger := log15.New()
+	tasks, _ := taskwarriorToTasks([]byte(testTaskwarriorExport), tLogger)
+	sortTasks(tasks, generateTestingTimes()["mid"], []*GeneralEvent{}, tLogger)
+	outStr, err := outputTaskwarrior(tasks)
+	if err != nil {
+		t.Errorf("Unexpected error writing export: %s", err.Error())
+		t.FailNow()
+	}
+	objects := []map[string]interface{}{}
+	err = json.Unmarshal([]byte(outStr), &objects)
+	if err != nil {
+		t.Errorf("Export wasn't valid JSON: %s", err.Error())
+		t.FailNow()
+	}
+	for _, object := range objects {
+		if object["uuid"] != "a1" {
+			continue
+		}
+		if object[taskwarriorUrgencyUDA] != 7.14 {
+			t.Errorf("Expected %s of 7.14, got %v", taskwarriorUrgencyUDA, object[taskwarriorUrgencyUDA])
+		}
+		if object["urgency"] != 8.2 || object["annotations"] == nil {
+			t.Errorf("Taskwarrior's own fields didn't survive the round trip: %v", object)
+		}
+		if object["due"] != "20221128T160000Z" || object["estimate"] != "PT3H" || object["status"] != "pending" {
+			t.Errorf("Exported fields didn't match: %v", object)
+		}
+		return
+	}
+	t.Errorf("Task a1 went missing from the export")
+}
+
+// check that a repeating task's occurrences are kept in the export, so it isn't seen for the first time every refresh
+func TestTaskwarriorOccurrences(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	tasks, _ := taskwarriorToTasks([]byte(testTaskwarriorExport), tLogger)
+	if !trackOccurrences(tasks, mid, tLogger) {
+		t.Errorf("Expected the book club to start being tracked")
+	}
+	outStr, err := outputTaskwarrior(tasks)
+	if err != nil {
+		t.Errorf("Unexpected error writing export: %s", err.Error())
+		t.FailNow()
+	}
+	reread, _ := taskwarriorToTasks([]byte(outStr), tLogger)
+	if trackOccurrences(reread, mid, tLogger) {
+		t.Errorf("Expected nothing to change once the occurrences were written:\n%s", outStr)
+	}
+	for _, task := range reread {
+		if task.UUID == "d4" && (task.BaseEstimate != 90 || !task.Occurrence.Equal(tasks[2].Occurrence) || task.Occurrence.IsZero()) {
+			t.Errorf("Expected the book club's base estimate and occurrence back, got %d and %s", task.BaseEstimate, task.Occurrence)
+		}
+	}
+	// finishing an occurrence mustn't end the whole recurrence in Taskwarrior
+	reread[2].setEstimate(0)
+	outStr, _ = outputTaskwarrior(reread)
+	objects := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(outStr), &objects); err != nil || objects[2]["status"] != "recurring" || objects[2]["end"] != nil ||
+		objects[2]["estimate"] != "PT0H" {
+		t.Errorf("Expected the book club to stay recurring with nothing left this time, got %v", objects[2])
+	}
+	if done, _ := taskwarriorToTasks([]byte(outStr), tLogger); !done[2].isComplete() {
+		t.Errorf("Expected the book club to come back done for this occurrence, got %d minutes", done[2].estimateMinutes())
+	}
+	later := mid.AddDate(0, 0, 7)
+	if !trackOccurrences(reread, later, tLogger) || reread[2].Streak != 1 || reread[2].estimateMinutes() != 90 {
+		t.Errorf("Expected the book club to start over with a streak of 1, got %d and %d", reread[2].Streak, reread[2].estimateMinutes())
+	}
+}
+
+// check that a chore that repeats after it's done keeps its interval and when it was done through the export
+func TestTaskwarriorFloatingRecurrence(t *testing.T) {
+	tLogger := log15.New()
+	export := `[{"description":"Water plants","due":"20221127T180000Z","estimate":"PT30M","status":"completed","uuid":"f1","perspectiverepeat":"5 days"}]`
+	tasks, _ := taskwarriorToTasks([]byte(export), tLogger)
+	done := time.Date(2022, 11, 26, 9, 30, 0, 0, time.UTC)
+	if len(tasks) != 1 || tasks[0].RepeatAfter != "5 days" || !trackOccurrences(tasks, done, tLogger) {
+		t.Errorf("Expected the plants to be watered and come up again")
+		t.FailNow()
+	}
+	outStr, _ := outputTaskwarrior(tasks)
+	reread, _ := taskwarriorToTasks([]byte(outStr), tLogger)
+	if len(reread) != 1 || reread[0].RepeatAfter != "5 days" || !reread[0].Completed.Equal(done) || reread[0].isComplete() ||
+		reread[0].Deadline != "09:30 12/01/2022 UTC" {
+		t.Errorf("Chore didn't survive the export:\n%s", outStr)
+	}
+}
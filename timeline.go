@@ -0,0 +1,126 @@
+package main
+
+import (
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// The free time before a deadline is usually counted by repeating one cycle of the rotation up to it (see
+// takeRotationTime), which is only right while every cycle looks the same. When something date-specific happens
+// before the deadline, like a one-off event, an event starting or stopping, an exception date, or the clocks changing
+// in an event's zone but not ours, the busy time is laid out on the calendar instead, one occurrence at a time.
+
+// needsTimeline is true when repeating the rotation won't give the right busy time between now and until
+func needsTimeline(now, until time.Time, genEvents []*GeneralEvent, logger log15.Logger) bool {
+	for _, event := range genEvents {
+		if event.Inactive || event.validate() != nil {
+			continue
+		}
+		if event.isDated() {
+			periods, _ := event.periods() // validated above
+			for _, period := range periods {
+				if period.End.After(now) && period.Start.Before(until) {
+					logger.Debug("Projecting a timeline for a dated event", "event", event.Name)
+					return true
+				}
+			}
+			continue
+		}
+		if event.followsCalendar() {
+			// the rotation leaves these out, see getNextBlockedSpans
+			logger.Debug("Projecting a timeline for an event with active or exception dates", "event", event.Name)
+			return true
+		}
+		if event.Zone != "" {
+			nowShift, _ := zoneShift(now, event.Zone) // validated above
+			untilShift, _ := zoneShift(until.In(now.Location()), event.Zone)
+			if nowShift != untilShift {
+				logger.Debug("Projecting a timeline for an event whose clocks change", "event", event.Name)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// projectTimeline counts the free minutes in window (see deadlineWindow) with every event laid out on the calendar
+func (t *Task) projectTimeline(now time.Time, window span, genEvents []*GeneralEvent, logger log15.Logger) int {
+	// the window counts from the start of this cycle, the timeline from the prime Sunday
+	cycleStart := (absoluteHourBlock(now) - nextHourBlock(now, logger)) * 60
+	window = span{window.start + cycleStart, window.end + cycleStart}
+	until := fromWallMinutes(window.end+primeWallHours()*60, now.Location())
+	busy := []span{}
+	for _, blocked := range getTimelineSpans(now, until, genEvents, logger) {
+		busy = append(busy, clipSpan(blocked, window))
+	}
+	busyMinutes := totalMinutes(mergeSpans(busy))
+	logger.Debug("Projected the timeline up to the deadline", "busyMinutes", busyMinutes)
+	t.BusyMinutes = busyMinutes
+	t.FreeMinutes = window.end - window.start - busyMinutes
+	t.syncHours()
+	return t.FreeMinutes
+}
+
+// getTimelineSpans lists the time every active event blocks from the start of from's cycle up to until, in minutes
+// from the prime Sunday on from's clock. Overlapping events only block the time they share once.
+func getTimelineSpans(from, until time.Time, genEvents []*GeneralEvent, logger log15.Logger) []span {
+	spans := getDatedBlockedSpans(from.Location(), genEvents)
+	spans = append(spans, getOccurrenceSpans(from, until, genEvents, func(*GeneralEvent) bool { return true }, logger)...)
+	return mergeSpans(spans)
+}
+
+// getOccurrenceSpans lays out each occurrence of the rotation events include picks from the start of from's cycle up
+// to until, in minutes from the prime Sunday on from's clock. Occurrences are only kept for the part of them the
+// event is active, and ones starting on one of the event's exception dates are skipped. Events in another zone are
+// moved onto from's clock at each occurrence, so they keep to their own clock when either one changes.
+func getOccurrenceSpans(from, until time.Time, genEvents []*GeneralEvent, include func(*GeneralEvent) bool, topLogger log15.Logger) []span {
+	loc := from.Location()
+	primeMinutes := primeWallHours() * 60
+	cycleStart := (absoluteHourBlock(from) - nextHourBlock(from, topLogger)) * 60
+	untilPos := wallMinutes(until.In(loc)) - primeMinutes
+	spans := []span{}
+	for _, event := range genEvents {
+		if event.Inactive || event.isDated() || !include(event) || event.validate() != nil {
+			continue
+		}
+		logger := topLogger.New("event", event.Name, "function", "getOccurrenceSpans")
+		window, _ := event.activeWindow() // validated above
+		except, _ := event.exceptions()
+		active := span{cycleStart, untilPos}
+		if !window.Start.IsZero() {
+			active.start = wallMinutes(window.Start.In(loc)) - primeMinutes
+		}
+		if !window.End.IsZero() {
+			active.end = wallMinutes(window.End.In(loc)) - primeMinutes
+		}
+		if active.end > untilPos {
+			active.end = untilPos
+		}
+		var zone *time.Location
+		if event.Zone != "" {
+			zone, _ = time.LoadLocation(event.Zone) // validated above
+		}
+		occurrences := event.cycleOccurrences(logger)
+		// start a cycle early, its last occurrences can run into this one
+		for start := cycleStart - cycleMinutes(); start < active.end; start += cycleMinutes() {
+			for _, busy := range occurrences {
+				// wall clock minutes on UTC's clock are just the date and time
+				day := fromWallMinutes(start+busy.start+primeMinutes, time.UTC).Format(anchorDateFmt)
+				if except[day] {
+					logger.Debug("Skipping occurrence on an exception date", "date", day)
+					continue
+				}
+				shift := 0
+				if zone != nil {
+					at := fromWallMinutes(start+busy.start+primeMinutes, loc)
+					_, homeOffset := at.Zone()
+					_, zoneOffset := at.In(zone).Zone()
+					shift = (homeOffset - zoneOffset) / 60
+				}
+				spans = append(spans, clipSpan(span{start + busy.start + shift, start + busy.end + shift}, active))
+			}
+		}
+	}
+	return mergeSpans(spans)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that the timeline is only projected when something date-specific happens before the deadline
+func TestNeedsTimeline(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	work := &GeneralEvent{Name: "Work", Rotation: "both", Days: "Mon-Fri", StartTime: 9, Duration: 8}
+	tests := []struct {
+		name     string
+		deadline string
+		event    *GeneralEvent
+		needs    bool
+	}{
+		{name: "rotation", deadline: "16:00 03/28/2023", event: work, needs: false},
+		{name: "dentist before", deadline: "16:00 12/28/2022", event: &GeneralEvent{Name: "Dentist", Date: "12/05/2022", StartTime: 9, Duration: 1}, needs: true},
+		{name: "dentist after", deadline: "16:00 12/28/2022", event: &GeneralEvent{Name: "Dentist", Date: "01/05/2023", StartTime: 9, Duration: 1}, needs: false},
+		{name: "dentist long ago", deadline: "16:00 12/28/2022", event: &GeneralEvent{Name: "Dentist", Date: "01/05/2022", StartTime: 9, Duration: 1}, needs: false},
+		{name: "dentist cancelled", deadline: "16:00 12/28/2022", event: &GeneralEvent{Name: "Dentist", Date: "12/05/2022", StartTime: 9, Duration: 1, Inactive: true}, needs: false},
+		{name: "class", deadline: "16:00 12/28/2022", event: &GeneralEvent{Name: "Class", Rotation: "first", Days: "Mon", StartTime: 10, Duration: 1, ActiveUntil: "12/16/2022"}, needs: true},
+		{name: "standup before the clocks change", deadline: "16:00 12/28/2022", event: &GeneralEvent{Name: "Standup", Rotation: "both", Days: "Mon-Fri", StartTime: 10, Duration: 1, Zone: "America/New_York"}, needs: false},
+		{name: "standup after the clocks change", deadline: "16:00 03/28/2023", event: &GeneralEvent{Name: "Standup", Rotation: "both", Days: "Mon-Fri", StartTime: 10, Duration: 1, Zone: "America/New_York"}, needs: true},
+	}
+	for _, test := range tests {
+		deadline, err := parseDeadline(test.deadline)
+		if err != nil {
+			t.Errorf("Unexpected error parsing deadline for %s: %s", test.name, err.Error())
+			t.FailNow()
+		}
+		if needs := needsTimeline(mid, deadline, []*GeneralEvent{test.event}, tLogger); needs != test.needs {
+			t.Errorf("Expected %s to need a timeline %t, got %t", test.name, test.needs, needs)
+		}
+	}
+}
+
+// check that the timeline and the repeated rotation agree when nothing date-specific happens, however far away the
+// deadline is
+func TestTimelineMatchesRotation(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	events := []*GeneralEvent{
+		{Name: "Work", Rotation: "both", Days: "Mon-Fri", StartTime: 9, Duration: 8},
+		{Name: "Gym", Rotation: "second", Days: "Tue, Thur", StartTime: 17, Duration: 2},
+		{Name: "Lunch", Rotation: "both", Days: "Mon-Fri", StartTime: 12, Duration: 1},
+	}
+	for _, deadline := range []string{"16:00 11/28/2022", "16:00 12/28/2022", "09:30 03/28/2023", "18:00 second Thursday"} {
+		blocked, err := getNextBlockedSpans(mid, events, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error blocking time: %s", err.Error())
+			t.FailNow()
+		}
+		rotation := &Task{Name: "Report", Deadline: deadline, EstimatedHours: 1}
+		window, err := rotation.deadlineWindow(mid, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %s", deadline, err.Error())
+			t.FailNow()
+		}
+		timeline := &Task{Name: "Report", Deadline: deadline, EstimatedHours: 1}
+		rotationMinutes := rotation.takeRotationTime(window, blocked, tLogger)
+		timelineMinutes := timeline.projectTimeline(mid, window, events, tLogger)
+		if rotationMinutes != timelineMinutes || rotation.BusyMinutes != timeline.BusyMinutes {
+			t.Errorf("Free time up to %s didn't match;\nRotation: %d (%d busy)\nTimeline: %d (%d busy)",
+				deadline, rotationMinutes, rotation.BusyMinutes, timelineMinutes, timeline.BusyMinutes)
+		}
+	}
+}
+
+// check that an event in another zone keeps to its own clock when it changes and ours doesn't
+func TestTimelineAcrossZoneChange(t *testing.T) {
+	tLogger := log15.New()
+	mid := generateTestingTimes()["mid"]
+	// 10:00 in New York is 15:00 here in the winter but 14:00 once New York springs forward on 03/12/2023
+	standup := &GeneralEvent{Name: "Standup", Rotation: "both", Days: "Mon-Fri", StartTime: 10, Duration: 1, Zone: "America/New_York"}
+	busy := func(deadline string) int {
+		report := &Task{Name: "Report", Deadline: deadline, EstimatedHours: 1}
+		if err := report.calculateUrgency(mid, []*GeneralEvent{standup}, tLogger); err != nil {
+			t.Errorf("Unexpected error calculating urgency up to %s: %s", deadline, err.Error())
+			t.FailNow()
+		}
+		return report.BusyMinutes
+	}
+	// the deadline is counted through 15:00, which only catches Monday's standup after the change
+	if extra := busy("14:00 03/13/2023") - busy("23:00 03/10/2023"); extra != 60 {
+		t.Errorf("Expected Monday's standup to be an hour earlier after the change, got %d more busy minutes", extra)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	// zone names have to work on systems without a zoneinfo database too
+	_ "time/tzdata"
+
+	"github.com/inconshreveable/log15"
+)
+
+// Hour blocks count hours on the wall clock of the home time zone, so an event at 23:00 stays at 23:00 when daylight
+// saving time starts or ends. The home zone is PERSPECTIVE_TZ, an IANA name like America/New_York, or the system's.
+// Deadlines can name their own zone, either an IANA name ("17:00 03/12/2023 America/Chicago") or an abbreviation
+// ("17:00 03/12/2023 EDT"); abbreviations are looked up in the home zone first since on their own they're ambiguous.
+
+var deadlineClockFmt = "15:04 01/02/2006"
+
+// homeLocation is where "now" is read and where deadlines without a zone are
+var homeLocation = time.Local
+
+// configureZone reads the home zone from the environment, keeping the system's zone if it's off
+func configureZone(logger log15.Logger) {
+	homeLocation = time.Local
+	name := os.Getenv("PERSPECTIVE_TZ")
+	if name == "" {
+		return
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		logger.Error("Unknown time zone, using the system's", "PERSPECTIVE_TZ", name, "err", err.Error())
+		return
+	}
+	homeLocation = loc
+}
+
+// currentTime is now on the home zone's clock
+func currentTime() time.Time {
+	return time.Now().In(homeLocation)
+}
+
+// ianaZoneName is the IANA name of a location if it has one, or empty for the system zone we can't name and for
+// zones made up from an abbreviation
+func ianaZoneName(loc *time.Location) string {
+	name := loc.String()
+	if name == "Local" {
+		name = strings.TrimPrefix(os.Getenv("TZ"), ":")
+	}
+	if !strings.Contains(name, "/") {
+		return ""
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// parseDeadline reads a dated deadline, see the top of this file for the zones it understands
+func parseDeadline(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if deadline, err := time.ParseInLocation(deadlineClockFmt, value, homeLocation); err == nil {
+		return deadline, nil
+	}
+	cut := strings.LastIndex(value, " ")
+	if cut == -1 {
+		return time.Time{}, fmt.Errorf("Unable to parse '%s' as a dated deadline", value)
+	}
+	clock, zone := value[:cut], value[cut+1:]
+	if strings.Contains(zone, "/") {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Unknown time zone '%s' in deadline '%s'", zone, value)
+		}
+		return time.ParseInLocation(deadlineClockFmt, clock, loc)
+	}
+	if deadline, ok := parseInHomeAbbreviation(clock, zone); ok {
+		return deadline, nil
+	}
+	return time.Parse(taskDateFmt, value)
+}
+
+// parseInHomeAbbreviation reads a clock time given with one of the home zone's abbreviations, standard or daylight
+// saving. A summer date written with the winter abbreviation, like EST in July, keeps the winter offset.
+func parseInHomeAbbreviation(clock, zone string) (time.Time, bool) {
+	local, err := time.ParseInLocation(deadlineClockFmt, clock, homeLocation)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if name, _ := local.Zone(); name == zone {
+		return local, true
+	}
+	for _, month := range []time.Month{time.January, time.July} {
+		name, offset := time.Date(local.Year(), month, 1, 12, 0, 0, 0, homeLocation).Zone()
+		if name == zone {
+			fixed, err := time.ParseInLocation(deadlineClockFmt, clock, time.FixedZone(zone, offset))
+			return fixed.In(homeLocation), err == nil
+		}
+	}
+	return time.Time{}, false
+}
+
+// isDatedDeadline tells dated deadlines from repeating ones like "18:00 first Monday"
+func isDatedDeadline(value string) bool {
+	_, err := parseDeadline(value)
+	return err == nil
+}
+
+// zoneShift is how many minutes ahead the home clock (now's) is of the clock in the named zone, right now
+func zoneShift(now time.Time, zone string) (int, error) {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown time zone '%s'", zone)
+	}
+	_, homeOffset := now.Zone()
+	_, zoneOffset := now.In(loc).Zone()
+	return (homeOffset - zoneOffset) / 60, nil
+}
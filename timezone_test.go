@@ -0,0 +1,267 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// In 2023 New York springs forward on Sunday 03/12 and falls back on Sunday 11/05, both first Sundays of the
+// default rotation.
+
+// useHomeZone switches the home zone, and the system's, away from UTC (see TestMain) for the rest of a test
+func useHomeZone(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("Unable to load %s: %s", name, err.Error())
+	}
+	previous, previousLocal := homeLocation, time.Local
+	homeLocation, time.Local = loc, loc
+	t.Cleanup(func() { homeLocation, time.Local = previous, previousLocal })
+	return loc
+}
+
+func dstTestingTimes(loc *time.Location) map[string]time.Time {
+	return map[string]time.Time{
+		"before spring": time.Date(2023, 3, 11, 20, 0, 0, 0, loc),  // second Saturday, EST
+		"after spring":  time.Date(2023, 3, 18, 20, 0, 0, 0, loc),  // first Saturday, EDT
+		"before fall":   time.Date(2023, 11, 4, 20, 0, 0, 0, loc),  // second Saturday, EDT
+		"after fall":    time.Date(2023, 11, 11, 20, 0, 0, 0, loc), // first Saturday, EST
+	}
+}
+
+// check that hour blocks stay on the wall clock on both sides of both transitions
+func TestHourBlocksAcrossDST(t *testing.T) {
+	tLogger := log15.New()
+	ny := useHomeZone(t, "America/New_York")
+	times := dstTestingTimes(ny)
+	testCases := []struct {
+		time      string
+		hourBlock int
+		day       string
+	}{
+		{"before spring", 333, "second Saturday"},
+		{"after spring", 165, "first Saturday"},
+		{"before fall", 333, "second Saturday"},
+		{"after fall", 165, "first Saturday"},
+	}
+	for _, testCase := range testCases {
+		now := times[testCase.time]
+		if hourBlock := nextHourBlock(now, tLogger); hourBlock != testCase.hourBlock {
+			t.Errorf("Expected %s to be hour block %d, got %d", testCase.time, testCase.hourBlock, hourBlock)
+		}
+		if day := whatDayIsIt(now, tLogger); day != testCase.day {
+			t.Errorf("Expected %s to be %s, got %s", testCase.time, testCase.day, day)
+		}
+	}
+}
+
+// check that deadlines and free hours are counted on the wall clock through a transition
+func TestDeadlinesAcrossDST(t *testing.T) {
+	tLogger := log15.New()
+	ny := useHomeZone(t, "America/New_York")
+	times := dstTestingTimes(ny)
+	sleepEvent := &GeneralEvent{Name: "sleep", Rotation: bothWeeks, Days: "Sun-Sat", StartTime: 23, Duration: 8}
+	blockedHours := sleepEvent.generateBlockedHours(tLogger)
+	testCases := []struct {
+		title        string
+		time         string
+		deadline     string
+		deadlineTime time.Time
+		hoursLeft    int
+	}{
+		{
+			title:        "repeating deadline after springing forward",
+			time:         "before spring",
+			deadline:     "18:00 first Monday",
+			deadlineTime: time.Date(2023, 3, 13, 18, 0, 0, 0, ny),
+			hoursLeft:    45 - 16,
+		},
+		{
+			title:        "repeating deadline after falling back",
+			time:         "before fall",
+			deadline:     "18:00 first Monday",
+			deadlineTime: time.Date(2023, 11, 6, 18, 0, 0, 0, ny),
+			hoursLeft:    45 - 16,
+		},
+		{
+			title:        "dated deadline with a zone name after springing forward",
+			time:         "before spring",
+			deadline:     "09:00 03/13/2023 America/New_York",
+			deadlineTime: time.Date(2023, 3, 13, 9, 0, 0, 0, ny),
+			hoursLeft:    37 - 16,
+		},
+		{
+			title:        "dated deadline with an abbreviation after falling back",
+			time:         "before fall",
+			deadline:     "09:00 11/06/2023 EST",
+			deadlineTime: time.Date(2023, 11, 6, 9, 0, 0, 0, ny),
+			hoursLeft:    37 - 16,
+		},
+		{
+			title:        "dated deadline in another zone",
+			time:         "after spring",
+			deadline:     "06:00 03/20/2023 America/Los_Angeles",
+			deadlineTime: time.Date(2023, 3, 20, 9, 0, 0, 0, ny),
+			hoursLeft:    37 - 16,
+		},
+	}
+	for _, testCase := range testCases {
+		task := &Task{Name: testCase.title, Deadline: testCase.deadline, EstimatedHours: 1}
+		hoursLeft, err := task.getHoursLeft(times[testCase.time], blockedHours, tLogger)
+		if err != nil {
+			t.Errorf("Problem with '%s': %s", testCase.title, err.Error())
+			continue
+		}
+		if !task.DeadlineTime.Equal(testCase.deadlineTime) {
+			t.Errorf("Problem with '%s'; expected deadline %s, got %s", testCase.title, testCase.deadlineTime, task.DeadlineTime)
+		}
+		if hoursLeft != testCase.hoursLeft {
+			t.Errorf("Problem with '%s'; expected %d hours left, got %d", testCase.title, testCase.hoursLeft, hoursLeft)
+		}
+	}
+}
+
+// check the ways a deadline can name its zone
+func TestParseDeadlineZones(t *testing.T) {
+	ny := useHomeZone(t, "America/New_York")
+	testCases := []struct {
+		deadline string
+		expected time.Time
+	}{
+		{"18:00 07/04/2023", time.Date(2023, 7, 4, 18, 0, 0, 0, ny)},
+		{"18:00 07/04/2023 EDT", time.Date(2023, 7, 4, 18, 0, 0, 0, ny)},
+		{"18:00 01/04/2023 EST", time.Date(2023, 1, 4, 18, 0, 0, 0, ny)},
+		{"18:00 07/04/2023 EST", time.Date(2023, 7, 4, 19, 0, 0, 0, ny)},
+		{"18:00 07/04/2023 America/Los_Angeles", time.Date(2023, 7, 4, 21, 0, 0, 0, ny)},
+		{"18:00 07/04/2023 UTC", time.Date(2023, 7, 4, 14, 0, 0, 0, ny)},
+	}
+	for _, testCase := range testCases {
+		actual, err := parseDeadline(testCase.deadline)
+		if err != nil || !actual.Equal(testCase.expected) {
+			t.Errorf("Expected '%s' to be %s, got %s (%v)", testCase.deadline, testCase.expected, actual, err)
+		}
+	}
+	for _, bad := range []string{"18:00 first Monday", "18:00 07/04/2023 Mars/Olympus_Mons"} {
+		if isDatedDeadline(bad) {
+			t.Errorf("Didn't expect '%s' to be a dated deadline", bad)
+		}
+	}
+}
+
+// check that events on another zone's clock follow that zone, including while only one side has switched
+func TestEventZones(t *testing.T) {
+	tLogger := log15.New()
+	ny := useHomeZone(t, "America/New_York")
+	standup := &GeneralEvent{Name: "London standup", Rotation: bothWeeks, Days: "Mon", StartTime: 9, Duration: 1, Zone: "Europe/London"}
+	testCases := []struct {
+		now       time.Time
+		mondayRun int
+	}{
+		{time.Date(2023, 3, 18, 20, 0, 0, 0, ny), 168 + 24 + 5}, // New York has sprung forward, London hasn't
+		{time.Date(2023, 4, 1, 20, 0, 0, 0, ny), 168 + 24 + 4},  // both have
+	}
+	for _, testCase := range testCases {
+		hours, err := getNextBlockedHours(testCase.now, []*GeneralEvent{standup}, tLogger)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err.Error())
+			t.FailNow()
+		}
+		found := false
+		for _, hour := range hours {
+			found = found || hour == testCase.mondayRun
+		}
+		if !found {
+			t.Errorf("Expected the standup at hour block %d on %s, got %v", testCase.mondayRun, testCase.now, hours)
+		}
+	}
+	standup.Zone = "Mars/Olympus_Mons"
+	if err := standup.validate(); err == nil {
+		t.Errorf("Expected an error for an unknown zone")
+	}
+}
+
+// check that a busy period through the hour the clocks go back blocks each wall clock hour once
+func TestDatedHoursAcrossDST(t *testing.T) {
+	tLogger := log15.New()
+	ny := useHomeZone(t, "America/New_York")
+	now := time.Date(2023, 11, 4, 20, 0, 0, 0, ny)
+	party := &GeneralEvent{Name: "party", Periods: []busyPeriod{{
+		Start: time.Date(2023, 11, 5, 0, 30, 0, 0, ny),
+		End:   time.Date(2023, 11, 5, 0, 30, 0, 0, ny).Add(3 * time.Hour), // 02:30 EST
+	}}}
+	hours := getDatedBlockedHours(now, now.Add(24*time.Hour), []*GeneralEvent{party}, tLogger)
+	midnight := absoluteHourBlock(time.Date(2023, 11, 4, 23, 0, 0, 0, ny)) // rounds up to midnight
+	if len(hours) != 3 || hours[0] != midnight || hours[2] != midnight+2 {
+		t.Errorf("Expected hour blocks %d through %d, got %v", midnight, midnight+2, hours)
+	}
+}
+
+// check that the calendar keeps rotation events on the wall clock with a TZID, and defines each TZID before it's used
+func TestICSZones(t *testing.T) {
+	tLogger := log15.New()
+	ny := useHomeZone(t, "America/New_York")
+	events := []*GeneralEvent{
+		{Name: "sleeping", Rotation: bothWeeks, Days: "Sun-Sat", StartTime: 23, Duration: 8},
+		{Name: "London standup", Rotation: firstWeek, Days: "Mon", StartTime: 9, Duration: 1, Zone: "Europe/London"},
+	}
+	calendar := outputICS(time.Date(2023, 3, 11, 20, 0, 0, 0, ny), events, []*Task{}, tLogger)
+	for _, expected := range []string{
+		"DTSTART;TZID=America/New_York:20220911T230000\r\nDTEND;TZID=America/New_York:20220912T070000\r\n",
+		"DTSTART;TZID=Europe/London:20220912T090000\r\nDTEND;TZID=Europe/London:20220912T100000\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:America/New_York\r\n" +
+			"BEGIN:DAYLIGHT\r\nDTSTART:19700308T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\n" +
+			"TZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\nEND:DAYLIGHT\r\n" +
+			"BEGIN:STANDARD\r\nDTSTART:19701101T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\n" +
+			"TZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/London\r\n" +
+			"BEGIN:DAYLIGHT\r\nDTSTART:19700329T010000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\n" +
+			"TZOFFSETFROM:+0000\r\nTZOFFSETTO:+0100\r\nTZNAME:BST\r\nEND:DAYLIGHT\r\n",
+	} {
+		if !strings.Contains(calendar, expected) {
+			t.Errorf("Expected calendar to contain %q;\nActual:\n%s", expected, calendar)
+		}
+	}
+	if strings.Index(calendar, "END:VTIMEZONE") > strings.Index(calendar, "BEGIN:VEVENT") {
+		t.Errorf("Expected the time zones to come before the events:\n%s", calendar)
+	}
+	// zones without daylight saving time just have the one offset
+	kolkata := outputICS(time.Date(2023, 3, 11, 20, 0, 0, 0, ny), []*GeneralEvent{
+		{Name: "Call", Rotation: firstWeek, Days: "Mon", StartTime: 9, Duration: 1, Zone: "Asia/Kolkata"},
+	}, []*Task{}, tLogger)
+	expected := "TZID:Asia/Kolkata\r\nBEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0530\r\nTZOFFSETTO:+0530\r\n"
+	if !strings.Contains(kolkata, expected) {
+		t.Errorf("Expected calendar to contain %q;\nActual:\n%s", expected, kolkata)
+	}
+}
+
+// check that zones off the hour shift events by their minutes rather than a whole number of hours
+func TestZoneShiftMinutes(t *testing.T) {
+	tLogger := log15.New()
+	kolkata := useHomeZone(t, "Asia/Kolkata")
+	now := time.Date(2023, 1, 14, 20, 0, 0, 0, kolkata)
+	testCases := []struct {
+		zone  string
+		shift int
+	}{
+		{"Asia/Kolkata", 0},
+		{"UTC", 330},
+		{"America/New_York", 630},
+		{"Australia/Adelaide", -300}, // daylight saving time there, 10:30 ahead of UTC
+		{"Asia/Kathmandu", -15},
+	}
+	for _, testCase := range testCases {
+		shift, err := zoneShift(now, testCase.zone)
+		if err != nil || shift != testCase.shift {
+			t.Errorf("Expected %s to be %d minutes behind, got %d (%v)", testCase.zone, testCase.shift, shift, err)
+		}
+	}
+	// a London standup at 09:00 is 14:30 here
+	standup := &GeneralEvent{Name: "London standup", Rotation: bothWeeks, Days: "Mon", StartTime: 9, Duration: 1, Zone: "Europe/London"}
+	spans := standup.homeBlockedSpans(now, tLogger)
+	if len(spans) != 2 || spans[0].start%(24*60) != 14*60+30 || spans[0].end-spans[0].start != 60 {
+		t.Errorf("Expected the standup from 14:30 to 15:30, got %v", spans)
+	}
+}
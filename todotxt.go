@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// todo.txt (http://todotxt.org) keeps one task per line:
+// x (A) 2022-11-20 2022-11-01 Finish book report +school @home due:2022-11-28 est:3
+// Completion mark, priority and dates come first, everything else is the description with its tags mixed in.
+// Repeating tasks keep track of their occurrences (see occurrences.go) in more key:value tokens, like
+// base:2 occurrence:2022-11-29T18:00 history:18:00_11/22/2022_EST_on_time streak:1, with underscores for spaces.
+// Chores that repeat after they're done keep theirs in repeat:5_days and completed:2022-11-24T09:30 too.
+const (
+	todoTxtFile = "todo.txt"
+
+	todoTxtDateFmt     = "2006-01-02"
+	todoTxtDateTimeFmt = "2006-01-02T15:04"
+
+	// tasks without an est: key are assumed to take an hour so they don't look finished
+	defaultTodoTxtEstimate = 1
+)
+
+var todoPriorityMatcher = regexp.MustCompile(`^\(([A-Z])\)$`)
+var todoDateMatcher = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// todoTxtToTask turns a single todo.txt line into a Task. Lines without a due date come back without a Deadline,
+// since there's nothing to rank them against.
+func todoTxtToTask(line string) (*Task, error) {
+	tokens := strings.Fields(line)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("Empty todo.txt line")
+	}
+	task := &Task{
+		EstimatedHours: defaultTodoTxtEstimate,
+		Projects:       []string{},
+		Contexts:       []string{},
+	}
+	completed := false
+	if tokens[0] == "x" {
+		completed = true
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 && todoPriorityMatcher.MatchString(tokens[0]) {
+		task.Priority = todoPriorityMatcher.FindStringSubmatch(tokens[0])[1]
+		tokens = tokens[1:]
+	}
+	// completion date, then creation date; we don't use them for anything so they're dropped
+	for dates := 0; dates < 2 && len(tokens) > 0 && todoDateMatcher.MatchString(tokens[0]); dates++ {
+		tokens = tokens[1:]
+	}
+	description := []string{}
+	for _, token := range tokens {
+		switch {
+		case len(token) > 1 && strings.HasPrefix(token, "+"):
+			task.Projects = append(task.Projects, token[1:])
+		case len(token) > 1 && strings.HasPrefix(token, "@"):
+			task.Contexts = append(task.Contexts, token[1:])
+		case strings.HasPrefix(token, "due:"):
+			deadline, err := parseTodoTxtDue(strings.TrimPrefix(token, "due:"))
+			if err != nil {
+				return nil, err
+			}
+			task.Deadline = deadline.Format(taskDateFmt)
+		case strings.HasPrefix(token, "est:"):
+			minutes, err := parseDuration(strings.TrimPrefix(token, "est:"))
+			if err != nil {
+				return nil, fmt.Errorf("Unable to parse estimate '%s' as hours or a duration like 1h30m", token)
+			}
+			task.setEstimate(minutes)
+		case strings.HasPrefix(token, "urgency:"):
+			// generated by us on the way out, it gets recalculated anyway
+		default:
+			tracked, err := readTodoTxtTracking(task, token)
+			if err != nil {
+				return nil, err
+			}
+			if !tracked {
+				description = append(description, token)
+			}
+		}
+	}
+	task.Name = strings.Join(description, " ")
+	if task.Name == "" {
+		return nil, fmt.Errorf("todo.txt line '%s' has no description", line)
+	}
+	if completed {
+		task.setEstimate(0)
+	}
+	return task, nil
+}
+
+// parseTodoTxtDue accepts both plain dates and dates with a time. A plain date is due by the end of that day.
+func parseTodoTxtDue(due string) (time.Time, error) {
+	withTime, err := time.ParseInLocation(todoTxtDateTimeFmt, due, homeLocation)
+	if err == nil {
+		return withTime, nil
+	}
+	dateOnly, err := time.ParseInLocation(todoTxtDateFmt, due, homeLocation)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to parse due date '%s'; expected YYYY-MM-DD or YYYY-MM-DDTHH:MM", due)
+	}
+	return dateOnly.AddDate(0, 0, 1), nil
+}
+
+// formatTodoTxtDue is the reverse of parseTodoTxtDue; midnight deadlines are written as the plain date before
+func formatTodoTxtDue(deadline time.Time) string {
+	if deadline.Hour() == 0 && deadline.Minute() == 0 {
+		return deadline.AddDate(0, 0, -1).Format(todoTxtDateFmt)
+	}
+	return deadline.Format(todoTxtDateTimeFmt)
+}
+
+// taskToTodoTxt writes a ranked Task back out as a todo.txt line, with its urgency as a key/value
+func taskToTodoTxt(task *Task, logger log15.Logger) string {
+	tokens := []string{}
+	if task.isComplete() {
+		tokens = append(tokens, "x")
+	}
+	if task.Priority != "" {
+		tokens = append(tokens, fmt.Sprintf("(%s)", task.Priority))
+	}
+	tokens = append(tokens, task.Name)
+	for _, project := range task.Projects {
+		tokens = append(tokens, "+"+project)
+	}
+	for _, context := range task.Contexts {
+		tokens = append(tokens, "@"+context)
+	}
+	deadline := task.DeadlineTime
+	if deadline.IsZero() {
+		parsed, err := parseDeadline(task.Deadline)
+		if err != nil {
+			logger.Warn("Task has no resolved deadline, leaving off due date", "task", task.Name, "deadline", task.Deadline)
+		}
+		deadline = parsed
+	}
+	if !deadline.IsZero() {
+		tokens = append(tokens, "due:"+formatTodoTxtDue(deadline))
+	}
+	if !task.isComplete() {
+		tokens = append(tokens, "est:"+formatDuration(task.estimateMinutes()))
+	}
+	tokens = append(tokens, todoTxtTracking(task)...)
+	tokens = append(tokens, fmt.Sprintf("urgency:%.2f", task.Urgency*100))
+	return strings.Join(tokens, " ")
+}
+
+// readTodoTxtTracking reads one of the key:value tokens a repeating task keeps its occurrences in, saying whether
+// token was one of them
+func readTodoTxtTracking(task *Task, token string) (bool, error) {
+	keyValue := strings.SplitN(token, ":", 2)
+	if len(keyValue) != 2 {
+		return false, nil
+	}
+	value := strings.Replace(keyValue[1], "_", " ", -1)
+	var err error
+	switch keyValue[0] {
+	case "base":
+		task.BaseEstimate, err = parseDuration(value)
+	case "occurrence":
+		task.Occurrence, err = time.ParseInLocation(todoTxtDateTimeFmt, value, homeLocation)
+	case "overdue":
+		task.Overdue, err = time.ParseInLocation(todoTxtDateTimeFmt, value, homeLocation)
+	case "completed":
+		task.Completed, err = time.ParseInLocation(todoTxtDateTimeFmt, value, homeLocation)
+	case "repeat":
+		task.RepeatAfter = value
+	case "history":
+		task.History = splitList(value)
+	case "streak":
+		task.Streak, err = strconv.Atoi(value)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return true, fmt.Errorf("Unable to parse '%s' in todo.txt line", token)
+	}
+	return true, nil
+}
+
+// todoTxtTracking writes the occurrences of a repeating task as tokens for readTodoTxtTracking
+func todoTxtTracking(task *Task) []string {
+	tokens := []string{}
+	if task.BaseEstimate != 0 {
+		tokens = append(tokens, "base:"+formatDuration(task.BaseEstimate))
+	}
+	if !task.Occurrence.IsZero() {
+		tokens = append(tokens, "occurrence:"+task.Occurrence.In(homeLocation).Format(todoTxtDateTimeFmt))
+	}
+	if !task.Overdue.IsZero() {
+		tokens = append(tokens, "overdue:"+task.Overdue.In(homeLocation).Format(todoTxtDateTimeFmt))
+	}
+	if !task.Completed.IsZero() {
+		tokens = append(tokens, "completed:"+task.Completed.In(homeLocation).Format(todoTxtDateTimeFmt))
+	}
+	if task.RepeatAfter != "" {
+		tokens = append(tokens, "repeat:"+strings.Replace(task.RepeatAfter, " ", "_", -1))
+	}
+	if len(task.History) != 0 {
+		tokens = append(tokens, "history:"+strings.Replace(strings.Join(task.History, ","), " ", "_", -1))
+	}
+	if task.Streak != 0 {
+		tokens = append(tokens, "streak:"+strconv.Itoa(task.Streak))
+	}
+	return tokens
+}
+
+// todoTxtToTasks parses a whole todo.txt file. Lines that can't be ranked (no due date, or not understood at all)
+// are handed back separately so they can be carried through untouched.
+func todoTxtToTasks(lines []string, topLogger log15.Logger) ([]*Task, []string) {
+	topLogger = topLogger.New("function", "todoTxtToTasks")
+	tasks := []*Task{}
+	unranked := []string{}
+	for index, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		loopLogger := topLogger.New("line", line, "index", index)
+		task, err := todoTxtToTask(line)
+		if err != nil {
+			loopLogger.Warn("Unable to parse todo.txt line, passing it through", "err", err.Error())
+			unranked = append(unranked, line)
+			continue
+		}
+		if task.Deadline == "" {
+			loopLogger.Debug("todo.txt line has no due date, passing it through")
+			unranked = append(unranked, line)
+			continue
+		}
+		task.buildRaw()
+		tasks = append(tasks, task)
+	}
+	return tasks, unranked
+}
+
+// outputTodoTxt writes ranked tasks in the order they were sorted, followed by any lines we couldn't rank
+func outputTodoTxt(tasks []*Task, unranked []string, logger log15.Logger) string {
+	outStr := ""
+	for _, task := range tasks {
+		outStr += taskToTodoTxt(task, logger) + "\n"
+	}
+	for _, line := range unranked {
+		outStr += line + "\n"
+	}
+	return outStr
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+)
+
+// check that todo.txt lines come in with their priority, tags, due date, estimate and completion
+func TestTodoTxtToTask(t *testing.T) {
+	tests := []struct {
+		line           string
+		name           string
+		priority       string
+		projects       []string
+		contexts       []string
+		deadline       time.Time
+		estimatedHours int
+	}{
+		{
+			line:           "(A) 2022-11-01 Finish first book report +school @home due:2022-11-28T16:00 est:3",
+			name:           "Finish first book report",
+			priority:       "A",
+			projects:       []string{"school"},
+			contexts:       []string{"home"},
+			deadline:       time.Date(2022, 11, 28, 16, 0, 0, 0, time.UTC),
+			estimatedHours: 3,
+		},
+		{
+			line:           "Call mom @phone due:2022-11-27",
+			name:           "Call mom",
+			contexts:       []string{"phone"},
+			deadline:       time.Date(2022, 11, 28, 0, 0, 0, 0, time.UTC),
+			estimatedHours: defaultTodoTxtEstimate,
+		},
+		{
+			line:           "x 2022-11-20 2022-11-01 Read the syllabus due:2022-09-28T16:00 est:1 urgency:12.00",
+			name:           "Read the syllabus",
+			deadline:       time.Date(2022, 9, 28, 16, 0, 0, 0, time.UTC),
+			estimatedHours: 0,
+		},
+	}
+	for _, test := range tests {
+		task, err := todoTxtToTask(test.line)
+		if err != nil {
+			t.Errorf("Unexpected error parsing '%s': %s", test.line, err.Error())
+			t.FailNow()
+		}
+		if task.Name != test.name || task.Priority != test.priority || task.EstimatedHours != test.estimatedHours {
+			t.Errorf("Parsed '%s' wrong;\nActual: %q %q %d\nExpected: %q %q %d", test.line, task.Name, task.Priority, task.EstimatedHours, test.name, test.priority, test.estimatedHours)
+		}
+		if len(task.Projects) != len(test.projects) || len(task.Contexts) != len(test.contexts) {
+			t.Errorf("Parsed tags of '%s' wrong;\nActual: %v %v\nExpected: %v %v", test.line, task.Projects, task.Contexts, test.projects, test.contexts)
+		}
+		if deadline, err := parseDeadline(task.Deadline); err != nil || !deadline.Equal(test.deadline) {
+			t.Errorf("Parsed deadline of '%s' wrong;\nActual: %s\nExpected: %s", test.line, task.Deadline, test.deadline)
+		}
+	}
+}
+
+// check that ranked tasks are written back out in order with urgency, and undated lines pass through
+func TestTodoTxtRoundTrip(t *testing.T) {
+	tLogger := log15.New()
+	lines := []string{
+		"(B) Finish second book report +school due:2022-12-28T16:00 est:1",
+		"Buy stamps @errands",
+		"(A) Finish first book report +school due:2022-11-28T16:00 est:1",
+	}
+	tasks, unranked := todoTxtToTasks(lines, tLogger)
+	if len(tasks) != 2 || len(unranked) != 1 {
+		t.Errorf("Expected 2 ranked tasks and 1 unranked line, got %d and %d", len(tasks), len(unranked))
+		t.FailNow()
+	}
+	sortTasks(tasks, generateTestingTimes()["mid"], []*GeneralEvent{}, tLogger)
+	expected := "(A) Finish first book report +school due:2022-11-28T16:00 est:1 urgency:2.38\n" +
+		"(B) Finish second book report +school due:2022-12-28T16:00 est:1 urgency:0.13\n" +
+		"Buy stamps @errands\n"
+	actual := outputTodoTxt(tasks, unranked, tLogger)
+	if actual != expected {
+		t.Errorf("todo.txt output didn't match;\nExpected:\n%s\nActual:\n%s", expected, actual)
+	}
+}
+
+// check that a repeating task's occurrences come back from the keys they're written in
+func TestTodoTxtOccurrences(t *testing.T) {
+	tLogger := log15.New()
+	line := "Water plants due:2022-11-29T18:00 est:1 base:1h30m occurrence:2022-11-29T18:00 overdue:2022-11-22T18:00 " +
+		"history:18:00_11/08/2022_UTC_on_time,18:00_11/15/2022_UTC_late streak:2"
+	task, err := todoTxtToTask(line)
+	if err != nil {
+		t.Errorf("Unexpected error parsing '%s': %s", line, err.Error())
+		t.FailNow()
+	}
+	if task.Name != "Water plants" || task.BaseEstimate != 90 || task.Streak != 2 || len(task.History) != 2 ||
+		task.History[1] != "18:00 11/15/2022 UTC late" ||
+		!task.Occurrence.Equal(time.Date(2022, 11, 29, 18, 0, 0, 0, time.UTC)) || !task.Overdue.Equal(time.Date(2022, 11, 22, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Occurrences didn't match, got %+v", task)
+	}
+	if _, err := todoTxtToTask("Water plants due:2022-11-29T18:00 streak:lots"); err == nil {
+		t.Errorf("Expected an error for a streak that isn't a number")
+	}
+	expected := "Water plants due:2022-11-29T18:00 est:1 base:1h30m occurrence:2022-11-29T18:00 overdue:2022-11-22T18:00 " +
+		"history:18:00_11/08/2022_UTC_on_time,18:00_11/15/2022_UTC_late streak:2 urgency:0.00"
+	if actual := taskToTodoTxt(task, tLogger); actual != expected {
+		t.Errorf("todo.txt line didn't match;\nExpected: %s\nActual: %s", expected, actual)
+	}
+}
+
+// check that a chore that repeats after it's done keeps its interval and when it was done through todo.txt
+func TestTodoTxtFloatingRecurrence(t *testing.T) {
+	tLogger := log15.New()
+	tasks, _ := todoTxtToTasks([]string{"x Water plants due:2022-11-27T18:00 est:30m base:30m repeat:5_days"}, tLogger)
+	done := time.Date(2022, 11, 26, 9, 30, 0, 0, time.UTC)
+	if len(tasks) != 1 || tasks[0].RepeatAfter != "5 days" || !trackOccurrences(tasks, done, tLogger) {
+		t.Errorf("Expected the plants to be watered and come up again")
+		t.FailNow()
+	}
+	line := taskToTodoTxt(tasks[0], tLogger)
+	reread, err := todoTxtToTask(line)
+	if err != nil {
+		t.Errorf("Unexpected error parsing '%s': %s", line, err.Error())
+		t.FailNow()
+	}
+	if reread.RepeatAfter != "5 days" || !reread.Completed.Equal(done) || reread.Deadline != "09:30 12/01/2022 UTC" ||
+		reread.estimateMinutes() != 30 || reread.Streak != 1 {
+		t.Errorf("Chore didn't survive todo.txt: %s", line)
+	}
+}